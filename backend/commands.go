@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"habits/database"
+	"habits/models"
+	"habits/todotxt"
+)
+
+// runCommand runs a command-line subcommand
+func runCommand(name string, args []string) error {
+	switch name {
+	case "migrate":
+		return migrateCommand(args)
+	case "check":
+		return checkCommand(args)
+	case "backup":
+		return backupCommand(args)
+	case "restore":
+		return restoreCommand(args)
+	case "sync-notes":
+		return syncNotesCommand(args)
+	case "todo":
+		return todoCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q (available: migrate, check, backup, restore, sync-notes, todo)", name)
+	}
+}
+
+// migrateCommand manages the schema version:
+//
+//	migrate [up]        apply all pending migrations
+//	migrate down [n]    revert the last n migrations (default 1)
+//	migrate to <v>      migrate up or down to version v
+//	migrate status      list migrations and whether they are applied
+func migrateCommand(args []string) error {
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		err = database.Migrate(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		err = database.Rollback(db, steps)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = database.MigrateTo(db, version)
+	case "status":
+		return printMigrationStatus(db)
+	default:
+		return fmt.Errorf("unknown migrate action %q (available: up, down, to, status)", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := database.Version(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema is at version %d\n", version)
+	return nil
+}
+
+// printMigrationStatus prints each migration and when it was applied
+func printMigrationStatus(db *sql.DB) error {
+	status, err := database.Status(db)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range status {
+		state := "pending"
+		if s.Applied {
+			state = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+	}
+
+	return nil
+}
+
+// checkCommand reports orphaned rows and habits without a streak record:
+//
+//	check           list problems without changing anything
+//	check --repair  delete orphans and create missing streak records
+func checkCommand(args []string) error {
+	repair := false
+	for _, arg := range args {
+		if arg != "--repair" {
+			return fmt.Errorf("unknown check option %q (available: --repair)", arg)
+		}
+		repair = true
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Repairs run before migrating, so orphans are removed and reported
+	// here rather than by the migration that cleans them up; a plain check
+	// migrates first so every table is checked
+	var problems []database.Inconsistency
+	if repair {
+		if problems, err = database.CheckConsistency(db, true); err != nil {
+			return err
+		}
+	}
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+	if !repair {
+		if problems, err = database.CheckConsistency(db, false); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	for _, p := range problems {
+		state := ""
+		if p.Repaired {
+			state = " (repaired)"
+		}
+		fmt.Printf("%6d %s%s\n", p.Count, p.Description, state)
+	}
+	if !repair {
+		fmt.Println("Run with --repair to fix")
+	}
+
+	return nil
+}
+
+// backupCommand snapshots the SQLite database while it may be in use:
+//
+//	backup          write a timestamped snapshot to the backup directory
+//	backup <file>   write the snapshot to file
+func backupCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: backup [file]")
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+		err = database.Backup(db, path)
+	} else {
+		var backup *database.BackupInfo
+		if backup, err = database.BackupToDir(db, backupDir()); err == nil {
+			path = filepath.Join(backupDir(), backup.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Backed up database to %s\n", path)
+	return nil
+}
+
+// restoreCommand replaces the SQLite database with a validated backup and
+// migrates it to the current schema. Stop the server first.
+//
+//	restore <file>
+func restoreCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <file>")
+	}
+
+	dsn := databaseDSN()
+	if err := database.Restore(dsn, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s; the previous database was kept as %s.before-restore\n", args[0], dsn)
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+
+	version, err := database.Version(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema is at version %d\n", version)
+	return nil
+}
+
+// syncNotesCommand syncs daily notes once, using the NOTES_* settings:
+//
+//	sync-notes          sync the vault in NOTES_DIR
+//	sync-notes <dir>    sync the vault in dir
+func syncNotesCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: sync-notes [dir]")
+	}
+	if len(args) == 1 {
+		os.Setenv("NOTES_DIR", args[0])
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if database.DialectOf(db) != database.SQLite {
+		return fmt.Errorf("notes sync requires SQLite")
+	}
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+
+	syncer, err := notesSyncer(db)
+	if err != nil {
+		return err
+	}
+	if syncer == nil {
+		return fmt.Errorf("no notes directory: set NOTES_DIR or pass one")
+	}
+
+	result, err := syncer.Sync()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Read %d notes, wrote %d; %d completed, %d uncompleted, %d conflicts\n",
+		result.Notes, result.Written, result.Completed, result.Uncompleted, result.Conflicts)
+	return nil
+}
+
+// todoCommand bridges todo.txt, for personal habits or with --team <id> a
+// team's habits:
+//
+//	todo export [file]  write the habits due today as todo.txt tasks (default stdout)
+//	todo import <file>  complete habits from the "x" tasks of a done.txt file
+func todoCommand(args []string) error {
+	teamID := 0
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--team" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return fmt.Errorf("usage: --team <id>")
+		}
+		id, err := strconv.Atoi(args[i+1])
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid team ID %q", args[i+1])
+		}
+		teamID = id
+		i++
+	}
+	if len(rest) == 0 || len(rest) > 2 || (rest[0] == "import" && len(rest) != 2) {
+		return fmt.Errorf("usage: todo export [file] | todo import <file> [--team <id>]")
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if database.DialectOf(db) != database.SQLite {
+		return fmt.Errorf("todo.txt requires SQLite")
+	}
+	if err := database.Migrate(db); err != nil {
+		return err
+	}
+
+	team := ""
+	var habits []models.Habit
+	if teamID != 0 {
+		t, err := models.GetTeam(db, teamID)
+		if err != nil {
+			return fmt.Errorf("team %d: %w", teamID, err)
+		}
+		team = t.Name
+		habits, err = models.GetTeamHabits(db, teamID)
+	} else {
+		habits, err = models.GetPersonalHabits(db)
+	}
+	if err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	switch rest[0] {
+	case "export":
+		out := os.Stdout
+		if len(rest) == 2 {
+			if out, err = os.Create(rest[1]); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		return todotxt.Write(out, habits, team, today)
+	case "import":
+		file, err := os.Open(rest[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		tasks, err := todotxt.ParseDone(file, today)
+		if err != nil {
+			return err
+		}
+		result, err := todotxt.Import(db, tasks, habits, 0, today)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range result.Unmatched {
+			fmt.Printf("line %d: %s (%s)\n", u.Line, u.Text, u.Reason)
+		}
+		fmt.Printf("Completed %d habits, %d already done, %d unmatched\n", result.Completed, result.AlreadyDone, len(result.Unmatched))
+		return nil
+	default:
+		return fmt.Errorf("unknown todo action %q (available: export, import)", rest[0])
+	}
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup file names are habits-YYYYMMDD-HHMMSS.db so they sort by age
+const (
+	backupPrefix     = "habits-"
+	backupSuffix     = ".db"
+	backupTimeLayout = "20060102-150405"
+)
+
+// ErrBackupExists is returned when a snapshot with the same name exists
+var ErrBackupExists = errors.New("backup already exists")
+
+// BackupInfo describes a backup file
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupDir returns the default backup directory for a SQLite database file
+func BackupDir(dsn string) string {
+	return filepath.Join(filepath.Dir(dsn), "backups")
+}
+
+// Backup writes a consistent snapshot of a live SQLite database to path
+// using VACUUM INTO, which reads inside a single transaction so concurrent
+// writes are neither blocked for long nor half-copied.
+func Backup(db *sql.DB, path string) error {
+	if DialectOf(db) != SQLite {
+		return fmt.Errorf("online backups are only supported for SQLite; use pg_dump for PostgreSQL")
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return ErrBackupExists
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// BackupToDir writes a timestamped snapshot into dir
+func BackupToDir(db *sql.DB, dir string) (*BackupInfo, error) {
+	now := time.Now().UTC()
+	name := backupPrefix + now.Format(backupTimeLayout) + backupSuffix
+	path := filepath.Join(dir, name)
+	if err := Backup(db, path); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupInfo{Name: name, Size: stat.Size(), CreatedAt: now}, nil
+}
+
+// ListBackups returns the snapshots in dir, newest first
+func ListBackups(dir string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+		if err != nil {
+			continue // Not one of ours
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, BackupInfo{Name: name, Size: info.Size(), CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// RotateBackups deletes all but the newest keep snapshots in dir
+func RotateBackups(dir string, keep int) error {
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i].Name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ScheduleBackups snapshots db into dir every interval, keeping the newest
+// keep snapshots. It runs until the process exits; failures are logged.
+func ScheduleBackups(db *sql.DB, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			info, err := BackupToDir(db, dir)
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Backed up database to %s", filepath.Join(dir, info.Name))
+
+			if err := RotateBackups(dir, keep); err != nil {
+				log.Printf("Rotating backups failed: %v", err)
+			}
+		}
+	}()
+}
+
+// ValidateBackup checks that path is an intact SQLite database with a schema
+// this build can migrate, returning its schema version
+func ValidateBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%s is not a SQLite database: %v", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s failed the integrity check: %s", path, result)
+	}
+
+	for _, table := range []string{"schema_version", "habits", "habit_completions", "habit_streaks"} {
+		exists, err := tableExists(db, SQLite, table)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("%s is not a habits database: table %s is missing", path, table)
+		}
+	}
+
+	migrations, err := LoadMigrations(SQLite)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyChecksums(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// Restore replaces the SQLite database at dsn with the backup at path after
+// validating it. The server must not be running. The replaced database and
+// its write-ahead log are kept next to it with a .before-restore suffix.
+func Restore(dsn, path string) error {
+	if DialectForDSN(dsn) != SQLite {
+		return fmt.Errorf("restore is only supported for SQLite; use pg_restore for PostgreSQL")
+	}
+
+	if _, err := ValidateBackup(path); err != nil {
+		return err
+	}
+
+	// Copy next to the target first so the final swap is a rename
+	staging := dsn + ".restore"
+	if err := copyFile(path, staging); err != nil {
+		os.Remove(staging)
+		return err
+	}
+
+	// Fold the write-ahead log into the database file. If that fails the log
+	// is still kept with the replaced database, which SQLite reads it back
+	// with under its new name.
+	if _, err := os.Stat(dsn); err == nil {
+		checkpoint(dsn)
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(dsn+suffix, dsn+".before-restore"+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			os.Remove(staging)
+			return err
+		}
+	}
+
+	return os.Rename(staging, dsn)
+}
+
+// checkpoint writes the committed transactions in a SQLite database's
+// write-ahead log into the database file and empties the log
+func checkpoint(dsn string) error {
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"regexp"
+)
+
+// consistencyCheck finds rows matching condition in table. Orphans are
+// deleted on repair, or have nullColumn cleared when it is set.
+type consistencyCheck struct {
+	description string
+	table       string
+	condition   string
+	nullColumn  string
+}
+
+// Orphans are checked parents first, so repairing one check does not leave
+// new orphans behind for a check that already ran
+var consistencyChecks = []consistencyCheck{
+	{"team members of missing teams", "team_members", "team_id NOT IN (SELECT id FROM teams)", ""},
+	{"habits of missing teams", "habits", "team_id IS NOT NULL AND team_id NOT IN (SELECT id FROM teams)", ""},
+	{"completions of missing habits", "habit_completions", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"completions by missing members", "habit_completions", "member_id IS NOT NULL AND member_id NOT IN (SELECT id FROM team_members)", "member_id"},
+	{"streaks of missing habits", "habit_streaks", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"challenge participants of missing challenges or habits", "challenge_participants",
+		"challenge_id NOT IN (SELECT id FROM challenges) OR habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"challenge results of missing challenges", "challenge_results", "challenge_id NOT IN (SELECT id FROM challenges)", ""},
+	{"rotations of missing habits", "habit_rotations", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"rotation members of missing habits or members", "rotation_members",
+		"habit_id NOT IN (SELECT id FROM habits) OR member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"chore assignments of missing habits or members", "chore_assignments",
+		"habit_id NOT IN (SELECT id FROM habits) OR member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"activity events of missing teams, habits or completions", "activity_events",
+		"team_id NOT IN (SELECT id FROM teams) OR habit_id NOT IN (SELECT id FROM habits) OR " +
+			"(completion_id IS NOT NULL AND completion_id NOT IN (SELECT id FROM habit_completions))", ""},
+	{"activity events by missing members", "activity_events", "member_id IS NOT NULL AND member_id NOT IN (SELECT id FROM team_members)", "member_id"},
+	{"reactions on missing completions or by missing members", "completion_reactions",
+		"completion_id NOT IN (SELECT id FROM habit_completions) OR member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"comments on missing completions or by missing members", "completion_comments",
+		"completion_id NOT IN (SELECT id FROM habit_completions) OR member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"share links of missing habits", "share_links", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"read markers of missing members", "activity_reads", "member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"calendar feeds of missing members", "calendar_feeds", "member_id IS NOT NULL AND member_id NOT IN (SELECT id FROM team_members)", ""},
+	{"holidays of missing calendars", "holidays", "calendar_id NOT IN (SELECT id FROM holiday_calendars)", ""},
+	{"holiday calendar links of missing habits", "habit_holiday_calendars", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"holiday calendar links of missing calendars", "habit_holiday_calendars", "calendar_id NOT IN (SELECT id FROM holiday_calendars)", ""},
+	{"tag calendar links of missing teams", "tag_holiday_calendars", "team_id IS NOT NULL AND team_id NOT IN (SELECT id FROM teams)", ""},
+	{"tag calendar links of missing calendars", "tag_holiday_calendars", "calendar_id NOT IN (SELECT id FROM holiday_calendars)", ""},
+	{"notes sync state of missing habits", "note_sync_state", "habit_id NOT IN (SELECT id FROM habits)", ""},
+	{"tags of missing habits", "habit_tags", "habit_id NOT IN (SELECT id FROM habits)", ""},
+}
+
+// referencePattern matches the references in a check's condition, capturing
+// the referencing column and the parent table
+var referencePattern = regexp.MustCompile(`(\w+) NOT IN \(SELECT id FROM (\w+)\)`)
+
+// applies reports whether the tables and columns a check reads exist; a
+// database from before their migration lacks them
+func (c consistencyCheck) applies(db querier, d Dialect) (bool, error) {
+	exists, err := tableExists(db, d, c.table)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	for _, ref := range referencePattern.FindAllStringSubmatch(c.condition, -1) {
+		exists, err := columnExists(db, d, c.table, ref[1])
+		if err != nil || !exists {
+			return false, err
+		}
+		if exists, err = tableExists(db, d, ref[2]); err != nil || !exists {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Inconsistency is a problem found by CheckConsistency
+type Inconsistency struct {
+	Description string
+	Count       int
+	Repaired    bool
+}
+
+// CheckConsistency looks for orphaned rows and habits without a streak
+// record. With repair set, orphans are deleted (or their optional reference
+// cleared) and missing streak records are created, all in one transaction.
+// Checks over tables or columns the database does not have yet are skipped,
+// so a database can be repaired before it is migrated.
+func CheckConsistency(db *sql.DB, repair bool) ([]Inconsistency, error) {
+	d := DialectOf(db)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var found []Inconsistency
+	for _, check := range consistencyChecks {
+		applies, err := check.applies(tx, d)
+		if err != nil {
+			return nil, err
+		}
+		if !applies {
+			continue
+		}
+
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + check.table + " WHERE " + check.condition).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		if repair {
+			statement := "DELETE FROM " + check.table + " WHERE " + check.condition
+			if check.nullColumn != "" {
+				statement = "UPDATE " + check.table + " SET " + check.nullColumn + " = NULL WHERE " + check.condition
+			}
+			if _, err := tx.Exec(statement); err != nil {
+				return nil, err
+			}
+		}
+		found = append(found, Inconsistency{Description: check.description, Count: count, Repaired: repair})
+	}
+
+	// Every habit needs a streak record for completions to be counted
+	const missingStreak = "id NOT IN (SELECT habit_id FROM habit_streaks)"
+	streaks := true
+	for _, table := range []string{"habits", "habit_streaks"} {
+		exists, err := tableExists(tx, d, table)
+		if err != nil {
+			return nil, err
+		}
+		streaks = streaks && exists
+	}
+	var count int
+	if streaks {
+		if err := tx.QueryRow("SELECT COUNT(*) FROM habits WHERE " + missingStreak).Scan(&count); err != nil {
+			return nil, err
+		}
+	}
+	if count > 0 {
+		if repair {
+			_, err := tx.Exec("INSERT INTO habit_streaks (habit_id, current_streak, longest_streak) SELECT id, 0, 0 FROM habits WHERE " + missingStreak)
+			if err != nil {
+				return nil, err
+			}
+		}
+		found = append(found, Inconsistency{Description: "habits without a streak record", Count: count, Repaired: repair})
+	}
+
+	if !repair {
+		return found, nil
+	}
+	return found, tx.Commit()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Dialect identifies the SQL flavour of a database connection
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DialectOf returns the dialect of an open database
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+// DialectForDSN returns the dialect selected by a DSN. postgres:// and
+// postgresql:// URLs select Postgres; anything else is a SQLite file path.
+func DialectForDSN(dsn string) Dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// Open opens the database selected by dsn and checks the connection
+func Open(dsn string) (*sql.DB, error) {
+	driver := "sqlite3"
+	if DialectForDSN(dsn) == Postgres {
+		driver = "postgres"
+	} else {
+		// Ensure database directory exists
+		os.MkdirAll(filepath.Dir(dsn), 0755)
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	maxOpen := sqliteMaxOpenConns
+	if driver == "postgres" {
+		maxOpen = postgresMaxOpenConns
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxOpen)
+	db.SetConnMaxIdleTime(maxIdleTime)
+
+	// Test database connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	return db, nil
+}
+
+// sqliteDSN adds the connection options every SQLite connection needs:
+//   - foreign keys, which SQLite only enforces when asked to, per connection
+//   - WAL journaling, so readers are not blocked by a writer
+//   - a busy timeout, so concurrent writers wait instead of failing
+//   - immediate transactions, so a transaction that reads before writing
+//     cannot deadlock upgrading its lock
+func sqliteDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate&_synchronous=NORMAL"
+}
+
+// Connection pool settings. SQLite serializes writers, so a small pool is
+// enough and keeps lock contention low; Postgres gets a larger one.
+const (
+	sqliteMaxOpenConns   = 4
+	postgresMaxOpenConns = 20
+	maxIdleTime          = 5 * time.Minute
+)
+
+// Rebind rewrites ? placeholders into the dialect's placeholder syntax.
+// Question marks inside quoted strings are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// Today is an expression for the current date. Dates are UTC on every
+// dialect, matching SQLite's DATE().
+func (d Dialect) Today() string {
+	if d == Postgres {
+		return "(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date"
+	}
+	return "DATE('now')"
+}
+
+// DaysAgo is an expression for the date n days before today
+func (d Dialect) DaysAgo(n int) string {
+	if d == Postgres {
+		return fmt.Sprintf("(%s - %d)", d.Today(), n)
+	}
+	return fmt.Sprintf("DATE('now', '-%d days')", n)
+}
+
+// Date is an expression for the UTC calendar date of a timestamp expression
+func (d Dialect) Date(expr string) string {
+	if d == Postgres {
+		return "(" + expr + " AT TIME ZONE 'UTC')::date"
+	}
+	return "DATE(" + expr + ")"
+}
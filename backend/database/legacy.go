@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx, so the schema helpers
+// can run inside the transaction that creates schema_version
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// upgradeLegacySchema prepares a database created before schema_version
+// existed. Its tables were created with CREATE TABLE IF NOT EXISTS, so the
+// initial migration will fill in missing tables but not columns added to
+// existing tables later; those are added here.
+func upgradeLegacySchema(tx *sql.Tx) error {
+	legacy, err := tableExists(tx, SQLite, "habits")
+	if err != nil || !legacy {
+		return err
+	}
+
+	columns := []struct{ table, column, definition string }{
+		{"habits", "team_id", "INTEGER REFERENCES teams(id)"},
+		{"habit_completions", "member_id", "INTEGER REFERENCES team_members(id)"},
+	}
+
+	for _, c := range columns {
+		if err := ensureColumn(tx, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", c.table, c.column, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to a table if the table exists without it
+func ensureColumn(db querier, table, column, definition string) error {
+	exists, err := tableExists(db, SQLite, table)
+	if err != nil || !exists {
+		return err
+	}
+
+	has, err := hasColumn(db, table, column)
+	if err != nil || has {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// hasColumn reports whether a table has a column
+func hasColumn(db querier, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// tableExists reports whether a table exists in a database of dialect d
+func tableExists(db querier, d Dialect, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if d == Postgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	}
+
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+// columnExists reports whether a table has a column
+func columnExists(db querier, d Dialect, table, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	if d == Postgres {
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2"
+	}
+
+	var count int
+	err := db.QueryRow(query, table, column).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,461 @@
+// Package database opens the SQLite or Postgres database and manages its
+// schema through versioned migrations.
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFS embed.FS
+
+// Migration is a single versioned schema change loaded from
+// migrations/<dialect>/NNNN_name.up.sql and its optional NNNN_name.down.sql
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the embedded migrations for a dialect ordered by version
+func LoadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + string(dialect)
+	files, err := fs.Glob(migrationFS, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, dir+"/")
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(stem, "_")
+		if !found {
+			return nil, fmt.Errorf("migration %s must be named NNNN_name.%s.sql", base, direction)
+		}
+
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has an invalid version", base)
+		}
+
+		content, err := migrationFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies all pending migrations
+func Migrate(db *sql.DB) error {
+	migrations, err := LoadMigrations(DialectOf(db))
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	return MigrateTo(db, migrations[len(migrations)-1].Version)
+}
+
+// MigrateTo migrates the schema up or down to the given version. Version 0
+// rolls back every migration.
+func MigrateTo(db *sql.DB, target int) error {
+	migrations, err := LoadMigrations(DialectOf(db))
+	if err != nil {
+		return err
+	}
+
+	if err := ensureVersionTable(db); err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyChecksums(migrations, applied); err != nil {
+		return err
+	}
+
+	known := make(map[int]bool)
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	if target != 0 && !known[target] {
+		return fmt.Errorf("unknown migration version %d", target)
+	}
+
+	// Apply pending migrations up to the target in order
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+	}
+
+	// Roll back applied migrations above the target, newest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := revertMigration(db, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback reverts the most recent steps applied migrations
+func Rollback(db *sql.DB, steps int) error {
+	status, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	var applied []int
+	for _, s := range status {
+		if s.Applied {
+			applied = append(applied, s.Version)
+		}
+	}
+
+	if steps > len(applied) {
+		steps = len(applied)
+	}
+
+	target := 0
+	if steps < len(applied) {
+		target = applied[len(applied)-1-steps]
+	}
+
+	return MigrateTo(db, target)
+}
+
+// Status lists every known migration and whether it has been applied
+func Status(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureVersionTable(db); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+// Version returns the highest applied migration version, or 0 if none
+func Version(db *sql.DB) (int, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// ensureVersionTable creates schema_version if it does not exist, after
+// upgrading a SQLite database that predates it. Both are committed together,
+// so a failed upgrade is retried on the next run instead of being skipped.
+func ensureVersionTable(db *sql.DB) error {
+	d := DialectOf(db)
+	exists, err := tableExists(db, d, "schema_version")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only SQLite databases predate migrations
+	if d == SQLite {
+		if err := upgradeLegacySchema(tx); err != nil {
+			return err
+		}
+	}
+
+	timestamp := "DATETIME"
+	if d == Postgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func appliedMigrations(db *sql.DB) (map[int]appliedMigration, error) {
+	rows, err := db.Query("SELECT version, checksum, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+// verifyChecksums fails if an applied migration was edited afterwards or is
+// missing from this build, since the schema would no longer match the code
+func verifyChecksums(migrations []Migration, applied map[int]appliedMigration) error {
+	byVersion := make(map[int]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	for version, a := range applied {
+		m, ok := byVersion[version]
+		if !ok {
+			return fmt.Errorf("database has migration %d applied, which this build does not know about", version)
+		}
+		if m.Checksum != a.checksum {
+			return fmt.Errorf("migration %d (%s) has been modified since it was applied", m.Version, m.Name)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, m Migration) error {
+	err := migrationTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+
+		_, err := tx.Exec(DialectOf(db).Rebind("INSERT INTO schema_version (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+			m.Version, m.Name, m.Checksum, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Progress goes to stderr, keeping stdout for commands' output
+	fmt.Fprintf(os.Stderr, "Applied migration %04d_%s\n", m.Version, m.Name)
+	return nil
+}
+
+func revertMigration(db *sql.DB, m Migration) error {
+	if m.Down == "" {
+		return fmt.Errorf("migration %d (%s) cannot be reverted: no down script", m.Version, m.Name)
+	}
+
+	err := migrationTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+
+		_, err := tx.Exec(DialectOf(db).Rebind("DELETE FROM schema_version WHERE version = ?"), m.Version)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Reverted migration %04d_%s\n", m.Version, m.Name)
+	return nil
+}
+
+// migrationTx runs fn in a transaction. On SQLite, foreign key enforcement
+// is switched off for the connection while the migration runs, so tables can
+// be rebuilt, and the result is checked with foreign_key_check before commit.
+// Only violations the migration adds fail it: older databases may hold
+// orphans from before enforcement, which 0003_cascade_deletes removes.
+func migrationTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sqlite := DialectOf(db) == SQLite
+	if sqlite {
+		// The pragma is a no-op inside a transaction, so set it first
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before map[foreignKey]int
+	if sqlite {
+		if before, err = foreignKeyViolations(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if sqlite {
+		after, err := foreignKeyViolations(tx)
+		if err != nil {
+			return err
+		}
+		for fk, count := range after {
+			if count > before[fk] {
+				return fmt.Errorf("migration leaves a %s row referencing a missing %s row", fk.table, fk.parent)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// foreignKey is a reference from a table to a parent table
+type foreignKey struct {
+	table, parent string
+}
+
+// foreignKeyViolations counts the SQLite rows referencing a missing parent
+// row, per table and parent. Counts rather than rows are compared, as
+// rebuilding a table may change its rowids.
+func foreignKeyViolations(tx *sql.Tx) (map[foreignKey]int, error) {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	violations := make(map[foreignKey]int)
+	for rows.Next() {
+		var fk foreignKey
+		var rowID sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&fk.table, &rowID, &fk.parent, &fkid); err != nil {
+			return nil, err
+		}
+		violations[fk]++
+	}
+
+	return violations, rows.Err()
+}
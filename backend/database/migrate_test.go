@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// legacySchema is a database from before schema_version existed: habits
+// without teams, holding orphans written while foreign keys were off
+const legacySchema = `
+CREATE TABLE habits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    frequency TEXT NOT NULL,
+    target_count INTEGER DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE habit_completions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    completed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+CREATE TABLE habit_streaks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    current_streak INTEGER DEFAULT 0,
+    longest_streak INTEGER DEFAULT 0,
+    last_completion_date DATE,
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+INSERT INTO habits (id, name, frequency) VALUES (1, 'Read', 'daily');
+INSERT INTO habit_completions (habit_id, completed_at) VALUES (1, '2024-01-01 08:00:00');
+INSERT INTO habit_completions (habit_id, completed_at) VALUES (99, '2024-01-01 09:00:00');
+INSERT INTO habit_streaks (habit_id, current_streak, longest_streak) VALUES (1, 1, 1);
+INSERT INTO habit_streaks (habit_id, current_streak, longest_streak) VALUES (99, 3, 3);
+`
+
+// openLegacyDB writes the legacy fixture and opens it as the server would
+func openLegacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "habits.db")
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(legacySchema); err != nil {
+		t.Fatalf("write legacy fixture: %v", err)
+	}
+	raw.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestMigrateLegacyWithOrphans(t *testing.T) {
+	db := openLegacyDB(t)
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	migrations, err := LoadMigrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := Version(db)
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if want := migrations[len(migrations)-1].Version; version != want {
+		t.Errorf("version = %d, want %d", version, want)
+	}
+
+	// The cascade migration removed the orphans and kept the rest
+	if n := count(t, db, "SELECT COUNT(*) FROM habit_completions"); n != 1 {
+		t.Errorf("%d completions after migrating, want the habit's one", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM habit_streaks"); n != 1 {
+		t.Errorf("%d streaks after migrating, want the habit's one", n)
+	}
+}
+
+func TestRepairLegacyBeforeMigrating(t *testing.T) {
+	db := openLegacyDB(t)
+
+	problems, err := CheckConsistency(db, true)
+	if err != nil {
+		t.Fatalf("CheckConsistency on the legacy schema: %v", err)
+	}
+	repaired := make(map[string]int)
+	for _, p := range problems {
+		if !p.Repaired {
+			t.Errorf("%q not repaired", p.Description)
+		}
+		repaired[p.Description] = p.Count
+	}
+	if repaired["completions of missing habits"] != 1 || repaired["streaks of missing habits"] != 1 || len(repaired) != 2 {
+		t.Errorf("repaired %v, want the orphaned completion and streak", repaired)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate after repair: %v", err)
+	}
+	if problems, err := CheckConsistency(db, false); err != nil || len(problems) != 0 {
+		t.Errorf("CheckConsistency after migrating = %v, %v; want no problems", problems, err)
+	}
+}
+
+func TestMigrationAddingOrphansFails(t *testing.T) {
+	db := openLegacyDB(t)
+
+	err := migrationTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO habit_streaks (habit_id) VALUES (100)")
+		return err
+	})
+	if err == nil {
+		t.Fatal("migration adding an orphan succeeded, want a foreign key error")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM habit_streaks WHERE habit_id = 100"); n != 0 {
+		t.Errorf("failed migration left %d rows behind", n)
+	}
+}
@@ -0,0 +1,17 @@
+-- Drop the initial schema, dependents first
+DROP TABLE IF EXISTS activity_reads;
+DROP TABLE IF EXISTS share_links;
+DROP TABLE IF EXISTS completion_comments;
+DROP TABLE IF EXISTS completion_reactions;
+DROP TABLE IF EXISTS activity_events;
+DROP TABLE IF EXISTS chore_assignments;
+DROP TABLE IF EXISTS rotation_members;
+DROP TABLE IF EXISTS habit_rotations;
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS challenge_results;
+DROP TABLE IF EXISTS challenge_participants;
+DROP TABLE IF EXISTS challenges;
+DROP TABLE IF EXISTS habit_streaks;
+DROP TABLE IF EXISTS habit_completions;
+DROP TABLE IF EXISTS habits;
@@ -0,0 +1,159 @@
+-- Initial schema: habits, challenges, teams, chore rotation, activity and share links
+
+CREATE TABLE IF NOT EXISTS teams (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    id SERIAL PRIMARY KEY,
+    team_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+);
+
+CREATE TABLE IF NOT EXISTS habits (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT,
+    frequency TEXT NOT NULL,
+    target_count INTEGER DEFAULT 1,
+    team_id INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+);
+
+CREATE TABLE IF NOT EXISTS habit_completions (
+    id SERIAL PRIMARY KEY,
+    habit_id INTEGER NOT NULL,
+    member_id INTEGER,
+    completed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (habit_id) REFERENCES habits(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS habit_streaks (
+    id SERIAL PRIMARY KEY,
+    habit_id INTEGER NOT NULL,
+    current_streak INTEGER DEFAULT 0,
+    longest_streak INTEGER DEFAULT 0,
+    last_completion_date DATE,
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+
+CREATE TABLE IF NOT EXISTS challenges (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT,
+    frequency TEXT NOT NULL,
+    target_count INTEGER DEFAULT 1,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    id SERIAL PRIMARY KEY,
+    challenge_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    habit_id INTEGER NOT NULL,
+    joined_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(id),
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+
+CREATE TABLE IF NOT EXISTS challenge_results (
+    id SERIAL PRIMARY KEY,
+    challenge_id INTEGER NOT NULL,
+    rank INTEGER NOT NULL,
+    participant_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    habit_id INTEGER NOT NULL,
+    completions INTEGER DEFAULT 0,
+    completion_rate DOUBLE PRECISION DEFAULT 0,
+    current_streak INTEGER DEFAULT 0,
+    longest_streak INTEGER DEFAULT 0,
+    frozen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(id)
+);
+
+CREATE TABLE IF NOT EXISTS habit_rotations (
+    habit_id INTEGER PRIMARY KEY,
+    strategy TEXT NOT NULL DEFAULT 'round_robin',
+    start_date DATE NOT NULL,
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+
+CREATE TABLE IF NOT EXISTS rotation_members (
+    id SERIAL PRIMARY KEY,
+    habit_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    FOREIGN KEY (habit_id) REFERENCES habits(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS chore_assignments (
+    id SERIAL PRIMARY KEY,
+    habit_id INTEGER NOT NULL,
+    period_start DATE NOT NULL,
+    member_id INTEGER NOT NULL,
+    UNIQUE (habit_id, period_start),
+    FOREIGN KEY (habit_id) REFERENCES habits(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_events (
+    id SERIAL PRIMARY KEY,
+    team_id INTEGER NOT NULL,
+    habit_id INTEGER NOT NULL,
+    completion_id INTEGER,
+    member_id INTEGER,
+    type TEXT NOT NULL,
+    data TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id),
+    FOREIGN KEY (habit_id) REFERENCES habits(id),
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS completion_reactions (
+    id SERIAL PRIMARY KEY,
+    completion_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (completion_id, member_id, emoji),
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS completion_comments (
+    id SERIAL PRIMARY KEY,
+    completion_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id),
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
+
+CREATE TABLE IF NOT EXISTS share_links (
+    id SERIAL PRIMARY KEY,
+    habit_id INTEGER NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMPTZ,
+    FOREIGN KEY (habit_id) REFERENCES habits(id)
+);
+
+CREATE TABLE IF NOT EXISTS activity_reads (
+    member_id INTEGER PRIMARY KEY,
+    last_read_event_id INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (member_id) REFERENCES team_members(id)
+);
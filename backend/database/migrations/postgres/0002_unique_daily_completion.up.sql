@@ -0,0 +1,19 @@
+-- At most one completion per habit per (UTC) day
+
+-- Remove duplicate completions left by concurrent requests, keeping the first
+DELETE FROM completion_reactions WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, ((completed_at AT TIME ZONE 'UTC')::date))
+);
+DELETE FROM completion_comments WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, ((completed_at AT TIME ZONE 'UTC')::date))
+);
+DELETE FROM activity_events WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, ((completed_at AT TIME ZONE 'UTC')::date))
+);
+DELETE FROM habit_completions
+WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, ((completed_at AT TIME ZONE 'UTC')::date));
+
+CREATE UNIQUE INDEX idx_habit_completions_daily ON habit_completions (habit_id, ((completed_at AT TIME ZONE 'UTC')::date));
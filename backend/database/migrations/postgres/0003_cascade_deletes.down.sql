@@ -0,0 +1,48 @@
+-- Restore foreign keys without delete actions
+
+ALTER TABLE habits DROP CONSTRAINT habits_team_id_fkey,
+    ADD CONSTRAINT habits_team_id_fkey FOREIGN KEY (team_id) REFERENCES teams(id);
+ALTER TABLE habit_completions DROP CONSTRAINT habit_completions_habit_id_fkey,
+    ADD CONSTRAINT habit_completions_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE habit_completions DROP CONSTRAINT habit_completions_member_id_fkey,
+    ADD CONSTRAINT habit_completions_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE habit_streaks DROP CONSTRAINT habit_streaks_habit_id_fkey,
+    ADD CONSTRAINT habit_streaks_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE challenge_participants DROP CONSTRAINT challenge_participants_challenge_id_fkey,
+    ADD CONSTRAINT challenge_participants_challenge_id_fkey FOREIGN KEY (challenge_id) REFERENCES challenges(id);
+ALTER TABLE challenge_participants DROP CONSTRAINT challenge_participants_habit_id_fkey,
+    ADD CONSTRAINT challenge_participants_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE challenge_results DROP CONSTRAINT challenge_results_challenge_id_fkey,
+    ADD CONSTRAINT challenge_results_challenge_id_fkey FOREIGN KEY (challenge_id) REFERENCES challenges(id);
+ALTER TABLE team_members DROP CONSTRAINT team_members_team_id_fkey,
+    ADD CONSTRAINT team_members_team_id_fkey FOREIGN KEY (team_id) REFERENCES teams(id);
+ALTER TABLE habit_rotations DROP CONSTRAINT habit_rotations_habit_id_fkey,
+    ADD CONSTRAINT habit_rotations_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE rotation_members DROP CONSTRAINT rotation_members_habit_id_fkey,
+    ADD CONSTRAINT rotation_members_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE rotation_members DROP CONSTRAINT rotation_members_member_id_fkey,
+    ADD CONSTRAINT rotation_members_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE chore_assignments DROP CONSTRAINT chore_assignments_habit_id_fkey,
+    ADD CONSTRAINT chore_assignments_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE chore_assignments DROP CONSTRAINT chore_assignments_member_id_fkey,
+    ADD CONSTRAINT chore_assignments_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE activity_events DROP CONSTRAINT activity_events_team_id_fkey,
+    ADD CONSTRAINT activity_events_team_id_fkey FOREIGN KEY (team_id) REFERENCES teams(id);
+ALTER TABLE activity_events DROP CONSTRAINT activity_events_habit_id_fkey,
+    ADD CONSTRAINT activity_events_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE activity_events DROP CONSTRAINT activity_events_completion_id_fkey,
+    ADD CONSTRAINT activity_events_completion_id_fkey FOREIGN KEY (completion_id) REFERENCES habit_completions(id);
+ALTER TABLE activity_events DROP CONSTRAINT activity_events_member_id_fkey,
+    ADD CONSTRAINT activity_events_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE completion_reactions DROP CONSTRAINT completion_reactions_completion_id_fkey,
+    ADD CONSTRAINT completion_reactions_completion_id_fkey FOREIGN KEY (completion_id) REFERENCES habit_completions(id);
+ALTER TABLE completion_reactions DROP CONSTRAINT completion_reactions_member_id_fkey,
+    ADD CONSTRAINT completion_reactions_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE completion_comments DROP CONSTRAINT completion_comments_completion_id_fkey,
+    ADD CONSTRAINT completion_comments_completion_id_fkey FOREIGN KEY (completion_id) REFERENCES habit_completions(id);
+ALTER TABLE completion_comments DROP CONSTRAINT completion_comments_member_id_fkey,
+    ADD CONSTRAINT completion_comments_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
+ALTER TABLE share_links DROP CONSTRAINT share_links_habit_id_fkey,
+    ADD CONSTRAINT share_links_habit_id_fkey FOREIGN KEY (habit_id) REFERENCES habits(id);
+ALTER TABLE activity_reads DROP CONSTRAINT activity_reads_member_id_fkey,
+    ADD CONSTRAINT activity_reads_member_id_fkey FOREIGN KEY (member_id) REFERENCES team_members(id);
@@ -0,0 +1,13 @@
+-- Token-protected iCalendar subscriptions: personal feeds (no member) cover
+-- personal habits, member feeds cover the habits of the member's team
+
+CREATE TABLE calendar_feeds (
+    id SERIAL PRIMARY KEY,
+    member_id INTEGER,
+    token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMPTZ,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_calendar_feeds_member ON calendar_feeds (member_id);
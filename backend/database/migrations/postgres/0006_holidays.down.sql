@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_habit_holiday_calendars_calendar;
+DROP TABLE IF EXISTS habit_holiday_calendars;
+DROP TABLE IF EXISTS holidays;
+DROP TABLE IF EXISTS holiday_calendars;
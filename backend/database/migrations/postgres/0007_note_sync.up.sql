@@ -0,0 +1,11 @@
+-- Daily-notes sync: whether each habit was checked on each day as of the
+-- last sync, so a later sync can tell which side changed
+
+CREATE TABLE note_sync_state (
+    habit_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    checked BOOLEAN NOT NULL,
+    synced_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (habit_id, day),
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- Completions record an optional quantity and note, and habits carry tags
+-- that group them in reports
+
+ALTER TABLE habit_completions ADD COLUMN value DOUBLE PRECISION;
+ALTER TABLE habit_completions ADD COLUMN note TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE habit_tags (
+    habit_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (habit_id, tag),
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_habit_tags_tag ON habit_tags (tag);
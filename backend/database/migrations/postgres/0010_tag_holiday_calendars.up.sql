@@ -0,0 +1,14 @@
+-- Holiday calendars attached to a tag apply to every habit with the tag:
+-- the personal habits when team_id is NULL, or the team's
+
+CREATE TABLE tag_holiday_calendars (
+    id SERIAL PRIMARY KEY,
+    team_id INTEGER,
+    tag TEXT NOT NULL,
+    calendar_id INTEGER NOT NULL,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+    FOREIGN KEY (calendar_id) REFERENCES holiday_calendars(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_tag_holiday_calendars_tag ON tag_holiday_calendars (COALESCE(team_id, 0), tag, calendar_id);
+CREATE INDEX idx_tag_holiday_calendars_calendar ON tag_holiday_calendars (calendar_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_habit_completions_daily;
@@ -0,0 +1,19 @@
+-- At most one completion per habit per (UTC) day
+
+-- Remove duplicate completions left by concurrent requests, keeping the first
+DELETE FROM completion_reactions WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, DATE(completed_at))
+);
+DELETE FROM completion_comments WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, DATE(completed_at))
+);
+DELETE FROM activity_events WHERE completion_id IN (
+    SELECT id FROM habit_completions
+    WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, DATE(completed_at))
+);
+DELETE FROM habit_completions
+WHERE id NOT IN (SELECT MIN(id) FROM habit_completions GROUP BY habit_id, DATE(completed_at));
+
+CREATE UNIQUE INDEX idx_habit_completions_daily ON habit_completions (habit_id, DATE(completed_at));
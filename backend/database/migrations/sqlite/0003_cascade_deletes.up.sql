@@ -0,0 +1,207 @@
+-- Cascade deletes along foreign keys. SQLite cannot alter a constraint, so
+-- each referencing table is rebuilt.
+
+-- Remove rows orphaned while foreign keys were not enforced, so the rebuilt
+-- tables satisfy their constraints
+DELETE FROM team_members WHERE team_id NOT IN (SELECT id FROM teams);
+DELETE FROM habits WHERE team_id IS NOT NULL AND team_id NOT IN (SELECT id FROM teams);
+DELETE FROM habit_completions WHERE habit_id NOT IN (SELECT id FROM habits);
+UPDATE habit_completions SET member_id = NULL WHERE member_id IS NOT NULL AND member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM habit_streaks WHERE habit_id NOT IN (SELECT id FROM habits);
+DELETE FROM challenge_participants WHERE challenge_id NOT IN (SELECT id FROM challenges) OR habit_id NOT IN (SELECT id FROM habits);
+DELETE FROM challenge_results WHERE challenge_id NOT IN (SELECT id FROM challenges);
+DELETE FROM habit_rotations WHERE habit_id NOT IN (SELECT id FROM habits);
+DELETE FROM rotation_members WHERE habit_id NOT IN (SELECT id FROM habits) OR member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM chore_assignments WHERE habit_id NOT IN (SELECT id FROM habits) OR member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM activity_events WHERE team_id NOT IN (SELECT id FROM teams) OR habit_id NOT IN (SELECT id FROM habits)
+    OR (completion_id IS NOT NULL AND completion_id NOT IN (SELECT id FROM habit_completions));
+UPDATE activity_events SET member_id = NULL WHERE member_id IS NOT NULL AND member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM completion_reactions WHERE completion_id NOT IN (SELECT id FROM habit_completions) OR member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM completion_comments WHERE completion_id NOT IN (SELECT id FROM habit_completions) OR member_id NOT IN (SELECT id FROM team_members);
+DELETE FROM share_links WHERE habit_id NOT IN (SELECT id FROM habits);
+DELETE FROM activity_reads WHERE member_id NOT IN (SELECT id FROM team_members);
+
+CREATE TABLE habits_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    frequency TEXT NOT NULL,
+    target_count INTEGER DEFAULT 1,
+    team_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+);
+INSERT INTO habits_new (id, name, description, frequency, target_count, team_id, created_at, updated_at) SELECT id, name, description, frequency, target_count, team_id, created_at, updated_at FROM habits;
+DROP TABLE habits;
+ALTER TABLE habits_new RENAME TO habits;
+
+CREATE TABLE habit_completions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    member_id INTEGER,
+    completed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE SET NULL
+);
+INSERT INTO habit_completions_new (id, habit_id, member_id, completed_at) SELECT id, habit_id, member_id, completed_at FROM habit_completions;
+DROP TABLE habit_completions;
+ALTER TABLE habit_completions_new RENAME TO habit_completions;
+
+CREATE TABLE habit_streaks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    current_streak INTEGER DEFAULT 0,
+    longest_streak INTEGER DEFAULT 0,
+    last_completion_date DATE,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+INSERT INTO habit_streaks_new (id, habit_id, current_streak, longest_streak, last_completion_date) SELECT id, habit_id, current_streak, longest_streak, last_completion_date FROM habit_streaks;
+DROP TABLE habit_streaks;
+ALTER TABLE habit_streaks_new RENAME TO habit_streaks;
+
+CREATE TABLE challenge_participants_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    challenge_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    habit_id INTEGER NOT NULL,
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+INSERT INTO challenge_participants_new (id, challenge_id, name, habit_id, joined_at) SELECT id, challenge_id, name, habit_id, joined_at FROM challenge_participants;
+DROP TABLE challenge_participants;
+ALTER TABLE challenge_participants_new RENAME TO challenge_participants;
+
+CREATE TABLE challenge_results_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    challenge_id INTEGER NOT NULL,
+    rank INTEGER NOT NULL,
+    participant_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    habit_id INTEGER NOT NULL,
+    completions INTEGER DEFAULT 0,
+    completion_rate REAL DEFAULT 0,
+    current_streak INTEGER DEFAULT 0,
+    longest_streak INTEGER DEFAULT 0,
+    frozen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(id) ON DELETE CASCADE
+);
+INSERT INTO challenge_results_new (id, challenge_id, rank, participant_id, name, habit_id, completions, completion_rate, current_streak, longest_streak, frozen_at) SELECT id, challenge_id, rank, participant_id, name, habit_id, completions, completion_rate, current_streak, longest_streak, frozen_at FROM challenge_results;
+DROP TABLE challenge_results;
+ALTER TABLE challenge_results_new RENAME TO challenge_results;
+
+CREATE TABLE team_members_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    team_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+);
+INSERT INTO team_members_new (id, team_id, name, role, created_at) SELECT id, team_id, name, role, created_at FROM team_members;
+DROP TABLE team_members;
+ALTER TABLE team_members_new RENAME TO team_members;
+
+CREATE TABLE habit_rotations_new (
+    habit_id INTEGER PRIMARY KEY,
+    strategy TEXT NOT NULL DEFAULT 'round_robin',
+    start_date DATE NOT NULL,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+INSERT INTO habit_rotations_new (habit_id, strategy, start_date) SELECT habit_id, strategy, start_date FROM habit_rotations;
+DROP TABLE habit_rotations;
+ALTER TABLE habit_rotations_new RENAME TO habit_rotations;
+
+CREATE TABLE rotation_members_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+INSERT INTO rotation_members_new (id, habit_id, member_id, position) SELECT id, habit_id, member_id, position FROM rotation_members;
+DROP TABLE rotation_members;
+ALTER TABLE rotation_members_new RENAME TO rotation_members;
+
+CREATE TABLE chore_assignments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    period_start DATE NOT NULL,
+    member_id INTEGER NOT NULL,
+    UNIQUE (habit_id, period_start),
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+INSERT INTO chore_assignments_new (id, habit_id, period_start, member_id) SELECT id, habit_id, period_start, member_id FROM chore_assignments;
+DROP TABLE chore_assignments;
+ALTER TABLE chore_assignments_new RENAME TO chore_assignments;
+
+CREATE TABLE activity_events_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    team_id INTEGER NOT NULL,
+    habit_id INTEGER NOT NULL,
+    completion_id INTEGER,
+    member_id INTEGER,
+    type TEXT NOT NULL,
+    data TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE SET NULL
+);
+INSERT INTO activity_events_new (id, team_id, habit_id, completion_id, member_id, type, data, created_at) SELECT id, team_id, habit_id, completion_id, member_id, type, data, created_at FROM activity_events;
+DROP TABLE activity_events;
+ALTER TABLE activity_events_new RENAME TO activity_events;
+
+CREATE TABLE completion_reactions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    completion_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    emoji TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (completion_id, member_id, emoji),
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+INSERT INTO completion_reactions_new (id, completion_id, member_id, emoji, created_at) SELECT id, completion_id, member_id, emoji, created_at FROM completion_reactions;
+DROP TABLE completion_reactions;
+ALTER TABLE completion_reactions_new RENAME TO completion_reactions;
+
+CREATE TABLE completion_comments_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    completion_id INTEGER NOT NULL,
+    member_id INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (completion_id) REFERENCES habit_completions(id) ON DELETE CASCADE,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+INSERT INTO completion_comments_new (id, completion_id, member_id, body, created_at) SELECT id, completion_id, member_id, body, created_at FROM completion_comments;
+DROP TABLE completion_comments;
+ALTER TABLE completion_comments_new RENAME TO completion_comments;
+
+CREATE TABLE share_links_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    habit_id INTEGER NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked_at DATETIME,
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+);
+INSERT INTO share_links_new (id, habit_id, token, created_at, revoked_at) SELECT id, habit_id, token, created_at, revoked_at FROM share_links;
+DROP TABLE share_links;
+ALTER TABLE share_links_new RENAME TO share_links;
+
+CREATE TABLE activity_reads_new (
+    member_id INTEGER PRIMARY KEY,
+    last_read_event_id INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+INSERT INTO activity_reads_new (member_id, last_read_event_id) SELECT member_id, last_read_event_id FROM activity_reads;
+DROP TABLE activity_reads;
+ALTER TABLE activity_reads_new RENAME TO activity_reads;
+
+CREATE UNIQUE INDEX idx_habit_completions_daily ON habit_completions (habit_id, DATE(completed_at));
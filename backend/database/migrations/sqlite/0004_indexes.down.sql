@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_share_links_habit;
+DROP INDEX IF EXISTS idx_completion_comments_completion;
+DROP INDEX IF EXISTS idx_activity_events_completion;
+DROP INDEX IF EXISTS idx_activity_events_habit;
+DROP INDEX IF EXISTS idx_activity_events_team;
+DROP INDEX IF EXISTS idx_rotation_members_habit;
+DROP INDEX IF EXISTS idx_challenge_results_challenge;
+DROP INDEX IF EXISTS idx_challenge_participants_habit;
+DROP INDEX IF EXISTS idx_challenge_participants_challenge;
+DROP INDEX IF EXISTS idx_team_members_team;
+DROP INDEX IF EXISTS idx_habits_team;
+DROP INDEX IF EXISTS idx_habit_streaks_habit;
+DROP INDEX IF EXISTS idx_habit_completions_member;
+DROP INDEX IF EXISTS idx_habit_completions_time;
+DROP INDEX IF EXISTS idx_habit_completions_habit_time;
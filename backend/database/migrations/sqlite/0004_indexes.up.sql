@@ -0,0 +1,23 @@
+-- Indexes for completion date ranges and foreign key lookups
+
+-- Completion times are compared as text, so store them all in UTC. Rows
+-- written with a local offset are rewritten; DATE() already read them as UTC.
+UPDATE habit_completions
+SET completed_at = strftime('%Y-%m-%d %H:%M:%f', completed_at)
+WHERE substr(completed_at, -6) GLOB '[+-][0-9][0-9]:[0-9][0-9]' AND substr(completed_at, -6) != '+00:00';
+
+CREATE INDEX idx_habit_completions_habit_time ON habit_completions (habit_id, completed_at);
+CREATE INDEX idx_habit_completions_time ON habit_completions (completed_at);
+CREATE INDEX idx_habit_completions_member ON habit_completions (member_id);
+CREATE INDEX idx_habit_streaks_habit ON habit_streaks (habit_id);
+CREATE INDEX idx_habits_team ON habits (team_id);
+CREATE INDEX idx_team_members_team ON team_members (team_id);
+CREATE INDEX idx_challenge_participants_challenge ON challenge_participants (challenge_id);
+CREATE INDEX idx_challenge_participants_habit ON challenge_participants (habit_id);
+CREATE INDEX idx_challenge_results_challenge ON challenge_results (challenge_id);
+CREATE INDEX idx_rotation_members_habit ON rotation_members (habit_id);
+CREATE INDEX idx_activity_events_team ON activity_events (team_id, id);
+CREATE INDEX idx_activity_events_habit ON activity_events (habit_id);
+CREATE INDEX idx_activity_events_completion ON activity_events (completion_id);
+CREATE INDEX idx_completion_comments_completion ON completion_comments (completion_id, id);
+CREATE INDEX idx_share_links_habit ON share_links (habit_id);
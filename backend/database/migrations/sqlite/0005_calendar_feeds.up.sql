@@ -0,0 +1,13 @@
+-- Token-protected iCalendar subscriptions: personal feeds (no member) cover
+-- personal habits, member feeds cover the habits of the member's team
+
+CREATE TABLE calendar_feeds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    member_id INTEGER,
+    token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked_at DATETIME,
+    FOREIGN KEY (member_id) REFERENCES team_members(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_calendar_feeds_member ON calendar_feeds (member_id);
@@ -0,0 +1,27 @@
+-- Holiday calendars: dates attached to habits are skip days that do not
+-- break streaks or count against completion rates
+
+CREATE TABLE holiday_calendars (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE holidays (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    calendar_id INTEGER NOT NULL,
+    date DATE NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    UNIQUE (calendar_id, date),
+    FOREIGN KEY (calendar_id) REFERENCES holiday_calendars(id) ON DELETE CASCADE
+);
+
+CREATE TABLE habit_holiday_calendars (
+    habit_id INTEGER NOT NULL,
+    calendar_id INTEGER NOT NULL,
+    PRIMARY KEY (habit_id, calendar_id),
+    FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE,
+    FOREIGN KEY (calendar_id) REFERENCES holiday_calendars(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_habit_holiday_calendars_calendar ON habit_holiday_calendars (calendar_id);
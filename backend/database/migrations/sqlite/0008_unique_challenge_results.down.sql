@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_challenge_results_participant;
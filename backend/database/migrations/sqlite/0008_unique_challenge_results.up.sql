@@ -0,0 +1,15 @@
+-- One frozen result per challenge participant
+
+-- Results were frozen row by row, so a failed or concurrent freeze could
+-- leave duplicates or a partial set. Keep the first row of each duplicate
+-- and drop partial sets, which are frozen again on the next leaderboard view.
+DELETE FROM challenge_results
+WHERE id NOT IN (SELECT MIN(id) FROM challenge_results GROUP BY challenge_id, participant_id);
+DELETE FROM challenge_results
+WHERE challenge_id IN (
+    SELECT r.challenge_id FROM challenge_results r
+    GROUP BY r.challenge_id
+    HAVING COUNT(*) < (SELECT COUNT(*) FROM challenge_participants p WHERE p.challenge_id = r.challenge_id)
+);
+
+CREATE UNIQUE INDEX idx_challenge_results_participant ON challenge_results (challenge_id, participant_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_habit_tags_tag;
+DROP TABLE IF EXISTS habit_tags;
+ALTER TABLE habit_completions DROP COLUMN note;
+ALTER TABLE habit_completions DROP COLUMN value;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tag_holiday_calendars_calendar;
+DROP INDEX IF EXISTS idx_tag_holiday_calendars_tag;
+DROP TABLE IF EXISTS tag_holiday_calendars;
@@ -2,4 +2,6 @@ module habits
 
 go 1.24.3
 
-require github.com/mattn/go-sqlite3 v1.14.32 // indirect
+require github.com/mattn/go-sqlite3 v1.14.32
+
+require github.com/lib/pq v1.9.0
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"habits/models"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	maxCommentLen   = 1000
+)
+
+// FeedHandler returns a page of a team's activity feed with the caller's unread count
+func FeedHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	member, ok := requireTeamRole(w, r, db, teamID, models.RoleMember)
+	if !ok {
+		return
+	}
+
+	before, ok := queryInt(w, r, "before", 0)
+	if !ok {
+		return
+	}
+
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+
+	feed, err := models.GetActivityFeed(db, teamID, member.ID, before, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get activity feed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(feed)
+}
+
+// FeedReadHandler marks a team's activity as read for the caller
+func FeedReadHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	member, ok := requireTeamRole(w, r, db, teamID, models.RoleMember)
+	if !ok {
+		return
+	}
+
+	// An empty body marks everything as read
+	var req struct {
+		EventID int `json:"event_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := models.MarkActivityRead(db, teamID, member.ID, req.EventID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark activity read: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := models.GetUnreadCount(db, teamID, member.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count unread activity: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"unread_count": unread})
+}
+
+// ReactionsHandler handles reactions on a completion at /api/completions/{id}/reactions
+func ReactionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	completionID, habit, member, ok := authorizeCompletion(w, r, db)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		reactions, err := models.GetReactions(db, completionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get reactions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(reactions)
+	case "POST":
+		var reaction models.Reaction
+		if err := json.NewDecoder(r.Body).Decode(&reaction); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		reaction.Emoji = strings.TrimSpace(reaction.Emoji)
+		if reaction.Emoji == "" || utf8.RuneCountInString(reaction.Emoji) > 8 {
+			http.Error(w, "A short emoji is required", http.StatusBadRequest)
+			return
+		}
+
+		reaction.CompletionID = completionID
+		reaction.MemberID = member.ID
+		if err := models.AddReaction(db, habit, &reaction); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to add reaction: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reaction)
+	case "DELETE":
+		emoji := r.URL.Query().Get("emoji")
+		if emoji == "" {
+			http.Error(w, "emoji query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := models.RemoveReaction(db, completionID, member.ID, emoji); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to remove reaction: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":       "Reaction removed successfully",
+			"completion_id": completionID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CommentsHandler handles comments on a completion at /api/completions/{id}/comments
+func CommentsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	completionID, habit, member, ok := authorizeCompletion(w, r, db)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		after, ok := queryInt(w, r, "after", 0)
+		if !ok {
+			return
+		}
+
+		limit, ok := pageSize(w, r)
+		if !ok {
+			return
+		}
+
+		comments, err := models.GetComments(db, completionID, after, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get comments: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(comments)
+	case "POST":
+		var comment models.Comment
+		if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		comment.Body = strings.TrimSpace(comment.Body)
+		if comment.Body == "" {
+			http.Error(w, "Comment body is required", http.StatusBadRequest)
+			return
+		}
+
+		if utf8.RuneCountInString(comment.Body) > maxCommentLen {
+			http.Error(w, fmt.Sprintf("Comment must be at most %d characters", maxCommentLen), http.StatusBadRequest)
+			return
+		}
+
+		comment.CompletionID = completionID
+		comment.MemberID = member.ID
+		comment.MemberName = member.Name
+		if err := models.AddComment(db, habit, &comment); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to add comment: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(comment)
+	case "DELETE":
+		commentID, ok := pathID(r.URL.Path, 5)
+		if !ok {
+			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+			return
+		}
+
+		err := models.DeleteComment(db, completionID, commentID, member.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Comment not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete comment: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":    "Comment deleted successfully",
+			"comment_id": commentID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorizeCompletion resolves the completion in /api/completions/{id}/... and
+// checks the caller is a member of the team that owns its habit
+func authorizeCompletion(w http.ResponseWriter, r *http.Request, db *sql.DB) (int, *models.Habit, *models.TeamMember, bool) {
+	completionID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid completion ID", http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+
+	habit, err := models.GetCompletionHabit(db, completionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Completion not found", http.StatusNotFound)
+			return 0, nil, nil, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get completion: %v", err), http.StatusInternalServerError)
+		return 0, nil, nil, false
+	}
+
+	if habit.TeamID == 0 {
+		http.Error(w, "Reactions and comments are only available on shared habits", http.StatusBadRequest)
+		return 0, nil, nil, false
+	}
+
+	member, ok := requireTeamRole(w, r, db, habit.TeamID, models.RoleMember)
+	if !ok {
+		return 0, nil, nil, false
+	}
+
+	return completionID, habit, member, true
+}
+
+// queryInt parses an optional non-negative integer query parameter
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		http.Error(w, fmt.Sprintf("Invalid %s", name), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return n, true
+}
+
+// pageSize parses the limit query parameter, capped at maxPageSize
+func pageSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit, ok := queryInt(w, r, "limit", defaultPageSize)
+	if !ok {
+		return 0, false
+	}
+
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return limit, true
+}
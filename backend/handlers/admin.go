@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"habits/database"
+)
+
+// authorizeAdmin checks the request carries "Authorization: Bearer <token>".
+// On failure it writes the error response and returns false.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, token string) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "Admin token required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// BackupsHandler lists (GET) or creates (POST) database snapshots in dir
+func BackupsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, dir, token string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !authorizeAdmin(w, r, token) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		backups, err := database.ListBackups(dir)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list backups: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(backups)
+
+	case "POST":
+		backup, err := database.BackupToDir(db, dir)
+		if err == database.ErrBackupExists {
+			http.Error(w, "A backup was already taken this second", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to back up database: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(backup)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
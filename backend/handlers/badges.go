@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"habits/models"
+)
+
+// Badge layout, matching shields.io's flat style
+const (
+	badgeHeight     = 20
+	badgePadding    = 6 // on each side of the label and the value
+	badgeFont       = "Verdana,Geneva,DejaVu Sans,sans-serif"
+	badgeLabelColor = "#555"
+	badgeZeroColor  = "#9f9f9f" // for a streak below every threshold
+	badgeMaxLabel   = 40        // runes
+)
+
+// defaultBadgeThresholds colors streaks of at least 1, 7, 30 and 100 days
+const defaultBadgeThresholds = "1:yellow,7:yellowgreen,30:green,100:brightgreen"
+
+// badgeColors are the shields.io color names accepted in thresholds
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellowgreen": "#a4a61d",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"blue":        "#007ec6",
+	"lightgrey":   "#9f9f9f",
+}
+
+// hexColor matches a color given as hex digits, without the # that URLs
+// would treat as a fragment
+var hexColor = regexp.MustCompile(`^([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// badgeThreshold colors streaks of at least Min days
+type badgeThreshold struct {
+	Min   int
+	Color string
+}
+
+// BadgeHandler serves a habit's current streak as a shields.io-style SVG
+// badge at /api/badges/{habit}.svg, where {habit} is a habit ID or, for
+// public embeds, the token of one of its share links. Team habits need the
+// X-Member-ID of a member when addressed by ID. label replaces the habit
+// name and thresholds (e.g. 1:yellow,7:green,30:brightgreen, colors by
+// name or hex) sets the colors.
+func BadgeHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	thresholds, err := parseBadgeThresholds(r.URL.Query().Get("thresholds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/badges/"), ".svg")
+	cacheControl := "public, max-age=300"
+	var habit *models.Habit
+	if id, convErr := strconv.Atoi(key); convErr == nil {
+		memberID, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), id, models.RoleMember)
+		if !ok {
+			return
+		}
+		if memberID != 0 {
+			cacheControl = "private, max-age=300" // Only for team members
+		}
+		habit, err = models.GetHabit(db, id)
+	} else {
+		habit, err = models.GetHabitByShareToken(db, key)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to load habit", http.StatusInternalServerError)
+		return
+	}
+
+	label := habit.Name
+	if custom := r.URL.Query().Get("label"); custom != "" {
+		label = custom
+	}
+	if runes := []rune(label); len(runes) > badgeMaxLabel {
+		label = string(runes[:badgeMaxLabel-1]) + "…"
+	}
+
+	value := fmt.Sprintf("%d day streak", habit.CurrentStreak)
+	svg := renderBadge(label, value, badgeColor(habit.CurrentStreak, thresholds))
+
+	// Embeds are refetched often; let unchanged badges be revalidated cheaply
+	sum := sha256.Sum256([]byte(svg))
+	etag := fmt.Sprintf(`"%x"`, sum[:8])
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write([]byte(svg))
+}
+
+// parseBadgeThresholds reads min:color pairs, or the defaults when empty,
+// sorted by min
+func parseBadgeThresholds(spec string) ([]badgeThreshold, error) {
+	if spec == "" {
+		spec = defaultBadgeThresholds
+	}
+
+	var thresholds []badgeThreshold
+	for _, pair := range strings.Split(spec, ",") {
+		minText, color, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		minDays, err := strconv.Atoi(minText)
+		if !ok || err != nil || minDays < 0 {
+			return nil, fmt.Errorf("Invalid threshold %q, expected days:color", pair)
+		}
+
+		if named, ok := badgeColors[strings.ToLower(color)]; ok {
+			color = named
+		} else if hexColor.MatchString(color) {
+			color = "#" + color
+		} else {
+			return nil, fmt.Errorf("Invalid badge color %q", color)
+		}
+		thresholds = append(thresholds, badgeThreshold{Min: minDays, Color: color})
+	}
+	sort.Slice(thresholds, func(a, b int) bool { return thresholds[a].Min < thresholds[b].Min })
+
+	return thresholds, nil
+}
+
+// badgeColor returns the color of the highest threshold a streak reaches
+func badgeColor(streak int, thresholds []badgeThreshold) string {
+	color := badgeZeroColor
+	for _, t := range thresholds {
+		if streak >= t.Min {
+			color = t.Color
+		}
+	}
+	return color
+}
+
+// renderBadge draws a two-part flat badge
+func renderBadge(label, value, color string) string {
+	labelWidth := textWidth(label) + 2*badgePadding
+	valueWidth := textWidth(value) + 2*badgePadding
+	width := labelWidth + valueWidth
+	title := html.EscapeString(label + ": " + value)
+	label, value = html.EscapeString(label), html.EscapeString(value)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s">`, width, badgeHeight, title)
+	fmt.Fprintf(&b, `<title>%s</title>`, title)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="%d" rx="3" fill="#fff"/></clipPath>`, width, badgeHeight)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="%d" fill="%s"/><rect x="%d" width="%d" height="%d" fill="%s"/><rect width="%d" height="%d" fill="url(#s)"/></g>`,
+		labelWidth, badgeHeight, badgeLabelColor, labelWidth, valueWidth, badgeHeight, color, width, badgeHeight)
+	fmt.Fprintf(&b, `<g fill="#fff" text-anchor="middle" font-family="%s" font-size="11">`, badgeFont)
+	for _, part := range []struct {
+		x    float64
+		text string
+	}{{float64(labelWidth) / 2, label}, {float64(labelWidth) + float64(valueWidth)/2, value}} {
+		fmt.Fprintf(&b, `<text x="%.1f" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%.1f" y="14">%s</text>`, part.x, part.text, part.x, part.text)
+	}
+	b.WriteString("</g></svg>\n")
+
+	return b.String()
+}
+
+// textWidth estimates the width in pixels of text in 11px Verdana
+func textWidth(text string) int {
+	width := 0.0
+	for _, c := range text {
+		switch {
+		case strings.ContainsRune("il.,:;|!'", c):
+			width += 3.5
+		case strings.ContainsRune("fjrtI ()[]", c):
+			width += 4.5
+		case strings.ContainsRune("mwMW", c):
+			width += 10.5
+		case c >= 'A' && c <= 'Z':
+			width += 7.5
+		case c < 0x80:
+			width += 7
+		case c >= 0x2E80:
+			width += 11 // CJK and other wide characters
+		default:
+			width += 7.5
+		}
+	}
+	return int(width + 0.5)
+}
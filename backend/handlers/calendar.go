@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// Calendar feed windows, in days, and their limits
+const (
+	defaultCalendarPast  = 90
+	maxCalendarPast      = 366
+	defaultCalendarAhead = 14
+	maxCalendarAhead     = 90
+)
+
+// iCalendar formatting
+const (
+	icalDateLayout     = "20060102"
+	icalDateTimeLayout = "20060102T150405Z"
+	icalMaxLineOctets  = 75
+	icalProductID      = "-//Habits//Habit Tracker//EN"
+	icalUIDDomain      = "habits"
+	icalRefresh        = "PT1H" // how often subscribers should refetch
+)
+
+// CalendarFeedsHandler manages personal calendar feeds at /api/calendar/feeds[/{id}]
+func CalendarFeedsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+	manageCalendarFeeds(w, r, db, 0, 4)
+}
+
+// TeamCalendarFeedsHandler manages the calling member's calendar feeds at
+// /api/teams/{id}/calendar[/{feed_id}]
+func TeamCalendarFeedsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	member, ok := requireTeamRole(w, r, db, teamID, models.RoleMember)
+	if !ok {
+		return
+	}
+
+	manageCalendarFeeds(w, r, db, member.ID, 5)
+}
+
+// manageCalendarFeeds lists (GET), creates (POST) or revokes (DELETE, with
+// the feed ID at path index idIndex) the feeds of a member, or the personal
+// feeds when memberID is 0
+func manageCalendarFeeds(w http.ResponseWriter, r *http.Request, db *sql.DB, memberID, idIndex int) {
+	switch r.Method {
+	case "GET":
+		feeds, err := models.GetCalendarFeeds(db, memberID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get calendar feeds: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(feeds)
+	case "POST":
+		feed, err := models.CreateCalendarFeed(db, memberID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create calendar feed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(feed)
+	case "DELETE":
+		feedID, ok := pathID(strings.TrimSuffix(r.URL.Path, "/"), idIndex)
+		if !ok {
+			http.Error(w, "Invalid calendar feed ID", http.StatusBadRequest)
+			return
+		}
+
+		err := models.RevokeCalendarFeed(db, memberID, feedID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Calendar feed not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to revoke calendar feed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": "Calendar feed revoked successfully",
+			"feed_id": feedID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CalendarHandler serves a feed as iCalendar at /calendar/{token}.ics. Past
+// completions are events; periods a habit is due in, from today through
+// ahead days, are to-dos (or all-day events with upcoming=events, for
+// calendar apps that ignore to-dos). days sets how far back completions go.
+// The token is the only credential.
+func CalendarHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+	feed, err := models.GetCalendarFeedByToken(db, token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+
+	past, ok := queryInt(w, r, "days", defaultCalendarPast)
+	if !ok {
+		return
+	}
+	ahead, ok := queryInt(w, r, "ahead", defaultCalendarAhead)
+	if !ok {
+		return
+	}
+	if past > maxCalendarPast {
+		past = maxCalendarPast
+	}
+	if ahead > maxCalendarAhead {
+		ahead = maxCalendarAhead
+	}
+	upcomingAsEvents := r.URL.Query().Get("upcoming") == "events"
+
+	calendar, err := models.GetCalendar(db, feed, past, ahead)
+	if err != nil {
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(renderCalendar(calendar, upcomingAsEvents, time.Now().UTC())))
+}
+
+// renderCalendar formats a calendar as an iCalendar (RFC 5545) document
+func renderCalendar(calendar *models.Calendar, upcomingAsEvents bool, now time.Time) string {
+	var ics icalWriter
+	stamp := now.Format(icalDateTimeLayout)
+
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", icalProductID)
+	ics.line("CALSCALE", "GREGORIAN")
+	ics.line("X-WR-CALNAME", "Habits")
+	ics.line("REFRESH-INTERVAL;VALUE=DURATION", icalRefresh)
+	ics.line("X-PUBLISHED-TTL", icalRefresh)
+
+	habits := make(map[int]*models.Habit)
+	for i := range calendar.Habits {
+		habits[calendar.Habits[i].ID] = &calendar.Habits[i]
+	}
+
+	for _, c := range calendar.Completions {
+		habit := habits[c.HabitID]
+		if habit == nil {
+			continue
+		}
+		summary := "✓ " + habit.Name
+		if c.MemberName != "" {
+			summary += " (" + c.MemberName + ")"
+		}
+
+		ics.line("BEGIN", "VEVENT")
+		ics.line("UID", fmt.Sprintf("completion-%d@%s", c.ID, icalUIDDomain))
+		ics.line("DTSTAMP", stamp)
+		ics.line("DTSTART", c.CompletedAt.Format(icalDateTimeLayout))
+		ics.line("SUMMARY", icalText(summary))
+		if habit.Description != "" {
+			ics.line("DESCRIPTION", icalText(habit.Description))
+		}
+		ics.line("TRANSP", "TRANSPARENT")
+		ics.line("END", "VEVENT")
+	}
+
+	for _, o := range calendar.Occurrences {
+		habit := habits[o.HabitID]
+		if habit == nil {
+			continue
+		}
+		summary := habit.Name
+		if o.Target > 1 {
+			summary += fmt.Sprintf(" (%d×)", o.Target)
+		}
+		completed := o.Completions >= o.Target
+		uid := fmt.Sprintf("habit-%d-due-%s@%s", habit.ID, o.Start.Format(icalDateLayout), icalUIDDomain)
+
+		if upcomingAsEvents {
+			ics.line("BEGIN", "VEVENT")
+			ics.line("UID", uid)
+			ics.line("DTSTAMP", stamp)
+			ics.line("DTSTART;VALUE=DATE", o.Start.Format(icalDateLayout))
+			ics.line("DTEND;VALUE=DATE", o.End.Format(icalDateLayout))
+			if completed {
+				summary = "✓ " + summary
+			}
+			ics.line("SUMMARY", icalText(summary))
+			ics.line("TRANSP", "TRANSPARENT")
+			ics.line("END", "VEVENT")
+			continue
+		}
+
+		ics.line("BEGIN", "VTODO")
+		ics.line("UID", uid)
+		ics.line("DTSTAMP", stamp)
+		ics.line("DTSTART;VALUE=DATE", o.Start.Format(icalDateLayout))
+		ics.line("DUE;VALUE=DATE", o.End.Format(icalDateLayout))
+		ics.line("SUMMARY", icalText(summary))
+		if habit.Description != "" {
+			ics.line("DESCRIPTION", icalText(habit.Description))
+		}
+		if o.Target > 1 {
+			ics.line("PERCENT-COMPLETE", strconv.Itoa(min(o.Completions, o.Target)*100/o.Target))
+		}
+		if completed {
+			ics.line("STATUS", "COMPLETED")
+		} else {
+			ics.line("STATUS", "NEEDS-ACTION")
+		}
+		ics.line("END", "VTODO")
+	}
+
+	ics.line("END", "VCALENDAR")
+	return ics.String()
+}
+
+// icalWriter builds an iCalendar document with CRLF line endings, folding
+// lines longer than 75 octets without splitting UTF-8 characters
+type icalWriter struct {
+	strings.Builder
+}
+
+func (w *icalWriter) line(name, value string) {
+	content := name + ":" + value
+	limit := icalMaxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut-- // Inside a multi-byte character
+		}
+		w.WriteString(content[:cut] + "\r\n ")
+		content = content[cut:]
+		limit = icalMaxLineOctets - 1 // Continuation lines start with a space
+	}
+	w.WriteString(content + "\r\n")
+}
+
+// icalText escapes a TEXT property value
+var icalText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// challengeRequest is the request body for creating a challenge
+type challengeRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Frequency   string `json:"frequency"`
+	TargetCount int    `json:"target_count"`
+	StartDate   string `json:"start_date"` // YYYY-MM-DD
+	EndDate     string `json:"end_date"`   // YYYY-MM-DD
+}
+
+// ChallengesHandler handles listing and creating challenges
+func ChallengesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		handleGetChallenges(w, r, db)
+	case "POST":
+		handleCreateChallenge(w, r, db)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ChallengeDetailHandler handles individual challenge operations
+func ChallengeDetailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	challengeID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		challenge, ok := loadChallenge(w, db, challengeID)
+		if !ok {
+			return
+		}
+		json.NewEncoder(w).Encode(challenge)
+	case "DELETE":
+		if err := models.DeleteChallenge(db, challengeID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete challenge: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":      "Challenge deleted successfully",
+			"challenge_id": challengeID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ChallengeParticipantsHandler handles joining and leaving a challenge
+func ChallengeParticipantsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	challengeID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		participants, err := models.GetChallengeParticipants(db, challengeID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get participants: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(participants)
+	case "POST":
+		challenge, ok := loadChallenge(w, db, challengeID)
+		if !ok {
+			return
+		}
+		if challenge.IsFinished {
+			http.Error(w, "Challenge has already ended", http.StatusConflict)
+			return
+		}
+
+		var participant models.ChallengeParticipant
+		if err := json.NewDecoder(r.Body).Decode(&participant); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if participant.Name == "" {
+			http.Error(w, "Participant name is required", http.StatusBadRequest)
+			return
+		}
+
+		// Linking an existing habit publishes its progress on the leaderboard
+		if participant.HabitID != 0 {
+			if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), participant.HabitID, models.RoleAdmin); !ok {
+				return
+			}
+		}
+
+		err := models.JoinChallenge(db, challenge, &participant)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Habit not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to join challenge: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(participant)
+	case "DELETE":
+		participantID, ok := pathID(r.URL.Path, 5)
+		if !ok {
+			http.Error(w, "Invalid participant ID", http.StatusBadRequest)
+			return
+		}
+
+		challenge, ok := loadChallenge(w, db, challengeID)
+		if !ok {
+			return
+		}
+		if challenge.IsFinished {
+			http.Error(w, "Challenge has already ended", http.StatusConflict)
+			return
+		}
+
+		participant, err := models.GetChallengeParticipant(db, challengeID, participantID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Participant not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get participant: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), participant.HabitID, models.RoleAdmin); !ok {
+			return
+		}
+
+		err = models.LeaveChallenge(db, challengeID, participantID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Participant not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to leave challenge: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":        "Participant removed successfully",
+			"participant_id": participantID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// LeaderboardHandler returns the ranking of a challenge's participants
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challengeID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+		return
+	}
+
+	challenge, ok := loadChallenge(w, db, challengeID)
+	if !ok {
+		return
+	}
+
+	leaderboard, err := models.GetLeaderboard(db, challenge)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get leaderboard: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+func handleGetChallenges(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	challenges, err := models.GetChallenges(db)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get challenges: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(challenges)
+}
+
+func handleCreateChallenge(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req challengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if req.Name == "" {
+		http.Error(w, "Challenge name is required", http.StatusBadRequest)
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		http.Error(w, "Invalid start_date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		http.Error(w, "Invalid end_date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	if endDate.Before(startDate) {
+		http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return
+	}
+
+	challenge := models.Challenge{
+		Name:        req.Name,
+		Description: req.Description,
+		Frequency:   req.Frequency,
+		TargetCount: req.TargetCount,
+		StartDate:   startDate,
+		EndDate:     endDate,
+	}
+
+	if challenge.Frequency == "" {
+		challenge.Frequency = "daily" // Default to daily
+	}
+
+	if challenge.TargetCount == 0 {
+		challenge.TargetCount = 1 // Default to 1
+	}
+
+	if err := models.CreateChallenge(db, &challenge); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create challenge: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// loadChallenge fetches a challenge and writes the error response if it fails
+func loadChallenge(w http.ResponseWriter, db *sql.DB, challengeID int) (*models.Challenge, bool) {
+	challenge, err := models.GetChallenge(db, challengeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Challenge not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get challenge: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// pathID parses the integer path segment at index i (e.g. /api/challenges/{id})
+func pathID(path string, i int) (int, bool) {
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) <= i {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(pathParts[i])
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
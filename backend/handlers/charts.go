@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"habits/database"
+	"habits/models"
+)
+
+// SVG chart limits and layout, in pixels
+const (
+	maxChartDays             = 365
+	defaultStreakBars        = 10
+	maxStreakBars            = 50
+	heatmapChartWeeks        = 53
+	chartWidth               = 720
+	chartFont                = `-apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif`
+	chartCacheControl        = "public, max-age=300"
+	privateChartCacheControl = "private, max-age=300"
+	heatmapCellSize          = 11
+	heatmapCellGap           = 2
+)
+
+// chartTheme holds the colors of an SVG chart
+type chartTheme struct {
+	Background string
+	Text       string
+	Muted      string
+	Grid       string
+	Bar        string
+	Levels     [5]string // heatmap colors from no completions to target met
+}
+
+// chartThemes are selected with the theme query parameter
+var chartThemes = map[string]chartTheme{
+	"light": {
+		Background: "#ffffff", Text: "#111827", Muted: "#6b7280", Grid: "#e5e7eb", Bar: "#3b82f6",
+		Levels: [5]string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"},
+	},
+	"dark": {
+		Background: "#0d1117", Text: "#e6edf3", Muted: "#8b949e", Grid: "#30363d", Bar: "#58a6ff",
+		Levels: [5]string{"#161b22", "#0e4429", "#006d32", "#26a641", "#39d353"},
+	},
+}
+
+// CompletionRateSVGHandler renders completions per day over the last days
+// days (default 30) as an SVG column chart at /api/charts/completion-rates.svg
+func CompletionRateSVGHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
+	theme, ok := svgRequest(w, r)
+	if !ok {
+		return
+	}
+	teamID, ok := chartTeam(w, r, store)
+	if !ok {
+		return
+	}
+	days, ok := queryInt(w, r, "days", 30)
+	if !ok {
+		return
+	}
+	if days < 2 || days > maxChartDays {
+		http.Error(w, fmt.Sprintf("days must be between 2 and %d", maxChartDays), http.StatusBadRequest)
+		return
+	}
+
+	chartData, err := getCompletionRateData(db, days, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get completion rate data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeSVG(w, renderColumnChart(fmt.Sprintf("Completions per day, last %d days", days), chartData, theme), teamID != 0)
+}
+
+// StreakSVGHandler renders the longest current streaks, up to limit habits
+// (default 10), as an SVG bar chart at /api/charts/streaks.svg
+func StreakSVGHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
+	theme, ok := svgRequest(w, r)
+	if !ok {
+		return
+	}
+	teamID, ok := chartTeam(w, r, store)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(w, r, "limit", defaultStreakBars)
+	if !ok {
+		return
+	}
+	if limit < 1 || limit > maxStreakBars {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxStreakBars), http.StatusBadRequest)
+		return
+	}
+
+	chartData, err := getStreakData(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get streak data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(chartData.Labels) > limit {
+		chartData.Labels = chartData.Labels[:limit]
+		chartData.Data = chartData.Data[:limit]
+	}
+
+	writeSVG(w, renderBarChart("Current streaks (days)", chartData, theme), teamID != 0)
+}
+
+// HeatmapSVGHandler renders a year of daily completions as an SVG calendar
+// heatmap at /api/charts/heatmap.svg, for one habit with habit_id or for all
+// habits. A habit's cells are shaded by its target; all habits' by the
+// busiest day.
+func HeatmapSVGHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
+	theme, ok := svgRequest(w, r)
+	if !ok {
+		return
+	}
+	habitID, ok := queryInt(w, r, "habit_id", 0)
+	if !ok {
+		return
+	}
+
+	title, target, teamID := "All habits", 0, 0
+	if habitID != 0 {
+		if _, ok := authorizeHabit(w, r, store, habitID, models.RoleMember); !ok {
+			return
+		}
+		habit, err := store.GetHabit(habitID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get habit: %v", err), http.StatusInternalServerError)
+			return
+		}
+		title, target, teamID = habit.Name, habit.TargetCount, habit.TeamID
+	} else if teamID, ok = chartTeam(w, r, store); !ok {
+		return
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -7*(heatmapChartWeeks-1))
+	from = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7)) // Start on a Monday
+
+	days, err := getHeatmapData(db, habitID, teamID, from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get heatmap data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	total := 0
+	if habitID == 0 {
+		for _, day := range days {
+			target = max(target, day.Count)
+		}
+	}
+	for _, day := range days {
+		total += day.Count
+	}
+
+	writeSVG(w, renderHeatmap(fmt.Sprintf("%s: %d completions in the last year", title, total), days, target, theme), teamID != 0)
+}
+
+// svgRequest checks the method and returns the requested theme (light by
+// default), writing the error response if either is invalid
+func svgRequest(w http.ResponseWriter, r *http.Request) (chartTheme, bool) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return chartTheme{}, false
+	}
+
+	name := r.URL.Query().Get("theme")
+	if name == "" {
+		name = "light"
+	}
+	theme, ok := chartThemes[name]
+	if !ok {
+		http.Error(w, "Invalid theme (must be light or dark)", http.StatusBadRequest)
+		return chartTheme{}, false
+	}
+
+	return theme, true
+}
+
+// chartTeam returns the team_id of a chart over all habits, writing the
+// error response if the caller is not a member of the team. Without team_id
+// charts cover personal habits and it returns 0.
+func chartTeam(w http.ResponseWriter, r *http.Request, store models.HabitStore) (int, bool) {
+	teamID, ok := queryInt(w, r, "team_id", 0)
+	if !ok || teamID == 0 {
+		return teamID, ok
+	}
+
+	_, ok = checkMemberRole(w, r, func(memberID int) (*models.TeamMember, error) {
+		return store.GetTeamMember(teamID, memberID)
+	}, models.RoleMember)
+	return teamID, ok
+}
+
+// writeSVG sends a rendered chart, cacheable briefly so embeds stay cheap.
+// Team charts are kept out of shared caches.
+func writeSVG(w http.ResponseWriter, svg string, private bool) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if private {
+		w.Header().Set("Cache-Control", privateChartCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", chartCacheControl)
+	}
+	w.Write([]byte(svg))
+}
+
+// getHeatmapData returns completions per day over [from, to], including days
+// without completions, for one habit or, when habitID is 0, all personal
+// habits or all of a team's habits
+func getHeatmapData(db *sql.DB, habitID, teamID int, from, to time.Time) ([]models.HeatmapDay, error) {
+	d := database.DialectOf(db)
+	day := d.Date("completed_at")
+	where := "completed_at >= ? AND completed_at < ?"
+	args := []interface{}{from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02")}
+	switch {
+	case habitID != 0:
+		where += " AND habit_id = ?"
+		args = append(args, habitID)
+	case teamID != 0:
+		where += " AND habit_id IN (SELECT id FROM habits WHERE team_id = ?)"
+		args = append(args, teamID)
+	default:
+		where += " AND habit_id IN (SELECT id FROM habits WHERE team_id IS NULL)"
+	}
+
+	rows, err := db.Query(d.Rebind(`
+		SELECT CAST(`+day+` AS TEXT), COUNT(*)
+		FROM habit_completions
+		WHERE `+where+`
+		GROUP BY `+day), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var date string
+		var count int
+		if err := rows.Scan(&date, &count); err != nil {
+			return nil, err
+		}
+		counts[date] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	days := []models.HeatmapDay{}
+	for t := from; !t.After(to); t = t.AddDate(0, 0, 1) {
+		date := t.Format("2006-01-02")
+		days = append(days, models.HeatmapDay{Date: date, Count: counts[date]})
+	}
+
+	return days, nil
+}
+
+// svgWriter builds an SVG document
+type svgWriter struct {
+	strings.Builder
+}
+
+// start opens the document with a background and a title
+func (s *svgWriter) start(width, height int, title string, theme chartTheme) {
+	fmt.Fprintf(s, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="11">`+"\n",
+		width, height, width, height, chartFont)
+	fmt.Fprintf(s, "<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(s, `<rect width="100%%" height="100%%" rx="6" fill="%s"/>`+"\n", theme.Background)
+	s.text(16, 24, "start", theme.Text, title, `font-size="13" font-weight="600"`)
+}
+
+func (s *svgWriter) text(x, y float64, anchor, fill, text string, attrs ...string) {
+	extra := ""
+	if len(attrs) > 0 {
+		extra = " " + strings.Join(attrs, " ")
+	}
+	fmt.Fprintf(s, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s"%s>%s</text>`+"\n", x, y, anchor, fill, extra, html.EscapeString(text))
+}
+
+func (s *svgWriter) rect(x, y, width, height float64, fill, tooltip string) {
+	if tooltip == "" {
+		fmt.Fprintf(s, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="2" fill="%s"/>`+"\n", x, y, width, height, fill)
+		return
+	}
+	fmt.Fprintf(s, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="2" fill="%s"><title>%s</title></rect>`+"\n",
+		x, y, width, height, fill, html.EscapeString(tooltip))
+}
+
+func (s *svgWriter) line(x1, y1, x2, y2 float64, stroke string) {
+	fmt.Fprintf(s, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1"/>`+"\n", x1, y1, x2, y2, stroke)
+}
+
+func (s *svgWriter) end() string {
+	s.WriteString("</svg>\n")
+	return s.String()
+}
+
+// chartTicks is the number of gridlines above zero on a value axis
+const chartTicks = 4
+
+// niceMax rounds a chart's peak value up so each of the chartTicks
+// gridlines falls on a whole multiple of 1, 2 or 5 times a power of ten
+func niceMax(peak float64) float64 {
+	step := math.Max(peak/chartTicks, 1) // Charts count days and completions
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, nice := range []float64{1, 2, 5, 10} {
+		if step <= nice*magnitude {
+			return nice * magnitude * chartTicks
+		}
+	}
+	return 10 * magnitude * chartTicks
+}
+
+// formatValue formats a chart value without a needless decimal point
+func formatValue(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.1f", value)
+}
+
+// renderColumnChart draws one column per label with a gridded value axis,
+// labelling about eight columns so the axis stays readable
+func renderColumnChart(title string, data *ChartData, theme chartTheme) string {
+	const height, left, right, top, bottom = 260, 44, 16, 44, 36
+	plotWidth, plotHeight := float64(chartWidth-left-right), float64(height-top-bottom)
+
+	var s svgWriter
+	s.start(chartWidth, height, title, theme)
+
+	peak := 0.0
+	for _, value := range data.Data {
+		peak = math.Max(peak, value)
+	}
+	scale := niceMax(peak)
+	for i := 0; i <= chartTicks; i++ {
+		value := scale * float64(i) / chartTicks
+		y := top + plotHeight - plotHeight*float64(i)/chartTicks
+		s.line(left, y, left+plotWidth, y, theme.Grid)
+		s.text(left-6, y+4, "end", theme.Muted, formatValue(value))
+	}
+
+	n := len(data.Data)
+	if n == 0 {
+		return s.end()
+	}
+	slot := plotWidth / float64(n)
+	every := int(math.Ceil(float64(n) / 8))
+	for i, value := range data.Data {
+		barHeight := plotHeight * value / scale
+		x := left + slot*float64(i) + slot*0.15
+		s.rect(x, top+plotHeight-barHeight, slot*0.7, barHeight, theme.Bar, data.Labels[i]+": "+formatValue(value))
+		if (n-1-i)%every == 0 {
+			s.text(left+slot*(float64(i)+0.5), float64(height-bottom+16), "middle", theme.Muted, data.Labels[i])
+		}
+	}
+
+	return s.end()
+}
+
+// renderBarChart draws one labelled horizontal bar per label
+func renderBarChart(title string, data *ChartData, theme chartTheme) string {
+	const left, right, top, row = 180, 48, 44, 24
+	height := top + row*max(len(data.Data), 1) + 12
+	plotWidth := float64(chartWidth - left - right)
+
+	var s svgWriter
+	s.start(chartWidth, height, title, theme)
+
+	if len(data.Data) == 0 {
+		s.text(left, top+16, "start", theme.Muted, "No habits yet")
+		return s.end()
+	}
+
+	scale := 1.0 // Bars are labelled with their values, so the longest fills the width
+	for _, value := range data.Data {
+		scale = math.Max(scale, value)
+	}
+
+	for i, value := range data.Data {
+		y := float64(top + row*i)
+		label := data.Labels[i]
+		if runes := []rune(label); len(runes) > 28 {
+			label = string(runes[:27]) + "…"
+		}
+		s.text(left-8, y+row/2+4, "end", theme.Text, label)
+		width := plotWidth * value / scale
+		s.rect(left, y+4, math.Max(width, 1), row-8, theme.Bar, data.Labels[i]+": "+formatValue(value))
+		s.text(left+width+6, y+row/2+4, "start", theme.Muted, formatValue(value))
+	}
+
+	return s.end()
+}
+
+// renderHeatmap draws days as Monday-first week columns shaded like the
+// share page heatmap, with month and weekday labels and a legend
+func renderHeatmap(title string, days []models.HeatmapDay, target int, theme chartTheme) string {
+	const left, top = 44, 56
+	weeks := heatmapWeeks(days, target)
+	step := heatmapCellSize + heatmapCellGap
+	width := max(left+step*len(weeks)+16, 320)
+	height := top + step*7 + 36
+
+	var s svgWriter
+	s.start(width, height, title, theme)
+
+	for i, name := range []string{"Mon", "Wed", "Fri"} {
+		s.text(left-6, float64(top+step*(i*2)+heatmapCellSize-1), "end", theme.Muted, name)
+	}
+
+	lastMonth := ""
+	for x, week := range weeks {
+		for y, cell := range week {
+			if cell.Date == "" {
+				continue // Padding before the first day
+			}
+			s.rect(float64(left+step*x), float64(top+step*y), heatmapCellSize, heatmapCellSize, theme.Levels[cell.Level],
+				fmt.Sprintf("%s: %d", cell.Date, cell.Count))
+		}
+
+		// Label each month above the first week column that starts in it
+		first := week[len(week)-1].Date
+		if week[0].Date != "" {
+			first = week[0].Date
+		}
+		if month := first[:7]; month != lastMonth {
+			lastMonth = month
+			if t, err := time.Parse("2006-01", month); err == nil && x < len(weeks)-2 {
+				s.text(float64(left+step*x), top-8, "start", theme.Muted, t.Format("Jan"))
+			}
+		}
+	}
+
+	legendY := float64(top + step*7 + 14)
+	legendX := float64(width - 16 - step*5 - 64)
+	s.text(legendX-6, legendY+heatmapCellSize-1, "end", theme.Muted, "Less")
+	for level, color := range theme.Levels {
+		s.rect(legendX+float64(step*level), legendY, heatmapCellSize, heatmapCellSize, color, "")
+	}
+	s.text(legendX+float64(step*5)+4, legendY+heatmapCellSize-1, "start", theme.Muted, "More")
+
+	return s.end()
+}
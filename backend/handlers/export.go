@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/importers"
+	"habits/models"
+)
+
+// maxImportSize limits the size of an import request body
+const maxImportSize = 64 << 20
+
+// ExportHandler serves all data as a versioned JSON document at
+// GET /api/export. It includes every team, so it needs the admin token.
+func ExportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, token string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r, token) {
+		return
+	}
+
+	export, err := models.ExportData(db)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "habits-export-" + time.Now().Format("20060102") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+// CSVExportHandler streams a CSV report at GET /api/export.csv. The type
+// query parameter selects completions (default, one row per completion) or
+// summary (one row per habit with streaks and period rates). Rows can be
+// limited with from and to (YYYY-MM-DD, inclusive), habit_id (repeatable or
+// comma-separated), team_id and tag. Summaries default to the last 30 days.
+// Reports cover personal habits unless team_id or habit_id is given; team
+// habits are for members only.
+func CSVExportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	report := query.Get("type")
+	if report == "" {
+		report = "completions"
+	}
+	if report != "completions" && report != "summary" {
+		http.Error(w, "Invalid type (must be completions or summary)", http.StatusBadRequest)
+		return
+	}
+
+	filter := models.CompletionFilter{To: time.Now().UTC()}
+	if report == "summary" {
+		filter.From = filter.To.AddDate(0, 0, -29)
+	}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(bound.name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s date, expected YYYY-MM-DD", bound.name), http.StatusBadRequest)
+				return
+			}
+			*bound.date = date
+		}
+	}
+	if !filter.From.IsZero() && filter.To.Before(filter.From) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	for _, value := range query["habit_id"] {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid habit_id", http.StatusBadRequest)
+				return
+			}
+			if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), id, models.RoleMember); !ok {
+				return
+			}
+			filter.HabitIDs = append(filter.HabitIDs, id)
+		}
+	}
+	teamID, ok := queryInt(w, r, "team_id", 0)
+	if !ok {
+		return
+	}
+	if teamID != 0 {
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+			return
+		}
+	}
+	filter.TeamID = teamID
+	filter.Tag = strings.ToLower(strings.TrimSpace(query.Get("tag")))
+
+	var summaries []models.HabitSummary
+	if report == "summary" {
+		var err error
+		if summaries, err = models.GetHabitSummaries(db, filter); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to summarise habits: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filename := "habits-" + report + "-" + time.Now().Format("20060102") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var err error
+	if report == "summary" {
+		err = writeSummaryCSV(w, summaries)
+	} else {
+		err = writeCompletionsCSV(w, db, filter)
+	}
+	if err != nil {
+		// Rows may already be sent, so the error can only end the output
+		log.Printf("CSV export failed: %v", err)
+	}
+}
+
+// csvFlushRows is how many rows are buffered before streaming them out
+const csvFlushRows = 500
+
+// writeCompletionsCSV streams one row per completion
+func writeCompletionsCSV(w http.ResponseWriter, db *sql.DB, filter models.CompletionFilter) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"habit_id", "habit", "team", "date", "completed_at", "member", "value", "note", "tags"})
+
+	rows := 0
+	err := models.EachCompletion(db, filter, func(c models.CompletionRecord) error {
+		value := ""
+		if c.Value != nil {
+			value = strconv.FormatFloat(*c.Value, 'f', -1, 64)
+		}
+		out.Write([]string{
+			strconv.Itoa(c.HabitID), csvText(c.HabitName), csvText(c.TeamName),
+			c.CompletedAt.Format("2006-01-02"), c.CompletedAt.Format(time.RFC3339), csvText(c.MemberName),
+			value, csvText(c.Note), csvText(strings.Join(c.Tags, ",")),
+		})
+		if rows++; rows%csvFlushRows == 0 {
+			out.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		return out.Error()
+	})
+	out.Flush()
+	if err != nil {
+		return err
+	}
+	return out.Error()
+}
+
+// csvText guards a text cell against formula injection. Spreadsheets run a
+// cell starting with =, +, - or @ (or a tab or carriage return before one)
+// as a formula, so such cells are prefixed with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeSummaryCSV writes one row per habit
+func writeSummaryCSV(w http.ResponseWriter, summaries []models.HabitSummary) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"habit_id", "habit", "team", "frequency", "target_count", "from", "to", "completions",
+		"periods", "periods_met", "period_rate", "current_streak", "longest_streak", "last_completed", "tags",
+	})
+	for _, s := range summaries {
+		last := ""
+		if !s.LastCompletion.IsZero() {
+			last = s.LastCompletion.Format("2006-01-02")
+		}
+		out.Write([]string{
+			strconv.Itoa(s.ID), csvText(s.Name), csvText(s.TeamName), s.Frequency, strconv.Itoa(s.TargetCount),
+			s.From.Format("2006-01-02"), s.To.Format("2006-01-02"), strconv.Itoa(s.Completions),
+			strconv.Itoa(s.Periods), strconv.Itoa(s.PeriodsMet), strconv.FormatFloat(s.PeriodRate, 'f', 1, 64),
+			strconv.Itoa(s.CurrentStreak), strconv.Itoa(s.LongestStreak), last, csvText(strings.Join(s.Tags, ",")),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ImportHandler applies an export document at POST /api/import. The mode
+// query parameter is merge (default) or replace; dry_run=true reports the
+// changes without making them. A replace that would delete data exports do
+// not carry is refused unless discard=true. Imports need the admin token.
+func ImportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, token string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r, token) {
+		return
+	}
+
+	opts, ok := importOptions(w, r)
+	if !ok {
+		return
+	}
+
+	var data models.Export
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&data); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	applyImport(w, db, &data, opts)
+}
+
+// ImportFormatHandler imports another app's export at POST /api/import/{format}
+// (loop, habitica or csv). It takes the same mode and dry_run parameters as
+// ImportHandler; the csv format also takes its column mapping as parameters.
+func ImportFormatHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, token string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r, token) {
+		return
+	}
+
+	format := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/api/import/")
+	importer, err := importers.New(format, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, ok := importOptions(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := importer.Parse(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	applyImport(w, db, data, opts)
+}
+
+// importOptions reads the mode, dry_run and discard query parameters. On
+// failure it writes the error response and returns false.
+func importOptions(w http.ResponseWriter, r *http.Request) (models.ImportOptions, bool) {
+	query := r.URL.Query()
+	opts := models.ImportOptions{Mode: query.Get("mode"), DryRun: query.Get("dry_run") == "true", Discard: query.Get("discard") == "true"}
+	if opts.Mode == "" {
+		opts.Mode = models.ImportMerge
+	}
+	if opts.Mode != models.ImportMerge && opts.Mode != models.ImportReplace {
+		http.Error(w, "Invalid mode (must be merge or replace)", http.StatusBadRequest)
+		return opts, false
+	}
+	return opts, true
+}
+
+// applyImport validates and imports data, writing the result
+func applyImport(w http.ResponseWriter, db *sql.DB, data *models.Export, opts models.ImportOptions) {
+	if err := models.ValidateExport(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := models.ImportData(db, data, opts)
+	var discard *models.DiscardError
+	if errors.As(err, &discard) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,36 +1,37 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"habits/models"
 )
 
 // HabitsHandler handles all habit-related HTTP requests
-func HabitsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func HabitsHandler(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case "GET":
-		handleGetHabits(w, r, db)
+		handleGetHabits(w, r, store)
 	case "POST":
-		handleCreateHabit(w, r, db)
+		handleCreateHabit(w, r, store)
 	case "PUT":
-		handleUpdateHabit(w, r, db)
+		handleUpdateHabit(w, r, store)
 	case "DELETE":
-		handleDeleteHabit(w, r, db)
+		handleDeleteHabit(w, r, store)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // HabitDetailHandler handles individual habit operations
-func HabitDetailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func HabitDetailHandler(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Extract habit ID from URL
@@ -48,18 +49,32 @@ func HabitDetailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 	switch r.Method {
 	case "GET":
-		handleGetHabit(w, r, db, habitID)
+		if _, ok := authorizeHabit(w, r, store, habitID, models.RoleMember); !ok {
+			return
+		}
+		handleGetHabit(w, r, store, habitID)
 	case "PUT":
-		handleUpdateHabitByID(w, r, db, habitID)
+		if _, ok := authorizeHabit(w, r, store, habitID, models.RoleAdmin); !ok {
+			return
+		}
+		handleUpdateHabitByID(w, r, store, habitID)
 	case "DELETE":
-		handleDeleteHabitByID(w, r, db, habitID)
+		if _, ok := authorizeHabit(w, r, store, habitID, models.RoleAdmin); !ok {
+			return
+		}
+		handleDeleteHabitByID(w, r, store, habitID)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// CompleteHabitHandler handles habit completion
-func CompleteHabitHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// maxNoteLen limits the note recorded with a completion
+const maxNoteLen = 1000
+
+// CompleteHabitHandler handles habit completion. A completion may record a
+// value (such as pages read) and a note; completing again the same day keeps
+// the first.
+func CompleteHabitHandler(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Extract habit ID from URL
@@ -75,9 +90,25 @@ func CompleteHabitHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	memberID, ok := authorizeHabit(w, r, store, habitID, models.RoleMember)
+	if !ok {
+		return
+	}
+
 	if r.Method == "POST" {
-		// Complete habit
-		err = models.CompleteHabit(db, habitID)
+		// Complete habit, with an optional {"value": ..., "note": ...} body
+		var details models.CompletionDetails
+		if err := json.NewDecoder(r.Body).Decode(&details); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		details.Note = strings.TrimSpace(details.Note)
+		if utf8.RuneCountInString(details.Note) > maxNoteLen {
+			http.Error(w, fmt.Sprintf("Note must be at most %d characters", maxNoteLen), http.StatusBadRequest)
+			return
+		}
+
+		err = store.CompleteHabit(habitID, memberID, details)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to complete habit: %v", err), http.StatusInternalServerError)
 			return
@@ -90,7 +121,7 @@ func CompleteHabitHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		json.NewEncoder(w).Encode(response)
 	} else if r.Method == "DELETE" {
 		// Uncomplete habit
-		err = models.UncompleteHabit(db, habitID)
+		err = store.UncompleteHabit(habitID)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to uncomplete habit: %v", err), http.StatusInternalServerError)
 			return
@@ -106,8 +137,8 @@ func CompleteHabitHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 }
 
-func handleGetHabits(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	habits, err := models.GetHabits(db)
+func handleGetHabits(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
+	habits, err := store.GetHabits()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get habits: %v", err), http.StatusInternalServerError)
 		return
@@ -116,10 +147,10 @@ func handleGetHabits(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	json.NewEncoder(w).Encode(habits)
 }
 
-func handleGetHabit(w http.ResponseWriter, r *http.Request, db *sql.DB, habitID int) {
-	habit, err := models.GetHabit(db, habitID)
+func handleGetHabit(w http.ResponseWriter, r *http.Request, store models.HabitStore, habitID int) {
+	habit, err := store.GetHabit(habitID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == models.ErrNotFound {
 			http.Error(w, "Habit not found", http.StatusNotFound)
 			return
 		}
@@ -130,7 +161,7 @@ func handleGetHabit(w http.ResponseWriter, r *http.Request, db *sql.DB, habitID
 	json.NewEncoder(w).Encode(habit)
 }
 
-func handleCreateHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleCreateHabit(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	var habit models.Habit
 	if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -143,6 +174,12 @@ func handleCreateHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	// Team habits need an admin of the team, so they are only created through its route
+	if habit.TeamID != 0 {
+		http.Error(w, "Create team habits with POST /api/teams/{id}/habits", http.StatusBadRequest)
+		return
+	}
+
 	if habit.Frequency == "" {
 		habit.Frequency = "daily" // Default to daily
 	}
@@ -151,7 +188,7 @@ func handleCreateHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		habit.TargetCount = 1 // Default to 1
 	}
 
-	err := models.CreateHabit(db, &habit)
+	err := store.CreateHabit(&habit)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create habit: %v", err), http.StatusInternalServerError)
 		return
@@ -161,12 +198,12 @@ func handleCreateHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	json.NewEncoder(w).Encode(habit)
 }
 
-func handleUpdateHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleUpdateHabit(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	// This would need habit ID in the request body or URL
 	http.Error(w, "Use PUT /api/habits/{id} to update a specific habit", http.StatusBadRequest)
 }
 
-func handleUpdateHabitByID(w http.ResponseWriter, r *http.Request, db *sql.DB, habitID int) {
+func handleUpdateHabitByID(w http.ResponseWriter, r *http.Request, store models.HabitStore, habitID int) {
 	var habit models.Habit
 	if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -181,14 +218,14 @@ func handleUpdateHabitByID(w http.ResponseWriter, r *http.Request, db *sql.DB, h
 		return
 	}
 
-	err := models.UpdateHabit(db, &habit)
+	err := store.UpdateHabit(&habit)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update habit: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Get updated habit
-	updatedHabit, err := models.GetHabit(db, habitID)
+	updatedHabit, err := store.GetHabit(habitID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get updated habit: %v", err), http.StatusInternalServerError)
 		return
@@ -197,13 +234,13 @@ func handleUpdateHabitByID(w http.ResponseWriter, r *http.Request, db *sql.DB, h
 	json.NewEncoder(w).Encode(updatedHabit)
 }
 
-func handleDeleteHabit(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleDeleteHabit(w http.ResponseWriter, r *http.Request, store models.HabitStore) {
 	// This would need habit ID in the request body or URL
 	http.Error(w, "Use DELETE /api/habits/{id} to delete a specific habit", http.StatusBadRequest)
 }
 
-func handleDeleteHabitByID(w http.ResponseWriter, r *http.Request, db *sql.DB, habitID int) {
-	err := models.DeleteHabit(db, habitID)
+func handleDeleteHabitByID(w http.ResponseWriter, r *http.Request, store models.HabitStore, habitID int) {
+	err := store.DeleteHabit(habitID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete habit: %v", err), http.StatusInternalServerError)
 		return
@@ -215,3 +252,31 @@ func handleDeleteHabitByID(w http.ResponseWriter, r *http.Request, db *sql.DB, h
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// authorizeHabit checks that the caller may act on a habit. Personal habits are
+// always allowed; team habits require the caller to hold at least role in the
+// team. It returns the calling member's ID, or 0 for personal habits.
+func authorizeHabit(w http.ResponseWriter, r *http.Request, store models.HabitStore, habitID int, role string) (int, bool) {
+	habit, err := store.GetHabit(habitID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return 0, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get habit: %v", err), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if habit.TeamID == 0 {
+		return 0, true
+	}
+
+	member, ok := checkMemberRole(w, r, func(memberID int) (*models.TeamMember, error) {
+		return store.GetTeamMember(habit.TeamID, memberID)
+	}, role)
+	if !ok {
+		return 0, false
+	}
+
+	return member.ID, true
+}
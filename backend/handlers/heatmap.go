@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"habits/database"
+	"habits/models"
+)
+
+// HeatmapChart is a calendar year of daily completions with weekly and
+// monthly summaries
+type HeatmapChart struct {
+	Year    int              `json:"year"`
+	HabitID int              `json:"habit_id,omitempty"`
+	Habit   string           `json:"habit,omitempty"`
+	Total   int              `json:"total"`
+	Days    []HeatmapDayData `json:"days"`
+	Weeks   []HeatmapPeriod  `json:"weeks"` // Monday to Sunday, clipped to the year
+	Months  []HeatmapPeriod  `json:"months"`
+}
+
+// HeatmapDayData is one day of a heatmap chart
+type HeatmapDayData struct {
+	Date      string  `json:"date"` // YYYY-MM-DD
+	Count     int     `json:"count"`
+	Intensity float64 `json:"intensity"` // 0-1
+	Level     int     `json:"level"`     // 0-4, for shading
+	Skipped   bool    `json:"skipped,omitempty"`
+}
+
+// HeatmapPeriod summarizes the days of a heatmap chart from Start to End.
+// Expected counts the completions the habits' targets called for up to
+// today, leaving out holidays and days before a habit was created, and Rate
+// is the percentage of them that were made.
+type HeatmapPeriod struct {
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Completions int     `json:"completions"`
+	ActiveDays  int     `json:"active_days"` // days with at least one completion
+	Expected    float64 `json:"expected"`
+	Rate        float64 `json:"rate"`
+}
+
+// HeatmapChartHandler returns a calendar year of completion intensity at
+// GET /api/charts/heatmap, for one habit with habit or across all habits,
+// for year (default the current one). A completion is worth one period
+// target's share, so a habit done 3 times a week shades a day a third as
+// deeply as a daily habit. All habits' days are shaded relative to the
+// busiest day. All habits are the personal ones, or a team's with team_id;
+// team habits are for members only.
+func HeatmapChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	habitID, ok := queryInt(w, r, "habit", 0)
+	if !ok {
+		return
+	}
+	year, ok := queryInt(w, r, "year", today.Year())
+	if !ok {
+		return
+	}
+	if year < 1970 || year > today.Year()+1 {
+		http.Error(w, fmt.Sprintf("year must be between 1970 and %d", today.Year()+1), http.StatusBadRequest)
+		return
+	}
+
+	teamID := 0
+	if habitID != 0 {
+		if _, ok := authorizeHabit(w, r, store, habitID, models.RoleMember); !ok {
+			return
+		}
+	} else if teamID, ok = chartTeam(w, r, store); !ok {
+		return
+	}
+
+	chart, err := getHeatmapChart(db, habitID, teamID, year, today)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Habit not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get heatmap data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(chart)
+}
+
+// getHeatmapChart builds the heatmap of a year for one habit, or when
+// habitID is 0 for all personal habits or all of a team's. It returns
+// sql.ErrNoRows for an unknown habit.
+func getHeatmapChart(db *sql.DB, habitID, teamID, year int, today time.Time) (*HeatmapChart, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+	days := int(to.Sub(from).Hours() / 24)
+
+	filter := models.CompletionFilter{From: from, To: to.AddDate(0, 0, -1), TeamID: teamID}
+	if habitID != 0 {
+		filter.HabitIDs = []int{habitID}
+	}
+	habits, err := getHabitDays(db, filter, today)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if habitID != 0 {
+		// A habit created after the year has an empty chart, an unknown one none
+		err := db.QueryRow(database.DialectOf(db).Rebind("SELECT name FROM habits WHERE id = ?"), habitID).Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buildHeatmapChart(year, from, days, habits, habitID, name), nil
+}
+
+// buildHeatmapChart shades each day of the year and summarizes its weeks
+// and months
+func buildHeatmapChart(year int, from time.Time, days int, habits []*habitDays, habitID int, name string) *HeatmapChart {
+	chart := &HeatmapChart{Year: year, HabitID: habitID, Habit: name, Days: make([]HeatmapDayData, days)}
+
+	scores := make([]float64, days)
+	peak := 0.0
+	for i := range chart.Days {
+		day := &chart.Days[i]
+		day.Date = from.AddDate(0, 0, i).Format("2006-01-02")
+		for _, h := range habits {
+			day.Count += h.counts[i]
+			scores[i] += math.Min(float64(h.counts[i])/float64(models.PeriodTarget(&h.habit)), 1)
+		}
+		if habitID != 0 && len(habits) == 1 {
+			day.Skipped = habits[0].skip[from.AddDate(0, 0, i)]
+		}
+		chart.Total += day.Count
+		peak = math.Max(peak, scores[i])
+	}
+
+	for i := range chart.Days {
+		switch {
+		case scores[i] == 0:
+		case habitID != 0:
+			chart.Days[i].Intensity = scores[i]
+		default:
+			chart.Days[i].Intensity = scores[i] / peak
+		}
+		chart.Days[i].Level = int(math.Ceil(chart.Days[i].Intensity * 4))
+	}
+
+	chart.Weeks = []HeatmapPeriod{}
+	for start := 0; start < days; {
+		end := start + 7 - (int(from.AddDate(0, 0, start).Weekday())+6)%7 // the next Monday
+		end = min(end, days)
+		chart.Weeks = append(chart.Weeks, summarizeHeatmap(chart, habits, start, end))
+		start = end
+	}
+
+	chart.Months = []HeatmapPeriod{}
+	for month := 0; month < 12; month++ {
+		first := from.AddDate(0, month, 0)
+		start := int(first.Sub(from).Hours() / 24)
+		end := int(first.AddDate(0, 1, 0).Sub(from).Hours() / 24)
+		chart.Months = append(chart.Months, summarizeHeatmap(chart, habits, start, end))
+	}
+
+	return chart
+}
+
+// summarizeHeatmap totals the days [start, end) of a heatmap chart. Each
+// habit's completions count toward the rate up to what it was expected to do.
+func summarizeHeatmap(chart *HeatmapChart, habits []*habitDays, start, end int) HeatmapPeriod {
+	period := HeatmapPeriod{Start: chart.Days[start].Date, End: chart.Days[end-1].Date}
+	for _, day := range chart.Days[start:end] {
+		period.Completions += day.Count
+		if day.Count > 0 {
+			period.ActiveDays++
+		}
+	}
+
+	met := 0.0
+	for _, h := range habits {
+		completed, expected := 0, 0.0
+		for i := start; i < end; i++ {
+			completed += h.counts[i]
+			expected += h.expected[i]
+		}
+		period.Expected += expected
+		met += math.Min(float64(completed), expected)
+	}
+	if period.Expected > 0 {
+		period.Rate = met / period.Expected * 100
+	}
+	period.Expected = math.Round(period.Expected*100) / 100
+
+	return period
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"habits/importers"
+	"habits/models"
+)
+
+// holidayCalendarRequest is the JSON form of a new holiday calendar. Dates
+// is a shorthand for holidays without names.
+type holidayCalendarRequest struct {
+	Name     string           `json:"name"`
+	Holidays []models.Holiday `json:"holidays"`
+	Dates    []string         `json:"dates"`
+}
+
+// HolidaysHandler lists (GET) and creates (POST) holiday calendars at
+// /api/holidays. A calendar is created from an iCalendar file (a
+// text/calendar body, named by the name query parameter or the file's
+// X-WR-CALNAME) or from JSON with a name and holidays or dates.
+func HolidaysHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		calendars, err := models.GetHolidayCalendars(db)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get holiday calendars: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(calendars)
+	case "POST":
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		calendar, err := parseHolidayCalendar(r, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := models.CreateHolidayCalendar(db, calendar); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create holiday calendar: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(calendar)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseHolidayCalendar reads a new calendar from an iCalendar or JSON body
+// and checks its name and dates
+func parseHolidayCalendar(r *http.Request, body []byte) (*models.HolidayCalendar, error) {
+	calendar := &models.HolidayCalendar{Name: r.URL.Query().Get("name")}
+
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\ufeff")))
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/calendar") || bytes.HasPrefix(trimmed, []byte("BEGIN:VCALENDAR")) {
+		name, holidays, err := importers.ParseHolidays(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid calendar file: %v", err)
+		}
+		if calendar.Name == "" {
+			calendar.Name = name
+		}
+		calendar.Holidays = holidays
+	} else {
+		var req holidayCalendarRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("Invalid JSON")
+		}
+		if calendar.Name == "" {
+			calendar.Name = req.Name
+		}
+		calendar.Holidays = req.Holidays
+		for _, date := range req.Dates {
+			calendar.Holidays = append(calendar.Holidays, models.Holiday{Date: date})
+		}
+	}
+
+	calendar.Name = strings.TrimSpace(calendar.Name)
+	if calendar.Name == "" {
+		return nil, fmt.Errorf("Calendar name is required")
+	}
+	if len(calendar.Holidays) == 0 {
+		return nil, fmt.Errorf("At least one holiday is required")
+	}
+	for _, holiday := range calendar.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return nil, fmt.Errorf("Invalid holiday date %q, expected YYYY-MM-DD", holiday.Date)
+		}
+	}
+
+	return calendar, nil
+}
+
+// HolidayDetailHandler shows (GET) or deletes (DELETE) a holiday calendar at
+// /api/holidays/{id}. Deleting it recomputes the streaks of its habits.
+func HolidayDetailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := pathID(strings.TrimSuffix(r.URL.Path, "/"), 3)
+	if !ok {
+		http.Error(w, "Invalid holiday calendar ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		calendar, err := models.GetHolidayCalendar(db, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Holiday calendar not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get holiday calendar: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(calendar)
+	case "DELETE":
+		err := models.DeleteHolidayCalendar(db, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Holiday calendar not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete holiday calendar: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":     "Holiday calendar deleted successfully",
+			"calendar_id": id,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HabitHolidaysHandler gets (GET) or replaces (PUT, with {"calendar_ids": [...]})
+// the holiday calendars whose dates a habit skips, at /api/habits/{id}/holidays
+func HabitHolidaysHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	habitID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+
+	role := models.RoleMember
+	if r.Method != "GET" {
+		role = models.RoleAdmin
+	}
+	if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), habitID, role); !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req struct {
+			CalendarIDs []int `json:"calendar_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		err := models.SetHabitHolidayCalendars(db, habitID, req.CalendarIDs)
+		if err != nil {
+			if err == models.ErrUnknownHolidayCalendar {
+				http.Error(w, "Holiday calendar not found", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to set holiday calendars: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := models.GetHabitHolidayCalendars(db, habitID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get holiday calendars: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"habit_id":     habitID,
+		"calendar_ids": ids,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// TagHolidaysHandler gets (GET) or replaces (PUT, with {"calendar_ids": [...]})
+// the holiday calendars skipped by every habit with a tag, at
+// /api/tags/{tag}/holidays. The tag applies to personal habits, or to a
+// team's with team_id: members may read its calendars and admins set them.
+func TagHolidaysHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[3] != "holidays" {
+		http.NotFound(w, r)
+		return
+	}
+	tags, err := models.NormalizeTags([]string{parts[2]})
+	if err != nil {
+		http.Error(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tag := tags[0]
+
+	teamID, ok := queryInt(w, r, "team_id", 0)
+	if !ok {
+		return
+	}
+	if teamID != 0 {
+		role := models.RoleMember
+		if r.Method != "GET" {
+			role = models.RoleAdmin
+		}
+		if _, ok := requireTeamRole(w, r, db, teamID, role); !ok {
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req struct {
+			CalendarIDs []int `json:"calendar_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		err := models.SetTagHolidayCalendars(db, teamID, tag, req.CalendarIDs)
+		if err != nil {
+			if err == models.ErrUnknownHolidayCalendar {
+				http.Error(w, "Holiday calendar not found", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to set holiday calendars: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := models.GetTagHolidayCalendars(db, teamID, tag)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get holiday calendars: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"tag":          tag,
+		"calendar_ids": ids,
+	}
+	if teamID != 0 {
+		response["team_id"] = teamID
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"habits/models"
+)
+
+// RotationHandler handles the chore rotation of a team habit
+// at /api/teams/{id}/habits/{habit_id}/rotation
+func RotationHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	habitID, ok := pathID(r.URL.Path, 5)
+	if !ok {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+
+	role := models.RoleMember
+	if r.Method != "GET" {
+		role = models.RoleAdmin
+	}
+	if _, ok := requireTeamRole(w, r, db, teamID, role); !ok {
+		return
+	}
+
+	habit, err := models.GetHabit(db, habitID)
+	if err != nil || habit.TeamID != teamID {
+		if err == nil || err == sql.ErrNoRows {
+			http.Error(w, "Habit not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get habit: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		rotation, err := models.GetRotation(db, habitID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Rotation not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get rotation: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(rotation)
+	case "PUT":
+		var rotation models.Rotation
+		if err := json.NewDecoder(r.Body).Decode(&rotation); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if rotation.Strategy == "" {
+			rotation.Strategy = models.RotationRoundRobin // Default to round robin
+		}
+
+		if !models.ValidRotationStrategy(rotation.Strategy) {
+			http.Error(w, "Strategy must be round_robin or least_recent", http.StatusBadRequest)
+			return
+		}
+
+		if len(rotation.MemberIDs) == 0 {
+			http.Error(w, "At least one member is required", http.StatusBadRequest)
+			return
+		}
+
+		seen := make(map[int]bool)
+		for _, memberID := range rotation.MemberIDs {
+			if seen[memberID] {
+				http.Error(w, "Members may only appear once in a rotation", http.StatusBadRequest)
+				return
+			}
+			seen[memberID] = true
+
+			if _, err := models.GetTeamMember(db, teamID, memberID); err != nil {
+				if err == sql.ErrNoRows {
+					http.Error(w, fmt.Sprintf("Member %d is not part of this team", memberID), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Failed to get team member: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := models.SetRotation(db, habit, &rotation); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set rotation: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(rotation)
+	case "DELETE":
+		if err := models.DeleteRotation(db, habitID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete rotation: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":  "Rotation deleted successfully",
+			"habit_id": habitID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AgendaHandler returns a team's habits for a day with their assigned member
+func AgendaHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+		return
+	}
+
+	date := time.Now()
+	if value := r.URL.Query().Get("date"); value != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	agenda, err := models.GetTeamAgenda(db, teamID, date)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get agenda: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(agenda)
+}
+
+// maxFairnessDays limits the date range of fairness statistics, which look
+// up the assignment of every period in it
+const maxFairnessDays = 366
+
+// FairnessHandler returns per-member chore statistics for a date range of at
+// most maxFairnessDays
+func FairnessHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+		return
+	}
+
+	// Default to the last 30 days
+	to := time.Now()
+	from := to.AddDate(0, 0, -29)
+
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		var err error
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		var err error
+		to, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from).Hours()/24 >= maxFairnessDays {
+		http.Error(w, fmt.Sprintf("Range must be at most %d days", maxFairnessDays), http.StatusBadRequest)
+		return
+	}
+
+	fairness, err := models.GetTeamFairness(db, teamID, from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get fairness stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(fairness)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+//go:embed templates/share.html
+var templateFS embed.FS
+
+var shareTemplate = template.Must(template.ParseFS(templateFS, "templates/share.html"))
+
+// heatmapCell is a single day in the rendered share page heatmap
+type heatmapCell struct {
+	Date  string
+	Count int
+	Level int // 0-4 intensity
+}
+
+// sharePage is the data rendered by the share page template
+type sharePage struct {
+	Progress *models.SharedProgress
+	Weeks    [][]heatmapCell
+	Total    int
+}
+
+// ShareLinksHandler manages a habit's share links at /api/habits/{id}/share[/{link_id}]
+func ShareLinksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	habitID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+
+	role := models.RoleMember
+	if r.Method != "GET" {
+		role = models.RoleAdmin
+	}
+	if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), habitID, role); !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		links, err := models.GetShareLinks(db, habitID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get share links: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(links)
+	case "POST":
+		link, err := models.CreateShareLink(db, habitID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create share link: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(link)
+	case "DELETE":
+		linkID, ok := pathID(r.URL.Path, 5)
+		if !ok {
+			http.Error(w, "Invalid share link ID", http.StatusBadRequest)
+			return
+		}
+
+		err := models.RevokeShareLink(db, habitID, linkID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Share link not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to revoke share link: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": "Share link revoked successfully",
+			"link_id": linkID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SharedHabitHandler serves the public progress page of a shared habit at
+// /share/{token}, or its JSON at /share/{token}.json. No auth is required.
+func SharedHabitHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/share/")
+	asJSON := strings.HasSuffix(token, ".json")
+	token = strings.TrimSuffix(token, ".json")
+
+	habit, err := models.GetHabitByShareToken(db, token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Failed to load shared habit", http.StatusInternalServerError)
+		return
+	}
+
+	progress, err := models.GetSharedProgress(db, habit)
+	if err != nil {
+		http.Error(w, "Failed to load shared habit", http.StatusInternalServerError)
+		return
+	}
+
+	// Revalidate on every request so revoking a link takes effect immediately
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(progress)
+		return
+	}
+
+	page := sharePage{Progress: progress, Weeks: heatmapWeeks(progress.Heatmap, habit.TargetCount)}
+	for _, day := range progress.Heatmap {
+		page.Total += day.Count
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := shareTemplate.Execute(w, page); err != nil {
+		http.Error(w, "Failed to render shared habit", http.StatusInternalServerError)
+	}
+}
+
+// heatmapWeeks lays heatmap days out in Monday-first week columns, padding
+// the first week so each row is a weekday
+func heatmapWeeks(days []models.HeatmapDay, target int) [][]heatmapCell {
+	if target < 1 {
+		target = 1
+	}
+
+	var weeks [][]heatmapCell
+	var week []heatmapCell
+	for i, day := range days {
+		if i == 0 {
+			if t, err := time.Parse("2006-01-02", day.Date); err == nil {
+				padding := (int(t.Weekday()) + 6) % 7
+				week = make([]heatmapCell, padding)
+			}
+		}
+
+		level := 0
+		if day.Count > 0 {
+			ratio := math.Min(float64(day.Count)/float64(target), 1)
+			level = int(math.Ceil(ratio * 4))
+		}
+		week = append(week, heatmapCell{Date: day.Date, Count: day.Count, Level: level})
+
+		if len(week) == 7 {
+			weeks = append(weeks, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		weeks = append(weeks, week)
+	}
+
+	return weeks
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// Tracker sheet layout: an A4 landscape page at 96 pixels per inch
+const (
+	sheetWidth      = 1123
+	sheetHeight     = 794
+	sheetMargin     = 36
+	sheetNameWidth  = 220
+	sheetHeaderRows = 2  // day numbers and weekday initials
+	sheetMaxRow     = 28 // row height for short lists, shrunk to fit long ones
+	sheetInk        = "#111827"
+	sheetFaint      = "#d1d5db"
+	sheetWeekend    = "#f3f4f6"
+	sheetOff        = "#e5e7eb" // days a habit is not scheduled on
+)
+
+// sheetMarks are the CSV cell values that complete a habit on a day
+var sheetMarks = map[string]bool{"x": true, "✓": true, "✔": true, "1": true, "y": true, "yes": true}
+
+// sheetImportResult reports what a marked-up sheet import did
+type sheetImportResult struct {
+	Completed   int         `json:"completed"`
+	AlreadyDone int         `json:"already_done"`
+	Skipped     []sheetSkip `json:"skipped"`
+}
+
+// sheetSkip is a marked cell that did not complete a habit
+type sheetSkip struct {
+	Line   int    `json:"line"`
+	Habit  string `json:"habit"`
+	Day    int    `json:"day,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// SheetHandler serves printable monthly tracker sheets at
+// /api/sheets/{YYYY-MM}.svg, with each habit's scheduled days as empty boxes,
+// and the same grid as a CSV template at /api/sheets/{YYYY-MM}.csv. Posting
+// the CSV back with cells marked x completes those days. Personal habits, or
+// a team's with team_id (members only).
+func SheetHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/sheets/")
+	monthText, format, _ := strings.Cut(name, ".")
+	month, err := time.Parse("2006-01", monthText)
+	if err != nil || (format != "svg" && format != "csv") {
+		http.Error(w, "Expected /api/sheets/YYYY-MM.svg or /api/sheets/YYYY-MM.csv", http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" && !(r.Method == "POST" && format == "csv") {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	habits, team, memberID, ok := scopedHabits(w, r, db)
+	if !ok {
+		return
+	}
+
+	sheet, err := models.GetMonthSheet(db, habits, month)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get tracker sheet: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == "POST":
+		importSheet(w, r, db, sheet, memberID)
+	case format == "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Disposition", `inline; filename="habits-`+monthText+`.svg"`)
+		w.Write([]byte(renderSheet(sheet, team)))
+	default:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="habits-`+monthText+`.csv"`)
+		writeSheetCSV(w, sheet)
+	}
+}
+
+// writeSheetCSV writes a sheet as one row per habit and one column per day:
+// blank where the habit is scheduled, x where it is already completed and
+// - where it is not scheduled
+func writeSheetCSV(w io.Writer, sheet *models.MonthSheet) {
+	writer := csv.NewWriter(w)
+	header := []string{"habit_id", "habit"}
+	for day := 1; day <= sheet.Days; day++ {
+		header = append(header, strconv.Itoa(day))
+	}
+	writer.Write(header)
+
+	for _, row := range sheet.Rows {
+		record := []string{strconv.Itoa(row.Habit.ID), row.Habit.Name}
+		for _, cell := range row.Days {
+			switch {
+			case cell.Completed:
+				record = append(record, "x")
+			case cell.Scheduled:
+				record = append(record, "")
+			default:
+				record = append(record, "-")
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
+
+// importSheet completes the marked days of a posted CSV sheet. Rows are
+// matched to habits by habit_id, or by name when it is blank. Marks are only
+// ever added: clearing a cell does not undo a completion.
+func importSheet(w http.ResponseWriter, r *http.Request, db *sql.DB, sheet *models.MonthSheet, memberID int) {
+	w.Header().Set("Content-Type", "application/json")
+
+	reader := csv.NewReader(io.LimitReader(r.Body, maxImportSize))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid CSV: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, "Invalid CSV: missing header", http.StatusBadRequest)
+		return
+	}
+
+	// Day columns are found by their header, so columns may be dropped or reordered
+	idColumn, nameColumn := -1, -1
+	var dayColumns []struct{ column, day int }
+	for i, title := range records[0] {
+		title = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(title, "\ufeff")))
+		switch title {
+		case "habit_id":
+			idColumn = i
+		case "habit":
+			nameColumn = i
+		default:
+			if day, err := strconv.Atoi(title); err == nil && day >= 1 && day <= sheet.Days {
+				dayColumns = append(dayColumns, struct{ column, day int }{i, day})
+			}
+		}
+	}
+	if idColumn < 0 && nameColumn < 0 {
+		http.Error(w, "Invalid CSV: expected a habit_id or habit column", http.StatusBadRequest)
+		return
+	}
+
+	byID := make(map[int]*models.SheetRow)
+	byName := make(map[string]*models.SheetRow)
+	for i := range sheet.Rows {
+		byID[sheet.Rows[i].Habit.ID] = &sheet.Rows[i]
+		byName[strings.ToLower(strings.Join(strings.Fields(sheet.Rows[i].Habit.Name), " "))] = &sheet.Rows[i]
+	}
+
+	cell := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	result := &sheetImportResult{Skipped: []sheetSkip{}}
+	for i, record := range records[1:] {
+		line := i + 2
+		idText, name := cell(record, idColumn), cell(record, nameColumn)
+		var row *models.SheetRow
+		if idText != "" {
+			if id, err := strconv.Atoi(idText); err == nil {
+				row = byID[id]
+			}
+		} else {
+			row = byName[strings.ToLower(strings.Join(strings.Fields(name), " "))]
+		}
+
+		if row != nil {
+			name = row.Habit.Name
+		}
+
+		for _, dc := range dayColumns {
+			if !sheetMarks[strings.ToLower(cell(record, dc.column))] {
+				continue
+			}
+
+			skip := sheetSkip{Line: line, Habit: name, Day: dc.day}
+			date := sheet.Day(dc.day)
+			switch {
+			case row == nil:
+				skip.Reason = "no matching habit"
+			case date.After(today):
+				skip.Reason = "marked in the future"
+			case date.Before(row.Habit.CreatedAt.UTC().Truncate(24 * time.Hour)):
+				skip.Reason = "marked before the habit was created"
+			}
+			if skip.Reason != "" {
+				result.Skipped = append(result.Skipped, skip)
+				continue
+			}
+
+			changed, err := models.SetCompletedOn(db, row.Habit.ID, memberID, date, true)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to import tracker sheet: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if changed {
+				result.Completed++
+			} else {
+				result.AlreadyDone++
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// renderSheet draws a month's tracker grid for printing: a row per habit
+// with its target, a column per day with weekends shaded, and a box to tick
+// on each scheduled day. Completed days are already ticked; holidays and
+// days before a habit existed are greyed out.
+func renderSheet(sheet *models.MonthSheet, team string) string {
+	title := sheet.Month.Format("January 2006")
+	if team != "" {
+		title = team + " · " + title
+	}
+
+	gridLeft := float64(sheetMargin + sheetNameWidth)
+	gridTop := float64(sheetMargin + 40)
+	column := (float64(sheetWidth-sheetMargin) - gridLeft) / float64(sheet.Days)
+	headerHeight := 16.0
+	rowHeight := float64(sheetMaxRow)
+	if rows := len(sheet.Rows); rows > 0 {
+		available := float64(sheetHeight-sheetMargin-30) - gridTop - sheetHeaderRows*headerHeight
+		rowHeight = min(rowHeight, available/float64(rows))
+	}
+	box := min(column, rowHeight) * 0.6
+
+	var s svgWriter
+	fmt.Fprintf(&s, `<svg xmlns="http://www.w3.org/2000/svg" width="297mm" height="210mm" viewBox="0 0 %d %d" font-family="%s" font-size="11">`+"\n",
+		sheetWidth, sheetHeight, chartFont)
+	fmt.Fprintf(&s, "<title>Habit tracker, %s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(&s, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	s.text(sheetMargin, sheetMargin+16, "start", sheetInk, title, `font-size="20" font-weight="600"`)
+
+	gridBottom := gridTop + sheetHeaderRows*headerHeight + rowHeight*float64(len(sheet.Rows))
+	for day := 1; day <= sheet.Days; day++ {
+		date := sheet.Day(day)
+		x := gridLeft + column*float64(day-1)
+		if weekday := date.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+			fmt.Fprintf(&s, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, gridTop, column, gridBottom-gridTop, sheetWeekend)
+		}
+		s.text(x+column/2, gridTop+12, "middle", sheetInk, strconv.Itoa(day), `font-weight="600"`)
+		s.text(x+column/2, gridTop+headerHeight+12, "middle", sheetInk, date.Weekday().String()[:1], `font-size="9"`)
+		if date.Weekday() == time.Monday && day > 1 {
+			s.line(x, gridTop, x, gridBottom, sheetInk) // Week boundary
+		}
+	}
+
+	y := gridTop + sheetHeaderRows*headerHeight
+	s.line(sheetMargin, y, float64(sheetWidth-sheetMargin), y, sheetInk)
+	for _, row := range sheet.Rows {
+		name := row.Habit.Name
+		if runes := []rune(name); len(runes) > 30 {
+			name = string(runes[:29]) + "…"
+		}
+		s.text(sheetMargin+4, y+rowHeight/2+4, "start", sheetInk, name)
+		if target := sheetTarget(&row.Habit); target != "" {
+			s.text(gridLeft-6, y+rowHeight/2+4, "end", "#6b7280", target, `font-size="9"`)
+		}
+
+		for i, cell := range row.Days {
+			cx := gridLeft + column*float64(i) + column/2
+			cy := y + rowHeight/2
+			switch {
+			case cell.Holiday:
+				s.line(cx-box/3, cy, cx+box/3, cy, sheetInk)
+			case !cell.Scheduled:
+				fmt.Fprintf(&s, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n",
+					gridLeft+column*float64(i)+1, y+1, column-2, rowHeight-2, sheetOff)
+			default:
+				fmt.Fprintf(&s, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="2" fill="none" stroke="%s"/>`+"\n",
+					cx-box/2, cy-box/2, box, box, sheetInk)
+				if cell.Completed {
+					fmt.Fprintf(&s, `<path d="M%.1f %.1fL%.1f %.1fL%.1f %.1f" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+						cx-box/3, cy, cx-box/10, cy+box/4, cx+box/3, cy-box/4, sheetInk)
+				}
+			}
+		}
+
+		y += rowHeight
+		s.line(sheetMargin, y, float64(sheetWidth-sheetMargin), y, sheetFaint)
+	}
+
+	if len(sheet.Rows) == 0 {
+		s.text(sheetWidth/2, y+40, "middle", "#6b7280", "No habits to track")
+	}
+	s.text(sheetMargin, sheetHeight-sheetMargin+12, "start", "#6b7280",
+		fmt.Sprintf("Tick each day you complete a habit. Mark the same days with x in habits-%s.csv and upload it to import them.", sheet.Month.Format("2006-01")),
+		`font-size="9"`)
+
+	return s.end()
+}
+
+// sheetTarget describes a habit's target next to its name, if not daily
+func sheetTarget(habit *models.Habit) string {
+	switch {
+	case habit.Frequency == "multiple_times_week" && habit.TargetCount > 1:
+		return fmt.Sprintf("%d× / week", habit.TargetCount)
+	case habit.Frequency != "daily":
+		return "1× / week"
+	}
+	return ""
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"habits/database"
+	"habits/models"
 )
 
 // Stats represents overall statistics
@@ -33,7 +36,7 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	stats, err := calculateStats(db)
+	stats, err := calculateStats(db, 0)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to calculate stats: %v", err), http.StatusInternalServerError)
 		return
@@ -42,8 +45,11 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	json.NewEncoder(w).Encode(stats)
 }
 
-// CompletionRateChartHandler returns data for completion rate charts
-func CompletionRateChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// CompletionRateChartHandler returns completions per day over the last days
+// days (default 30) of personal habits, or a team's with team_id (members
+// only). It is kept for the dashboard; /api/charts/timeseries
+// serves any range, granularity and metric.
+func CompletionRateChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != "GET" {
@@ -51,8 +57,20 @@ func CompletionRateChartHandler(w http.ResponseWriter, r *http.Request, db *sql.
 		return
 	}
 
-	// Get last 30 days of completion data
-	chartData, err := getCompletionRateData(db, 30)
+	days, ok := queryInt(w, r, "days", 30)
+	if !ok {
+		return
+	}
+	if days < 1 || days > maxSeriesDays {
+		http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxSeriesDays), http.StatusBadRequest)
+		return
+	}
+	teamID, ok := chartTeam(w, r, store)
+	if !ok {
+		return
+	}
+
+	chartData, err := getCompletionRateData(db, days, teamID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get completion rate data: %v", err), http.StatusInternalServerError)
 		return
@@ -61,8 +79,9 @@ func CompletionRateChartHandler(w http.ResponseWriter, r *http.Request, db *sql.
 	json.NewEncoder(w).Encode(chartData)
 }
 
-// StreakChartHandler returns data for streak charts
-func StreakChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// StreakChartHandler returns data for streak charts: the current streak of
+// each personal habit, or each of a team's with team_id (members only)
+func StreakChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != "GET" {
@@ -70,8 +89,12 @@ func StreakChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	// Get streak data for all habits
-	chartData, err := getStreakData(db)
+	teamID, ok := chartTeam(w, r, store)
+	if !ok {
+		return
+	}
+
+	chartData, err := getStreakData(db, teamID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get streak data: %v", err), http.StatusInternalServerError)
 		return
@@ -80,42 +103,53 @@ func StreakChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	json.NewEncoder(w).Encode(chartData)
 }
 
-func calculateStats(db *sql.DB) (*Stats, error) {
+// calculateStats computes statistics over personal habits, or over a team's
+// habits when teamID is non-zero
+func calculateStats(db *sql.DB, teamID int) (*Stats, error) {
 	stats := &Stats{}
+	d := database.DialectOf(db)
+
+	// Scope filters for the habits table and tables keyed by habit_id:
+	// personal habits, or a team's
+	habitScope := "team_id IS NULL"
+	completionScope := "habit_id IN (SELECT id FROM habits WHERE team_id IS NULL)"
+	var args []interface{}
+	if teamID != 0 {
+		habitScope = "team_id = ?"
+		completionScope = "habit_id IN (SELECT id FROM habits WHERE team_id = ?)"
+		args = append(args, teamID)
+	}
 
 	// Get total habits
-	err := db.QueryRow("SELECT COUNT(*) FROM habits").Scan(&stats.TotalHabits)
+	err := db.QueryRow(d.Rebind("SELECT COUNT(*) FROM habits WHERE "+habitScope), args...).Scan(&stats.TotalHabits)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get completions today
-	err = db.QueryRow(`
+	err = db.QueryRow(d.Rebind(`
 		SELECT COUNT(*) FROM habit_completions 
-		WHERE DATE(completed_at) = DATE('now')
-	`).Scan(&stats.CompletedToday)
+		WHERE completed_at >= `+d.Today()+` AND `+completionScope), args...).Scan(&stats.CompletedToday)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get total completions
-	err = db.QueryRow("SELECT COUNT(*) FROM habit_completions").Scan(&stats.TotalCompletions)
+	err = db.QueryRow(d.Rebind("SELECT COUNT(*) FROM habit_completions WHERE "+completionScope), args...).Scan(&stats.TotalCompletions)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get average streak
-	err = db.QueryRow(`
-		SELECT COALESCE(AVG(current_streak), 0) FROM habit_streaks
-	`).Scan(&stats.AverageStreak)
+	err = db.QueryRow(d.Rebind(`
+		SELECT COALESCE(AVG(current_streak), 0) FROM habit_streaks WHERE `+completionScope), args...).Scan(&stats.AverageStreak)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get best streak
-	err = db.QueryRow(`
-		SELECT COALESCE(MAX(longest_streak), 0) FROM habit_streaks
-	`).Scan(&stats.BestStreak)
+	err = db.QueryRow(d.Rebind(`
+		SELECT COALESCE(MAX(longest_streak), 0) FROM habit_streaks WHERE `+completionScope), args...).Scan(&stats.BestStreak)
 	if err != nil {
 		return nil, err
 	}
@@ -123,10 +157,9 @@ func calculateStats(db *sql.DB) (*Stats, error) {
 	// Calculate completion rate (last 7 days)
 	if stats.TotalHabits > 0 {
 		var completedLastWeek int
-		err = db.QueryRow(`
+		err = db.QueryRow(d.Rebind(`
 			SELECT COUNT(*) FROM habit_completions 
-			WHERE completed_at >= DATE('now', '-7 days')
-		`).Scan(&completedLastWeek)
+			WHERE completed_at >= `+d.DaysAgo(7)+` AND `+completionScope), args...).Scan(&completedLastWeek)
 		if err != nil {
 			return nil, err
 		}
@@ -141,70 +174,46 @@ func calculateStats(db *sql.DB) (*Stats, error) {
 	return stats, nil
 }
 
-func getCompletionRateData(db *sql.DB, days int) (*ChartData, error) {
-	chartData := &ChartData{
-		Labels: make([]string, days),
-		Data:   make([]float64, days),
-	}
-
-	// Generate labels for the last N days
-	for i := 0; i < days; i++ {
-		date := time.Now().AddDate(0, 0, -i)
-		chartData.Labels[days-1-i] = date.Format("Jan 2")
-	}
-
-	// Get completion data for each day
-	query := `
-		SELECT DATE(completed_at) as date, COUNT(*) as count
-		FROM habit_completions 
-		WHERE completed_at >= DATE('now', '-? days')
-		GROUP BY DATE(completed_at)
-		ORDER BY date
-	`
-
-	rows, err := db.Query(query, days)
+// getCompletionRateData returns completions per day over the last days
+// days of personal habits or a team's, as the daily count series of
+// getTimeSeries
+func getCompletionRateData(db *sql.DB, days, teamID int) (*ChartData, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := models.CompletionFilter{From: today.AddDate(0, 0, -(days - 1)), To: today, TeamID: teamID}
+	series, err := getTimeSeries(db, filter, "day", "count", false, today)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// Create a map to store completion counts by date
-	completionMap := make(map[string]int)
-	for rows.Next() {
-		var date string
-		var count int
-		if err := rows.Scan(&date, &count); err != nil {
-			return nil, err
-		}
-		completionMap[date] = count
-	}
 
-	// Fill in the data array
-	for i := range chartData.Labels {
-		// Convert label back to date format for lookup
-		date := time.Now().AddDate(0, 0, -(days - 1 - i)).Format("2006-01-02")
-		if count, exists := completionMap[date]; exists {
-			chartData.Data[i] = float64(count)
-		} else {
-			chartData.Data[i] = 0
-		}
+	chartData := &ChartData{Labels: make([]string, len(series.Labels)), Data: series.Series[0].Data}
+	for i, label := range series.Labels {
+		date, _ := time.Parse("2006-01-02", label)
+		chartData.Labels[i] = date.Format("Jan 2")
 	}
 
 	return chartData, nil
 }
 
-func getStreakData(db *sql.DB) (*ChartData, error) {
+// getStreakData returns the current streak of each personal habit, or each
+// of a team's habits when teamID is not 0
+func getStreakData(db *sql.DB, teamID int) (*ChartData, error) {
 	chartData := &ChartData{}
 
+	where, args := "h.team_id IS NULL", []interface{}{}
+	if teamID != 0 {
+		where, args = "h.team_id = ?", append(args, teamID)
+	}
+
 	// Get habit names and their current streaks
 	query := `
 		SELECT h.name, COALESCE(hs.current_streak, 0) as current_streak
 		FROM habits h
 		LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
+		WHERE ` + where + `
 		ORDER BY hs.current_streak DESC
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(database.DialectOf(db).Rebind(query), args...)
 	if err != nil {
 		return nil, err
 	}
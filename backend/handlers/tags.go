@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"habits/models"
+)
+
+// HabitTagsHandler gets (GET) or replaces (PUT, with {"tags": [...]}) a
+// habit's tags at /api/habits/{id}/tags. Tags are lowercased and group
+// habits in CSV reports.
+func HabitTagsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	habitID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid habit ID", http.StatusBadRequest)
+		return
+	}
+
+	role := models.RoleMember
+	if r.Method != "GET" {
+		role = models.RoleAdmin
+	}
+	if _, ok := authorizeHabit(w, r, models.NewSQLiteStore(db), habitID, role); !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := models.SetHabitTags(db, habitID, req.Tags); err != nil {
+			if err == models.ErrInvalidTag {
+				http.Error(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to set tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags, err := models.GetHabitTags(db, habitID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"habit_id": habitID,
+		"tags":     tags,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"habits/models"
+)
+
+// MemberHeader identifies the team member making a request
+const MemberHeader = "X-Member-ID"
+
+// teamRequest is the request body for creating a team
+type teamRequest struct {
+	Name      string `json:"name"`
+	OwnerName string `json:"owner_name"`
+}
+
+// TeamStats represents statistics scoped to a team
+type TeamStats struct {
+	Stats
+	Members []models.MemberCompletionCount `json:"members"`
+}
+
+// TeamsHandler handles listing and creating teams
+func TeamsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		teams, err := models.GetTeams(db)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get teams: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(teams)
+	case "POST":
+		handleCreateTeam(w, r, db)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TeamDetailHandler handles individual team operations
+func TeamDetailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+			return
+		}
+
+		team, err := models.GetTeam(db, teamID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get team: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(team)
+	case "DELETE":
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleOwner); !ok {
+			return
+		}
+
+		if err := models.DeleteTeam(db, teamID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete team: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": "Team deleted successfully",
+			"team_id": teamID,
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TeamMembersHandler handles team membership and roles
+func TeamMembersHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+			return
+		}
+
+		members, err := models.GetTeamMembers(db, teamID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get team members: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(members)
+	case "POST":
+		handleAddTeamMember(w, r, db, teamID)
+	case "PUT":
+		handleUpdateTeamMember(w, r, db, teamID)
+	case "DELETE":
+		handleRemoveTeamMember(w, r, db, teamID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TeamHabitsHandler handles habits belonging to a team
+func TeamHabitsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+			return
+		}
+
+		habits, err := models.GetTeamHabits(db, teamID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get team habits: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(habits)
+	case "POST":
+		if _, ok := requireTeamRole(w, r, db, teamID, models.RoleAdmin); !ok {
+			return
+		}
+
+		var habit models.Habit
+		if err := json.NewDecoder(r.Body).Decode(&habit); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Validate required fields
+		if habit.Name == "" {
+			http.Error(w, "Habit name is required", http.StatusBadRequest)
+			return
+		}
+
+		if habit.Frequency == "" {
+			habit.Frequency = "daily" // Default to daily
+		}
+
+		if habit.TargetCount == 0 {
+			habit.TargetCount = 1 // Default to 1
+		}
+
+		habit.TeamID = teamID
+		if err := models.CreateHabit(db, &habit); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create habit: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(habit)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TeamStatsHandler returns statistics for a team's habits
+func TeamStatsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, ok := pathID(r.URL.Path, 3)
+	if !ok {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := requireTeamRole(w, r, db, teamID, models.RoleMember); !ok {
+		return
+	}
+
+	stats, err := calculateStats(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to calculate stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	members, err := models.GetMemberCompletionCounts(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to calculate member stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(TeamStats{Stats: *stats, Members: members})
+}
+
+func handleCreateTeam(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if req.Name == "" {
+		http.Error(w, "Team name is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.OwnerName == "" {
+		http.Error(w, "Owner name is required", http.StatusBadRequest)
+		return
+	}
+
+	team := models.Team{Name: req.Name}
+	owner := models.TeamMember{Name: req.OwnerName}
+	if err := models.CreateTeam(db, &team, &owner); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create team: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(team)
+}
+
+func handleAddTeamMember(w http.ResponseWriter, r *http.Request, db *sql.DB, teamID int) {
+	caller, ok := requireTeamRole(w, r, db, teamID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var member models.TeamMember
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if member.Name == "" {
+		http.Error(w, "Member name is required", http.StatusBadRequest)
+		return
+	}
+
+	if member.Role == "" {
+		member.Role = models.RoleMember
+	}
+
+	if !models.ValidRole(member.Role) {
+		http.Error(w, "Role must be owner, admin or member", http.StatusBadRequest)
+		return
+	}
+
+	// Only owners may grant admin or owner roles
+	if member.Role != models.RoleMember && !caller.HasRole(models.RoleOwner) {
+		http.Error(w, "Only owners can grant this role", http.StatusForbidden)
+		return
+	}
+
+	member.TeamID = teamID
+	if err := models.AddTeamMember(db, &member); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add team member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+func handleUpdateTeamMember(w http.ResponseWriter, r *http.Request, db *sql.DB, teamID int) {
+	// Only owners may change roles
+	if _, ok := requireTeamRole(w, r, db, teamID, models.RoleOwner); !ok {
+		return
+	}
+
+	target, ok := loadTeamMember(w, r, db, teamID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !models.ValidRole(req.Role) {
+		http.Error(w, "Role must be owner, admin or member", http.StatusBadRequest)
+		return
+	}
+
+	if target.Role == models.RoleOwner && req.Role != models.RoleOwner {
+		if !ensureAnotherOwner(w, db, teamID) {
+			return
+		}
+	}
+
+	if err := models.UpdateTeamMemberRole(db, teamID, target.ID, req.Role); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update team member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	target.Role = req.Role
+	json.NewEncoder(w).Encode(target)
+}
+
+func handleRemoveTeamMember(w http.ResponseWriter, r *http.Request, db *sql.DB, teamID int) {
+	caller, ok := requireTeamRole(w, r, db, teamID, models.RoleMember)
+	if !ok {
+		return
+	}
+
+	target, ok := loadTeamMember(w, r, db, teamID)
+	if !ok {
+		return
+	}
+
+	// Members may leave on their own; removing others needs a higher role
+	if target.ID != caller.ID {
+		if !caller.HasRole(models.RoleAdmin) || (target.HasRole(models.RoleAdmin) && !caller.HasRole(models.RoleOwner)) {
+			http.Error(w, "Insufficient role to remove this member", http.StatusForbidden)
+			return
+		}
+	}
+
+	if target.Role == models.RoleOwner && !ensureAnotherOwner(w, db, teamID) {
+		return
+	}
+
+	if err := models.RemoveTeamMember(db, teamID, target.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to remove team member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Team member removed successfully",
+		"member_id": target.ID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// requireTeamRole resolves the calling member from the X-Member-ID header and
+// checks they hold at least role in the team, writing the error response if not
+func requireTeamRole(w http.ResponseWriter, r *http.Request, db *sql.DB, teamID int, role string) (*models.TeamMember, bool) {
+	if _, err := models.GetTeam(db, teamID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Team not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get team: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return checkMemberRole(w, r, func(memberID int) (*models.TeamMember, error) {
+		return models.GetTeamMember(db, teamID, memberID)
+	}, role)
+}
+
+// checkMemberRole resolves the calling member from the X-Member-ID header with
+// lookup and checks they hold at least role, writing the error response if not
+func checkMemberRole(w http.ResponseWriter, r *http.Request, lookup func(memberID int) (*models.TeamMember, error), role string) (*models.TeamMember, bool) {
+	memberID, err := strconv.Atoi(r.Header.Get(MemberHeader))
+	if err != nil {
+		http.Error(w, MemberHeader+" header is required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	member, err := lookup(memberID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			http.Error(w, "Not a member of this team", http.StatusForbidden)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get team member: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !member.HasRole(role) {
+		http.Error(w, "Insufficient role for this action", http.StatusForbidden)
+		return nil, false
+	}
+
+	return member, true
+}
+
+// loadTeamMember loads the member addressed by /api/teams/{id}/members/{member_id}
+func loadTeamMember(w http.ResponseWriter, r *http.Request, db *sql.DB, teamID int) (*models.TeamMember, bool) {
+	memberID, ok := pathID(r.URL.Path, 5)
+	if !ok {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	member, err := models.GetTeamMember(db, teamID, memberID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Team member not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("Failed to get team member: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return member, true
+}
+
+// ensureAnotherOwner prevents a team from losing its last owner
+func ensureAnotherOwner(w http.ResponseWriter, db *sql.DB, teamID int) bool {
+	owners, err := models.CountTeamOwners(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count team owners: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	if owners <= 1 {
+		http.Error(w, "A team must keep at least one owner", http.StatusConflict)
+		return false
+	}
+
+	return true
+}
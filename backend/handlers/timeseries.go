@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/database"
+	"habits/models"
+)
+
+// maxSeriesDays limits the range of a time series
+const maxSeriesDays = 3 * 366
+
+// TimeSeries is completion data bucketed by day, week or month
+type TimeSeries struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Granularity string   `json:"granularity"`
+	Metric      string   `json:"metric"`
+	Labels      []string `json:"labels"` // first day of each period, YYYY-MM-DD
+	Series      []Series `json:"series"`
+}
+
+// Series is one line of a time series: all habits together, or one habit
+type Series struct {
+	HabitID int       `json:"habit_id,omitempty"`
+	Name    string    `json:"name"`
+	Data    []float64 `json:"data"`
+}
+
+// habitDays is a habit's completions, their total value and expected
+// completions per day of a date range
+type habitDays struct {
+	habit    models.Habit
+	counts   []int
+	values   []float64
+	expected []float64
+	skip     map[time.Time]bool // holidays
+}
+
+// TimeSeriesChartHandler returns completions over time at
+// GET /api/charts/timeseries. from and to (YYYY-MM-DD, inclusive) default to
+// the last 30 days; granularity is day, week (from Monday) or month; metric
+// is count (completions), rate (the percentage of the completions the
+// habits' targets called for) or value (the sum of the completions' values,
+// those without one counting nothing). series=habit splits the data into a
+// series per habit.
+// The series cover personal habits, or a team's with team_id; habit_id
+// (repeatable or comma-separated) selects habits. Team habits are for
+// members only.
+func TimeSeriesChartHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := models.CompletionFilter{From: today.AddDate(0, 0, -29), To: today}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(bound.name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s date, expected YYYY-MM-DD", bound.name), http.StatusBadRequest)
+				return
+			}
+			*bound.date = date
+		}
+	}
+	if filter.To.Before(filter.From) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if filter.To.Sub(filter.From).Hours()/24 >= maxSeriesDays {
+		http.Error(w, fmt.Sprintf("Range must be at most %d days", maxSeriesDays), http.StatusBadRequest)
+		return
+	}
+
+	options := map[string]string{"granularity": "day", "metric": "count", "series": "total"}
+	allowed := map[string][]string{
+		"granularity": {"day", "week", "month"},
+		"metric":      {"count", "rate", "value"},
+		"series":      {"total", "habit"},
+	}
+	for name, values := range allowed {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		valid := false
+		for _, v := range values {
+			valid = valid || v == value
+		}
+		if !valid {
+			http.Error(w, fmt.Sprintf("Invalid %s (must be %s or %s)", name, strings.Join(values[:len(values)-1], ", "), values[len(values)-1]), http.StatusBadRequest)
+			return
+		}
+		options[name] = value
+	}
+
+	for _, value := range query["habit_id"] {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid habit_id", http.StatusBadRequest)
+				return
+			}
+			if _, ok := authorizeHabit(w, r, store, id, models.RoleMember); !ok {
+				return
+			}
+			filter.HabitIDs = append(filter.HabitIDs, id)
+		}
+	}
+	teamID, ok := chartTeam(w, r, store)
+	if !ok {
+		return
+	}
+	filter.TeamID = teamID
+
+	series, err := getTimeSeries(db, filter, options["granularity"], options["metric"], options["series"] == "habit", today)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get time series: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(series)
+}
+
+// getTimeSeries buckets the completions of the habits selected by filter
+// over [filter.From, filter.To] into periods of granularity, as one series
+// or one per habit
+func getTimeSeries(db *sql.DB, filter models.CompletionFilter, granularity, metric string, perHabit bool, today time.Time) (*TimeSeries, error) {
+	habits, err := getHabitDays(db, filter, today)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &TimeSeries{
+		From:        filter.From.Format("2006-01-02"),
+		To:          filter.To.Format("2006-01-02"),
+		Granularity: granularity,
+		Metric:      metric,
+		Labels:      []string{},
+		Series:      []Series{},
+	}
+
+	// Periods as [start, end) day offsets, the first and last clipped to the range
+	days := int(filter.To.Sub(filter.From).Hours()/24) + 1
+	var periods [][2]int
+	for start := 0; start < days; {
+		date := filter.From.AddDate(0, 0, start)
+		var next time.Time
+		switch granularity {
+		case "week":
+			next = models.PeriodStart("weekly", date).AddDate(0, 0, 7)
+		case "month":
+			next = time.Date(date.Year(), date.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		default:
+			next = date.AddDate(0, 0, 1)
+		}
+		end := min(int(next.Sub(filter.From).Hours()/24), days)
+		periods = append(periods, [2]int{start, end})
+		series.Labels = append(series.Labels, date.Format("2006-01-02"))
+		start = end
+	}
+
+	groups := [][]*habitDays{habits}
+	if perHabit {
+		groups = nil
+		for _, h := range habits {
+			groups = append(groups, []*habitDays{h})
+		}
+	}
+	for _, group := range groups {
+		line := Series{Name: "All habits", Data: make([]float64, len(periods))}
+		if perHabit {
+			line.HabitID, line.Name = group[0].habit.ID, group[0].habit.Name
+		}
+
+		for i, period := range periods {
+			completed, value, met, expected := 0, 0.0, 0.0, 0.0
+			for _, h := range group {
+				habitCompleted, habitExpected := 0, 0.0
+				for day := period[0]; day < period[1]; day++ {
+					habitCompleted += h.counts[day]
+					habitExpected += h.expected[day]
+					value += h.values[day]
+				}
+				completed += habitCompleted
+				expected += habitExpected
+				met += math.Min(float64(habitCompleted), habitExpected)
+			}
+
+			switch metric {
+			case "rate":
+				if expected > 0 {
+					line.Data[i] = met / expected * 100
+				}
+			case "value":
+				line.Data[i] = value
+			default:
+				line.Data[i] = float64(completed)
+			}
+		}
+		series.Series = append(series.Series, line)
+	}
+
+	return series, nil
+}
+
+// habitsWhere returns the condition on the habits table selected by filter,
+// leaving out habits created after filter.To. Without HabitIDs or a TeamID
+// it selects personal habits.
+func habitsWhere(filter models.CompletionFilter) (string, []interface{}) {
+	conditions := []string{"created_at < ?"}
+	args := []interface{}{filter.To.AddDate(0, 0, 1).Format("2006-01-02")}
+
+	if len(filter.HabitIDs) > 0 {
+		conditions = append(conditions, "id IN (?"+strings.Repeat(", ?", len(filter.HabitIDs)-1)+")")
+		for _, id := range filter.HabitIDs {
+			args = append(args, id)
+		}
+	}
+	if filter.TeamID != 0 {
+		conditions = append(conditions, "team_id = ?")
+		args = append(args, filter.TeamID)
+	} else if len(filter.HabitIDs) == 0 {
+		conditions = append(conditions, "team_id IS NULL")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// getHabitDays loads the habits selected by filter with their completions,
+// completion values and expected completions on each day of [filter.From,
+// filter.To]. A day's expectation is 1 for a daily habit and a weekly
+// habit's target spread over its week; holidays, days before a habit was
+// created and days after today expect nothing.
+func getHabitDays(db *sql.DB, filter models.CompletionFilter, today time.Time) ([]*habitDays, error) {
+	d := database.DialectOf(db)
+	from, to := filter.From, filter.To.AddDate(0, 0, 1)
+	days := int(to.Sub(from).Hours() / 24)
+
+	where, args := habitsWhere(filter)
+	rows, err := db.Query(d.Rebind("SELECT id, name, frequency, target_count, created_at FROM habits WHERE "+where+" ORDER BY id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var habits []*habitDays
+	byID := make(map[int]*habitDays)
+	for rows.Next() {
+		h := &habitDays{counts: make([]int, days), values: make([]float64, days), expected: make([]float64, days)}
+		if err := rows.Scan(&h.habit.ID, &h.habit.Name, &h.habit.Frequency, &h.habit.TargetCount, &h.habit.CreatedAt); err != nil {
+			return nil, err
+		}
+		habits = append(habits, h)
+		byID[h.habit.ID] = h
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(habits) == 0 {
+		return nil, nil
+	}
+
+	// Holidays are read from the weeks around the range too, as the targets
+	// of its first and last weeks depend on them
+	skip, err := getSkipDays(db, where, args, from.AddDate(0, 0, -7), to.AddDate(0, 0, 7))
+	if err != nil {
+		return nil, err
+	}
+
+	day := d.Date("completed_at")
+	rows, err = db.Query(d.Rebind(`
+		SELECT habit_id, CAST(`+day+` AS TEXT), COUNT(*), COALESCE(SUM(value), 0)
+		FROM habit_completions
+		WHERE habit_id IN (SELECT id FROM habits WHERE `+where+`) AND completed_at >= ? AND completed_at < ?
+		GROUP BY habit_id, `+day), append(append([]interface{}{}, args...), from.Format("2006-01-02"), to.Format("2006-01-02"))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var value float64
+		var date string
+		if err := rows.Scan(&id, &date, &count, &value); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", date[:min(len(date), 10)])
+		if err != nil {
+			return nil, err
+		}
+		if h := byID[id]; h != nil {
+			i := int(t.Sub(from).Hours() / 24)
+			h.counts[i] += count
+			h.values[i] += value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, h := range habits {
+		h.skip = skip[h.habit.ID]
+		created := h.habit.CreatedAt.UTC().Truncate(24 * time.Hour)
+		target := models.PeriodTarget(&h.habit)
+		for i := range h.expected {
+			date := from.AddDate(0, 0, i)
+			if date.Before(created) || date.After(today) || h.skip[date] {
+				continue
+			}
+			if h.habit.Frequency == "daily" {
+				h.expected[i] = 1
+				continue
+			}
+
+			// Spread a weekly target over the week's working days
+			week := models.PeriodStart("weekly", date)
+			working := 0
+			for other := week; other.Before(week.AddDate(0, 0, 7)); other = other.AddDate(0, 0, 1) {
+				if !h.skip[other] {
+					working++
+				}
+			}
+			h.expected[i] = float64(models.WeekTarget(target, week, h.skip)) / float64(working)
+		}
+	}
+
+	return habits, nil
+}
+
+// getSkipDays returns the holidays over [from, to) of the habits matching
+// where, by habit
+func getSkipDays(db *sql.DB, where string, args []interface{}, from, to time.Time) (map[int]map[time.Time]bool, error) {
+	rows, err := db.Query(database.DialectOf(db).Rebind(`
+		SELECT DISTINCT hc.habit_id, hd.date
+		FROM `+models.HabitCalendarLinks+` hc
+		JOIN holidays hd ON hd.calendar_id = hc.calendar_id
+		WHERE hc.habit_id IN (SELECT id FROM habits WHERE `+where+`) AND hd.date >= ? AND hd.date < ?
+	`), append(append([]interface{}{}, args...), from.Format("2006-01-02"), to.Format("2006-01-02"))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skip := make(map[int]map[time.Time]bool)
+	for rows.Next() {
+		var id int
+		var date time.Time
+		if err := rows.Scan(&id, &date); err != nil {
+			return nil, err
+		}
+		if skip[id] == nil {
+			skip[id] = make(map[time.Time]bool)
+		}
+		skip[id][date.UTC().Truncate(24*time.Hour)] = true
+	}
+
+	return skip, rows.Err()
+}
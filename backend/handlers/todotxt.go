@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"habits/models"
+	"habits/todotxt"
+)
+
+// TodoTxtHandler serves the habits due today as todo.txt tasks at
+// GET /api/todo.txt: personal habits, or a team's with team_id (members only)
+func TodoTxtHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	habits, team, _, ok := scopedHabits(w, r, db)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	todotxt.Write(w, habits, team, time.Now().UTC())
+}
+
+// DoneTxtHandler completes habits from the completed ("x") tasks of a
+// done.txt or todo.txt body at POST /api/done.txt, on their completion
+// dates. With team_id, the team's habits are completed as the calling member.
+func DoneTxtHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	habits, _, memberID, ok := scopedHabits(w, r, db)
+	if !ok {
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	tasks, err := todotxt.ParseDone(io.LimitReader(r.Body, maxImportSize), today)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid done.txt: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := todotxt.Import(db, tasks, habits, memberID, today)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import done.txt: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// scopedHabits returns the habits a request works on: personal habits, or
+// with team_id the team's habits along with the team name and the calling
+// member, who must belong to the team
+func scopedHabits(w http.ResponseWriter, r *http.Request, db *sql.DB) ([]models.Habit, string, int, bool) {
+	teamID, ok := queryInt(w, r, "team_id", 0)
+	if !ok {
+		return nil, "", 0, false
+	}
+
+	if teamID == 0 {
+		habits, err := models.GetPersonalHabits(db)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get habits: %v", err), http.StatusInternalServerError)
+			return nil, "", 0, false
+		}
+		return habits, "", 0, true
+	}
+
+	member, ok := requireTeamRole(w, r, db, teamID, models.RoleMember)
+	if !ok {
+		return nil, "", 0, false
+	}
+
+	team, err := models.GetTeam(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get team: %v", err), http.StatusInternalServerError)
+		return nil, "", 0, false
+	}
+	habits, err := models.GetTeamHabits(db, teamID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get team habits: %v", err), http.StatusInternalServerError)
+		return nil, "", 0, false
+	}
+
+	return habits, team.Name, member.ID, true
+}
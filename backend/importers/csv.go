@@ -0,0 +1,185 @@
+package importers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// dateLayouts are tried in order when a CSV import has no date format
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// dateTokens translate a date format such as DD/MM/YYYY into a Go layout
+var dateTokens = strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02", "HH", "15", "mm", "04", "ss", "05")
+
+// completedValues are the values of a completed column that count as done
+var completedValues = map[string]bool{"1": true, "true": true, "yes": true, "y": true, "x": true, "done": true, "✓": true}
+
+// CSVImporter reads a CSV file with one row per completion. Columns are
+// matched by header name, case-insensitively.
+type CSVImporter struct {
+	Habit       string // habit name column
+	Date        string // completion date or time column
+	DateFormat  string // e.g. DD/MM/YYYY; common formats are detected when empty
+	Completed   string // optional column; rows count only when it holds a yes value
+	Description string // optional habit description column
+	Frequency   string // optional habit frequency column
+	Delimiter   rune
+}
+
+// NewCSVImporter builds a CSV importer from options named after its fields
+// (habit, date, date_format, completed, description, frequency, delimiter).
+// The habit and date columns default to "habit" and "date".
+func NewCSVImporter(options url.Values) (*CSVImporter, error) {
+	importer := &CSVImporter{
+		Habit:       options.Get("habit"),
+		Date:        options.Get("date"),
+		DateFormat:  options.Get("date_format"),
+		Completed:   options.Get("completed"),
+		Description: options.Get("description"),
+		Frequency:   options.Get("frequency"),
+		Delimiter:   ',',
+	}
+	if importer.Habit == "" {
+		importer.Habit = "habit"
+	}
+	if importer.Date == "" {
+		importer.Date = "date"
+	}
+
+	switch delimiter := options.Get("delimiter"); delimiter {
+	case "", ",", "comma":
+	case ";", "semicolon":
+		importer.Delimiter = ';'
+	case "\t", "tab":
+		importer.Delimiter = '\t'
+	default:
+		return nil, fmt.Errorf("unsupported delimiter %q (available: comma, semicolon, tab)", delimiter)
+	}
+
+	return importer, nil
+}
+
+// Parse implements Importer
+func (c *CSVImporter) Parse(r io.Reader) (*models.Export, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = c.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+
+	columns := columnIndex(header)
+	for _, name := range []string{c.Habit, c.Date, c.Completed, c.Description, c.Frequency} {
+		if _, ok := columns[strings.ToLower(name)]; name != "" && !ok {
+			return nil, fmt.Errorf("CSV has no %q column", name)
+		}
+	}
+
+	b := newBuilder()
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		name := field(row, columns, c.Habit)
+		if name == "" {
+			continue
+		}
+		h := b.habit(name)
+		if description := field(row, columns, c.Description); description != "" {
+			h.Description = description
+		}
+		if frequency := field(row, columns, c.Frequency); frequency != "" {
+			h.Frequency = frequency
+		}
+
+		if c.Completed != "" && !completedValues[strings.ToLower(field(row, columns, c.Completed))] {
+			continue
+		}
+
+		value := field(row, columns, c.Date)
+		completedAt, err := c.parseDate(value)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: invalid date %q", line, value)
+		}
+		b.complete(name, completedAt)
+	}
+
+	return b.export(), nil
+}
+
+// parseDate parses a date column value. Dates without a time are placed at noon.
+func (c *CSVImporter) parseDate(value string) (time.Time, error) {
+	layouts := dateLayouts
+	if c.DateFormat != "" {
+		layouts = []string{dateTokens.Replace(c.DateFormat)}
+	}
+
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(layout, "15") {
+			t = atNoon(t)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+// readCSV reads all rows of a comma-separated file, allowing ragged rows and
+// a byte order mark
+func readCSV(data []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// columnIndex maps lower-cased, trimmed header names to their positions,
+// ignoring a byte order mark before the first
+func columnIndex(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	return columns
+}
+
+// field returns the trimmed value of the named column in row, or "" if the
+// column is missing
+func field(row []string, columns map[string]int, name string) string {
+	i, ok := columns[strings.ToLower(name)]
+	if name == "" || !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
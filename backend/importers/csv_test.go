@@ -0,0 +1,81 @@
+package importers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	importer, err := NewCSVImporter(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, err := importer.Parse(strings.NewReader("\ufeffHabit,Date\n" +
+		"Read,2024-03-02\n" +
+		"Read,2024-03-01 21:30:00\n" +
+		"Walk,2024-03-01T07:00:00Z\n" +
+		",2024-03-01\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(export.Habits) != 2 {
+		t.Fatalf("habits = %+v, want Read and Walk", export.Habits)
+	}
+	read, walk := export.Habits[0], export.Habits[1]
+	if read.Name != "Read" || days(read) != "2024-03-01,2024-03-02" {
+		t.Errorf("Read = %q on %s, want 2024-03-01,2024-03-02", read.Name, days(read))
+	}
+	if at := read.Completions[0].CompletedAt; at.Hour() != 21 || read.Completions[1].CompletedAt.Hour() != 12 {
+		t.Errorf("Read completions at %v, want the given time and noon for a bare date", read.Completions)
+	}
+	if walk.Name != "Walk" || days(walk) != "2024-03-01" {
+		t.Errorf("Walk = %q on %s, want 2024-03-01", walk.Name, days(walk))
+	}
+}
+
+func TestCSVOptions(t *testing.T) {
+	importer, err := NewCSVImporter(url.Values{
+		"habit": {"Task"}, "date": {"Day"}, "date_format": {"DD/MM/YYYY"},
+		"completed": {"Done"}, "description": {"Notes"}, "frequency": {"How often"}, "delimiter": {"semicolon"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, err := importer.Parse(strings.NewReader("Task;Day;Done;Notes;How often\n" +
+		"Gym;04/03/2024;yes;Legs;weekly\n" +
+		"Gym;05/03/2024;no;;\n" +
+		"Gym;06/03/2024;x;;\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(export.Habits) != 1 {
+		t.Fatalf("habits = %+v, want Gym", export.Habits)
+	}
+	gym := export.Habits[0]
+	if gym.Description != "Legs" || gym.Frequency != "weekly" || days(gym) != "2024-03-04,2024-03-06" {
+		t.Errorf("Gym = %+v, want a weekly habit described and completed on the yes rows", gym)
+	}
+}
+
+func TestCSVRejectsInvalidInput(t *testing.T) {
+	importer, err := NewCSVImporter(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, input := range map[string]string{
+		"empty":          "",
+		"missing column": "Name,Date\nRead,2024-03-01\n",
+		"bad date":       "Habit,Date\nRead,March 1st\n",
+	} {
+		if _, err := importer.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+
+	if _, err := NewCSVImporter(url.Values{"delimiter": {"|"}}); err == nil {
+		t.Error("NewCSVImporter with delimiter | succeeded, want an error")
+	}
+}
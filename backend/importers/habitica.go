@@ -0,0 +1,122 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"habits/models"
+)
+
+// habiticaExport is the part of Habitica's user data export we read
+type habiticaExport struct {
+	Tasks struct {
+		Habits []habiticaTask `json:"habits"`
+		Dailys []habiticaTask `json:"dailys"`
+	} `json:"tasks"`
+}
+
+// habiticaTask is a habit or daily in a Habitica export
+type habiticaTask struct {
+	Text      string          `json:"text"`
+	Notes     string          `json:"notes"`
+	Up        bool            `json:"up"`        // habits: can be scored positively
+	Frequency string          `json:"frequency"` // dailies: daily, weekly, monthly, yearly
+	EveryX    int             `json:"everyX"`
+	Repeat    map[string]bool `json:"repeat"` // dailies: weekdays it is due on
+	CreatedAt time.Time       `json:"createdAt"`
+	History   []struct {
+		Date      habiticaTime `json:"date"`
+		ScoredUp  int          `json:"scoredUp"`  // habits
+		Completed bool         `json:"completed"` // dailies
+	} `json:"history"`
+}
+
+// habiticaTime is a history timestamp, in milliseconds since the epoch or
+// (in some exports) an ISO 8601 string
+type habiticaTime struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *habiticaTime) UnmarshalJSON(data []byte) error {
+	var millis float64
+	if err := json.Unmarshal(data, &millis); err == nil {
+		t.Time = time.UnixMilli(int64(millis)).UTC()
+		return nil
+	}
+	return json.Unmarshal(data, &t.Time)
+}
+
+// HabiticaImporter reads Habitica's JSON user data export. Positive habits
+// and dailies are imported; a habit counts as completed on days it was
+// scored up and a daily on days it was checked off. Older history entries
+// without that information are skipped. To-dos and rewards are ignored.
+type HabiticaImporter struct{}
+
+// Parse implements Importer
+func (HabiticaImporter) Parse(r io.Reader) (*models.Export, error) {
+	var data habiticaExport
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid Habitica export: %v", err)
+	}
+
+	b := newBuilder()
+	for _, task := range data.Tasks.Habits {
+		if !task.Up || task.Text == "" {
+			continue
+		}
+		h := b.habit(task.Text)
+		h.Description = task.Notes
+		h.CreatedAt = task.CreatedAt
+		for _, entry := range task.History {
+			if entry.ScoredUp > 0 {
+				b.complete(task.Text, entry.Date.Time)
+			}
+		}
+	}
+
+	for _, task := range data.Tasks.Dailys {
+		if task.Text == "" {
+			continue
+		}
+		h := b.habit(task.Text)
+		h.Description = task.Notes
+		h.CreatedAt = task.CreatedAt
+		h.Frequency, h.TargetCount = frequencyFor(task.timesPerWeek())
+		for _, entry := range task.History {
+			if entry.Completed {
+				b.complete(task.Text, entry.Date.Time)
+			}
+		}
+	}
+
+	return b.export(), nil
+}
+
+// timesPerWeek approximates how often a daily is due in a week
+func (t habiticaTask) timesPerWeek() int {
+	everyX := t.EveryX
+	if everyX < 1 {
+		everyX = 1
+	}
+
+	switch t.Frequency {
+	case "daily":
+		return 7 / everyX
+	case "weekly":
+		days := 0
+		for _, due := range t.Repeat {
+			if due {
+				days++
+			}
+		}
+		if everyX > 1 {
+			return 1
+		}
+		return days
+	default: // monthly and yearly dailies are rarer than weekly
+		return 1
+	}
+}
@@ -0,0 +1,60 @@
+package importers
+
+import (
+	"strings"
+	"testing"
+
+	"habits/models"
+)
+
+const habiticaSample = `{
+	"tasks": {
+		"habits": [
+			{"text": "Drink water", "notes": "8 glasses", "up": true, "createdAt": "2024-01-01T08:00:00.000Z",
+			 "history": [{"date": 1709290800000, "scoredUp": 2}, {"date": 1709377200000, "scoredUp": 0, "scoredDown": 1}]},
+			{"text": "Snack", "up": false, "history": [{"date": 1709290800000, "scoredUp": 1}]}
+		],
+		"dailys": [
+			{"text": "Stretch", "frequency": "weekly", "everyX": 1,
+			 "repeat": {"m": true, "t": false, "w": true, "th": false, "f": true, "s": false, "su": false},
+			 "history": [{"date": "2024-03-04T07:00:00Z", "completed": true}, {"date": "2024-03-05T07:00:00Z", "completed": false}]},
+			{"text": "Journal", "frequency": "daily", "everyX": 1, "history": []}
+		]
+	}
+}`
+
+func TestHabitica(t *testing.T) {
+	export, err := HabiticaImporter{}.Parse(strings.NewReader(habiticaSample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := models.ValidateExport(export); err != nil {
+		t.Fatalf("ValidateExport: %v", err)
+	}
+
+	// Negative habits are left out
+	var names []string
+	for _, h := range export.Habits {
+		names = append(names, h.Name)
+	}
+	if got := strings.Join(names, ","); got != "Drink water,Stretch,Journal" {
+		t.Fatalf("habits = %s, want Drink water,Stretch,Journal", got)
+	}
+
+	water, stretch, journal := export.Habits[0], export.Habits[1], export.Habits[2]
+	if water.Description != "8 glasses" || days(water) != "2024-03-01" || water.CreatedAt.Year() != 2024 {
+		t.Errorf("Drink water = %+v, want described, created in 2024 and completed on 2024-03-01", water)
+	}
+	if stretch.Frequency != "multiple_times_week" || stretch.TargetCount != 3 || days(stretch) != "2024-03-04" {
+		t.Errorf("Stretch = %+v, want three times a week, completed on 2024-03-04", stretch)
+	}
+	if journal.Frequency != "daily" || len(journal.Completions) != 0 {
+		t.Errorf("Journal = %+v, want a daily habit without completions", journal)
+	}
+}
+
+func TestHabiticaRejectsInvalidJSON(t *testing.T) {
+	if _, err := (HabiticaImporter{}).Parse(strings.NewReader(`{"tasks": [`)); err == nil {
+		t.Error("Parse succeeded, want an error")
+	}
+}
@@ -0,0 +1,213 @@
+package importers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// Holiday calendar parsing limits
+const (
+	maxHolidaySpan       = 31 // days a single event may cover
+	holidayRecurrenceEnd = 5  // years after the current one that yearly events repeat through
+)
+
+// ParseHolidays reads the all-day events of an iCalendar (.ics) file as
+// holidays, returning them in date order with the calendar's name
+// (X-WR-CALNAME), if any. Multi-day events cover each of their days and
+// yearly recurring events are expanded.
+func ParseHolidays(r io.Reader) (string, []models.Holiday, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var name string
+	var event map[string]string
+	byDate := make(map[string]string)
+	for i, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		property, _, _ := strings.Cut(key, ";")
+		property = strings.ToUpper(property)
+
+		switch {
+		case property == "X-WR-CALNAME" && event == nil:
+			name = icalUnescape(value)
+		case property == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = make(map[string]string)
+		case property == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				continue
+			}
+			days, err := eventDays(event)
+			if err != nil {
+				return "", nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			for _, day := range days {
+				if _, seen := byDate[day]; !seen {
+					byDate[day] = icalUnescape(event["SUMMARY"])
+				}
+			}
+			event = nil
+		case event != nil:
+			if _, seen := event[property]; !seen {
+				event[property] = value
+			}
+		}
+	}
+
+	if len(byDate) == 0 {
+		return "", nil, fmt.Errorf("no events found")
+	}
+
+	holidays := make([]models.Holiday, 0, len(byDate))
+	for date, summary := range byDate {
+		holidays = append(holidays, models.Holiday{Date: date, Name: summary})
+	}
+	sort.Slice(holidays, func(a, b int) bool { return holidays[a].Date < holidays[b].Date })
+
+	return name, holidays, nil
+}
+
+// unfoldICal splits an iCalendar document into content lines, joining
+// folded continuation lines
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// eventDays returns the days (YYYY-MM-DD) an event covers: DTSTART up to
+// but excluding DTEND, repeated each year for a yearly RRULE
+func eventDays(event map[string]string) ([]string, error) {
+	start, err := icalDay(event["DTSTART"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DTSTART: %w", err)
+	}
+
+	span := 1
+	if value, ok := event["DTEND"]; ok {
+		end, err := icalDay(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DTEND: %w", err)
+		}
+		span = int(end.Sub(start).Hours() / 24)
+		if span < 1 {
+			span = 1
+		}
+		if span > maxHolidaySpan {
+			return nil, fmt.Errorf("event longer than %d days", maxHolidaySpan)
+		}
+	}
+
+	starts := []time.Time{start}
+	if rule, ok := event["RRULE"]; ok {
+		starts, err = yearlyStarts(start, rule)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var days []string
+	for _, s := range starts {
+		for i := 0; i < span; i++ {
+			days = append(days, s.AddDate(0, 0, i).Format("2006-01-02"))
+		}
+	}
+
+	return days, nil
+}
+
+// yearlyStarts expands a FREQ=YEARLY rule from start, honouring COUNT and
+// UNTIL and otherwise stopping holidayRecurrenceEnd years from now. Other
+// rules are rejected rather than guessed at.
+func yearlyStarts(start time.Time, rule string) ([]time.Time, error) {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		parts[strings.ToUpper(key)] = value
+	}
+	if !strings.EqualFold(parts["FREQ"], "YEARLY") {
+		return nil, fmt.Errorf("unsupported recurrence %q (only yearly events are expanded)", rule)
+	}
+	for key := range parts {
+		if key != "FREQ" && key != "COUNT" && key != "UNTIL" && key != "INTERVAL" && key != "BYMONTH" && key != "BYMONTHDAY" {
+			return nil, fmt.Errorf("unsupported recurrence %q", rule)
+		}
+	}
+
+	until := time.Date(time.Now().Year()+holidayRecurrenceEnd, 12, 31, 0, 0, 0, 0, time.UTC)
+	if value, ok := parts["UNTIL"]; ok {
+		day, err := icalDay(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UNTIL: %w", err)
+		}
+		if day.Before(until) {
+			until = day
+		}
+	}
+	count := -1
+	if value, ok := parts["COUNT"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid COUNT %q", value)
+		}
+		count = n
+	}
+	interval := 1
+	if value, ok := parts["INTERVAL"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid INTERVAL %q", value)
+		}
+		interval = n
+	}
+
+	var starts []time.Time
+	for year := 0; count != 0; year += interval {
+		day := start.AddDate(year, 0, 0)
+		if day.After(until) {
+			break
+		}
+		if day.Day() != start.Day() {
+			continue // 29 February in a common year
+		}
+		starts = append(starts, day)
+		count--
+	}
+
+	return starts, nil
+}
+
+// icalDay parses a DATE or DATE-TIME value as the day it falls on
+func icalDay(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("%q is not a date", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+// icalUnescape reverses iCalendar TEXT escaping
+var icalUnescape = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, " ", `\N`, " ").Replace
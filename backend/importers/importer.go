@@ -0,0 +1,111 @@
+// Package importers converts data exported by other habit trackers into
+// export documents that models.ImportData can apply.
+package importers
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"time"
+
+	"habits/models"
+)
+
+// Importer parses another app's export into an export document. The
+// document has no streaks, so ImportData recomputes them from completions.
+type Importer interface {
+	Parse(r io.Reader) (*models.Export, error)
+}
+
+// New returns the importer for format. Options are format specific; the
+// generic CSV importer reads its column mapping from them.
+func New(format string, options url.Values) (Importer, error) {
+	switch format {
+	case "loop":
+		return LoopImporter{}, nil
+	case "habitica":
+		return HabiticaImporter{}, nil
+	case "csv":
+		return NewCSVImporter(options)
+	default:
+		return nil, fmt.Errorf("unknown import format %q (available: loop, habitica, csv)", format)
+	}
+}
+
+// builder collects habits and their completions by name, in the order the
+// habits are first seen
+type builder struct {
+	habits []models.ExportHabit
+	byName map[string]int
+}
+
+func newBuilder() *builder {
+	return &builder{byName: make(map[string]int)}
+}
+
+// habit returns the habit called name, adding a daily habit if needed
+func (b *builder) habit(name string) *models.ExportHabit {
+	i, ok := b.byName[name]
+	if !ok {
+		i = len(b.habits)
+		b.byName[name] = i
+		b.habits = append(b.habits, models.ExportHabit{
+			ID:          i + 1,
+			Name:        name,
+			Frequency:   "daily",
+			TargetCount: 1,
+			Completions: []models.ExportCompletion{},
+		})
+	}
+	return &b.habits[i]
+}
+
+// complete records a completion of the habit called name at t
+func (b *builder) complete(name string, t time.Time) {
+	h := b.habit(name)
+	h.Completions = append(h.Completions, models.ExportCompletion{CompletedAt: t.UTC()})
+}
+
+// export returns the collected habits as an export document, with each
+// habit's completions in order and its creation time at its first completion
+func (b *builder) export() *models.Export {
+	for i := range b.habits {
+		h := &b.habits[i]
+		sort.Slice(h.Completions, func(a, c int) bool {
+			return h.Completions[a].CompletedAt.Before(h.Completions[c].CompletedAt)
+		})
+		if h.CreatedAt.IsZero() && len(h.Completions) > 0 {
+			h.CreatedAt = h.Completions[0].CompletedAt
+		}
+	}
+
+	habits := b.habits
+	if habits == nil {
+		habits = []models.ExportHabit{}
+	}
+	return &models.Export{
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Teams:      []models.ExportTeam{},
+		Habits:     habits,
+	}
+}
+
+// frequencyFor maps a target of times per week onto a habit frequency
+func frequencyFor(timesPerWeek int) (string, int) {
+	switch {
+	case timesPerWeek >= 7:
+		return "daily", 1
+	case timesPerWeek <= 1:
+		return "weekly", 1
+	default:
+		return "multiple_times_week", timesPerWeek
+	}
+}
+
+// atNoon places a date without a time at noon UTC, so it stays on the same
+// day in nearby time zones
+func atNoon(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,178 @@
+package importers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// loopChecked is the Checkmarks.csv value of a day the habit was completed.
+// Implicit checkmarks (1) fill the days a non-daily habit was already
+// satisfied and are not completions.
+const loopChecked = "2"
+
+// maxLoopFileSize limits the decompressed size of a file read from a Loop
+// export, so a small ZIP cannot expand into an unbounded allocation
+const maxLoopFileSize = 64 << 20
+
+// LoopImporter reads a Loop Habit Tracker CSV export: either the ZIP file
+// the app produces, or its top-level Checkmarks.csv on its own. The ZIP's
+// Habits.csv supplies descriptions and frequencies.
+type LoopImporter struct{}
+
+// Parse implements Importer
+func (LoopImporter) Parse(r io.Reader) (*models.Export, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBuilder()
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		if err := parseLoopCheckmarks(b, data); err != nil {
+			return nil, err
+		}
+		return b.export(), nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Loop export: %v", err)
+	}
+
+	// Per-habit folders repeat the same data, so only top-level files are read
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		if !strings.Contains(strings.Trim(f.Name, "/"), "/") {
+			files[path.Base(f.Name)] = f
+		}
+	}
+	if files["Checkmarks.csv"] == nil {
+		return nil, fmt.Errorf("invalid Loop export: Checkmarks.csv is missing")
+	}
+
+	if f := files["Habits.csv"]; f != nil {
+		contents, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := parseLoopHabits(b, contents); err != nil {
+			return nil, err
+		}
+	}
+
+	contents, err := readZipFile(files["Checkmarks.csv"])
+	if err != nil {
+		return nil, err
+	}
+	if err := parseLoopCheckmarks(b, contents); err != nil {
+		return nil, err
+	}
+
+	return b.export(), nil
+}
+
+// readZipFile decompresses a file of a Loop export, refusing one larger
+// than maxLoopFileSize. The size in the ZIP header is checked first but can
+// lie, so the read is limited too.
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxLoopFileSize {
+		return nil, fmt.Errorf("invalid Loop export: %s is larger than %d MB", f.Name, maxLoopFileSize>>20)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxLoopFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxLoopFileSize {
+		return nil, fmt.Errorf("invalid Loop export: %s is larger than %d MB", f.Name, maxLoopFileSize>>20)
+	}
+	return data, nil
+}
+
+// parseLoopHabits reads Habits.csv, whose columns include Name, Description,
+// NumRepetitions and Interval (repetitions every interval days)
+func parseLoopHabits(b *builder, data []byte) error {
+	rows, err := readCSV(data)
+	if err != nil {
+		return fmt.Errorf("invalid Habits.csv: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := columnIndex(rows[0])
+	name, ok := columns["name"]
+	if !ok {
+		return fmt.Errorf("invalid Habits.csv: no Name column")
+	}
+
+	for _, row := range rows[1:] {
+		if name >= len(row) || row[name] == "" {
+			continue
+		}
+		h := b.habit(row[name])
+
+		description := field(row, columns, "description")
+		if description == "" {
+			description = field(row, columns, "question")
+		}
+		h.Description = description
+
+		repetitions, err1 := strconv.Atoi(field(row, columns, "numrepetitions"))
+		interval, err2 := strconv.Atoi(field(row, columns, "interval"))
+		if err1 == nil && err2 == nil && repetitions > 0 && interval > 0 {
+			h.Frequency, h.TargetCount = frequencyFor(repetitions * 7 / interval)
+		}
+	}
+
+	return nil
+}
+
+// parseLoopCheckmarks reads Checkmarks.csv: a Date column followed by one
+// column per habit, holding 2 for a completed day
+func parseLoopCheckmarks(b *builder, data []byte) error {
+	rows, err := readCSV(data)
+	if err != nil {
+		return fmt.Errorf("invalid Checkmarks.csv: %v", err)
+	}
+	if len(rows) == 0 || !strings.EqualFold(strings.TrimSpace(rows[0][0]), "date") {
+		return fmt.Errorf("invalid Checkmarks.csv: expected a Date column first")
+	}
+
+	header := rows[0]
+	for _, name := range header[1:] {
+		if name != "" {
+			b.habit(name)
+		}
+	}
+
+	for _, row := range rows[1:] {
+		day, err := time.Parse("2006-01-02", strings.TrimSpace(row[0]))
+		if err != nil {
+			return fmt.Errorf("invalid Checkmarks.csv: bad date %q", row[0])
+		}
+		for i := 1; i < len(row) && i < len(header); i++ {
+			value := strings.TrimSpace(row[i])
+			if header[i] == "" || value != loopChecked {
+				continue
+			}
+			b.complete(header[i], atNoon(day))
+		}
+	}
+
+	return nil
+}
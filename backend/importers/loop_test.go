@@ -0,0 +1,101 @@
+package importers
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"habits/models"
+)
+
+// days lists a habit's completion days
+func days(h models.ExportHabit) string {
+	var out []string
+	for _, c := range h.Completions {
+		out = append(out, c.CompletedAt.Format("2006-01-02"))
+	}
+	return strings.Join(out, ",")
+}
+
+const loopCheckmarks = "Date,Meditate,Run\n" +
+	"2024-03-03,2,1\n" +
+	"2024-03-02,0,2\n" +
+	"2024-03-01,2,-1\n"
+
+func TestLoopCheckmarks(t *testing.T) {
+	export, err := LoopImporter{}.Parse(strings.NewReader(loopCheckmarks))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := models.ValidateExport(export); err != nil {
+		t.Fatalf("ValidateExport: %v", err)
+	}
+
+	if len(export.Habits) != 2 {
+		t.Fatalf("habits = %+v, want Meditate and Run", export.Habits)
+	}
+	// Only explicit checkmarks (2) are completions, at noon, oldest first
+	if h := export.Habits[0]; h.Name != "Meditate" || days(h) != "2024-03-01,2024-03-03" {
+		t.Errorf("Meditate = %q on %s, want 2024-03-01,2024-03-03", h.Name, days(h))
+	}
+	if h := export.Habits[1]; h.Name != "Run" || days(h) != "2024-03-02" {
+		t.Errorf("Run = %q on %s, want 2024-03-02", h.Name, days(h))
+	}
+	if at := export.Habits[0].Completions[0].CompletedAt; at.Hour() != 12 {
+		t.Errorf("completion at %s, want noon", at)
+	}
+}
+
+func TestLoopZip(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, contents := range map[string]string{
+		"Habits.csv": "Position,Name,Question,Description,NumRepetitions,Interval,Color\n" +
+			"001,Meditate,Did you meditate?,Ten minutes,1,1,#fff\n" +
+			"002,Run,,,3,7,#000\n",
+		"Checkmarks.csv": loopCheckmarks,
+		// Per-habit folders repeat the data and are skipped
+		"001 Meditate/Checkmarks.csv": "Date,Value\n2024-03-03,2\n",
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	archive.Close()
+
+	export, err := LoopImporter{}.Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(export.Habits) != 2 {
+		t.Fatalf("habits = %+v, want Meditate and Run", export.Habits)
+	}
+	meditate, run := export.Habits[0], export.Habits[1]
+	if meditate.Description != "Ten minutes" || meditate.Frequency != "daily" || len(meditate.Completions) != 2 {
+		t.Errorf("Meditate = %+v, want a daily habit described and completed twice", meditate)
+	}
+	if run.Frequency != "multiple_times_week" || run.TargetCount != 3 || len(run.Completions) != 1 {
+		t.Errorf("Run = %+v, want three times a week, completed once", run)
+	}
+}
+
+func TestLoopRejectsInvalidFiles(t *testing.T) {
+	for name, input := range map[string]string{
+		"no date column": "Meditate,Run\n2,2\n",
+		"bad date":       "Date,Meditate\nyesterday,2\n",
+		"zip without checkmarks": func() string {
+			var buf bytes.Buffer
+			archive := zip.NewWriter(&buf)
+			archive.Create("Habits.csv")
+			archive.Close()
+			return buf.String()
+		}(),
+	} {
+		if _, err := (LoopImporter{}).Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
@@ -7,20 +7,25 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"habits/database"
 	"habits/handlers"
-
-	_ "github.com/mattn/go-sqlite3"
+	"habits/models"
+	"habits/notes"
 )
 
+// Default database file location, relative to the backend directory
+const dbPath = "../database/habits.db"
+
 // CORS middleware
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Member-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -42,8 +47,9 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// API routes
-func apiRoutes(db *sql.DB) http.Handler {
+// coreRoutes serves habits, completions, streaks and stats, the subset of the
+// API available on every storage backend
+func coreRoutes(db *sql.DB, store models.HabitStore) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Health check
@@ -51,12 +57,12 @@ func apiRoutes(db *sql.DB) http.Handler {
 
 	// Habits endpoints
 	mux.HandleFunc("/api/habits", func(w http.ResponseWriter, r *http.Request) {
-		handlers.HabitsHandler(w, r, db)
+		handlers.HabitsHandler(w, r, store)
 	})
 
 	// Individual habit endpoints
 	mux.HandleFunc("/api/habits/", func(w http.ResponseWriter, r *http.Request) {
-		handleHabitRoutes(w, r, db)
+		handleHabitRoutes(w, r, db, store)
 	})
 
 	// Stats endpoints
@@ -66,61 +72,387 @@ func apiRoutes(db *sql.DB) http.Handler {
 
 	// Chart endpoints
 	mux.HandleFunc("/api/charts/completion-rates", func(w http.ResponseWriter, r *http.Request) {
-		handlers.CompletionRateChartHandler(w, r, db)
+		handlers.CompletionRateChartHandler(w, r, db, store)
 	})
 
 	mux.HandleFunc("/api/charts/streaks", func(w http.ResponseWriter, r *http.Request) {
-		handlers.StreakChartHandler(w, r, db)
+		handlers.StreakChartHandler(w, r, db, store)
+	})
+
+	mux.HandleFunc("/api/charts/timeseries", func(w http.ResponseWriter, r *http.Request) {
+		handlers.TimeSeriesChartHandler(w, r, db, store)
+	})
+
+	mux.HandleFunc("/api/charts/heatmap", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HeatmapChartHandler(w, r, db, store)
+	})
+
+	// Charts rendered as SVG for embedding
+	mux.HandleFunc("/api/charts/completion-rates.svg", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CompletionRateSVGHandler(w, r, db, store)
+	})
+
+	mux.HandleFunc("/api/charts/streaks.svg", func(w http.ResponseWriter, r *http.Request) {
+		handlers.StreakSVGHandler(w, r, db, store)
+	})
+
+	mux.HandleFunc("/api/charts/heatmap.svg", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HeatmapSVGHandler(w, r, db, store)
+	})
+
+	return mux
+}
+
+// API routes. Habit, completion and streak operations go through store;
+// the remaining subsystems use db directly.
+func apiRoutes(db *sql.DB, store models.HabitStore) *http.ServeMux {
+	mux := coreRoutes(db, store)
+
+	// Challenge endpoints
+	mux.HandleFunc("/api/challenges", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ChallengesHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/challenges/", func(w http.ResponseWriter, r *http.Request) {
+		handleChallengeRoutes(w, r, db)
+	})
+
+	// Team endpoints
+	mux.HandleFunc("/api/teams", func(w http.ResponseWriter, r *http.Request) {
+		handlers.TeamsHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/teams/", func(w http.ResponseWriter, r *http.Request) {
+		handleTeamRoutes(w, r, db)
+	})
+
+	// Public share pages
+	mux.HandleFunc("/share/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SharedHabitHandler(w, r, db)
+	})
+
+	// Streak badges, public through share tokens
+	mux.HandleFunc("/api/badges/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.BadgeHandler(w, r, db)
+	})
+
+	// Calendar subscriptions
+	mux.HandleFunc("/api/calendar/feeds", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CalendarFeedsHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/calendar/feeds/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CalendarFeedsHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/calendar/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CalendarHandler(w, r, db)
+	})
+
+	// Holiday calendars, skipped by the habits they are attached to
+	mux.HandleFunc("/api/holidays", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HolidaysHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/holidays/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HolidayDetailHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.TagHolidaysHandler(w, r, db)
+	})
+
+	// Completion interaction endpoints
+	mux.HandleFunc("/api/completions/", func(w http.ResponseWriter, r *http.Request) {
+		handleCompletionRoutes(w, r, db)
+	})
+
+	// Export and import of all data, for admins only (ADMIN_TOKEN)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	mux.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ExportHandler(w, r, db, adminToken)
+	})
+
+	mux.HandleFunc("/api/export.csv", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CSVExportHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/todo.txt", func(w http.ResponseWriter, r *http.Request) {
+		handlers.TodoTxtHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/done.txt", func(w http.ResponseWriter, r *http.Request) {
+		handlers.DoneTxtHandler(w, r, db)
+	})
+
+	// Printable monthly tracker sheets, imported back as marked-up CSV
+	mux.HandleFunc("/api/sheets/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SheetHandler(w, r, db)
+	})
+
+	mux.HandleFunc("/api/import", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ImportHandler(w, r, db, adminToken)
+	})
+
+	mux.HandleFunc("/api/import/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ImportFormatHandler(w, r, db, adminToken)
 	})
 
 	return mux
 }
 
 // handleHabitRoutes routes individual habit operations
-func handleHabitRoutes(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleHabitRoutes(w http.ResponseWriter, r *http.Request, db *sql.DB, store models.HabitStore) {
 	path := r.URL.Path
 
 	if strings.HasSuffix(path, "/complete") {
-		handlers.CompleteHabitHandler(w, r, db)
+		handlers.CompleteHabitHandler(w, r, store)
+		return
+	}
+
+	if strings.Contains(path, "/holidays") {
+		// Holiday calendars are SQLite-only
+		if database.DialectOf(db) != database.SQLite {
+			http.NotFound(w, r)
+			return
+		}
+		handlers.HabitHolidaysHandler(w, r, db)
+		return
+	}
+
+	if strings.HasSuffix(strings.TrimSuffix(path, "/"), "/tags") {
+		// Tags are SQLite-only
+		if database.DialectOf(db) != database.SQLite {
+			http.NotFound(w, r)
+			return
+		}
+		handlers.HabitTagsHandler(w, r, db)
+		return
+	}
+
+	if strings.Contains(path, "/share") {
+		// Share links are SQLite-only
+		if database.DialectOf(db) != database.SQLite {
+			http.NotFound(w, r)
+			return
+		}
+		handlers.ShareLinksHandler(w, r, db)
 		return
 	}
 
 	// Check if it's a specific habit ID
 	parts := strings.Split(path, "/")
 	if len(parts) >= 4 {
-		handlers.HabitDetailHandler(w, r, db)
+		handlers.HabitDetailHandler(w, r, store)
 		return
 	}
 
 	// Fallback to general habits handler
-	handlers.HabitsHandler(w, r, db)
+	handlers.HabitsHandler(w, r, store)
 }
 
-func main() {
-	// Database setup
-	dbPath := "../database/habits.db"
+// handleChallengeRoutes routes individual challenge operations
+func handleChallengeRoutes(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	if strings.HasSuffix(path, "/leaderboard") {
+		handlers.LeaderboardHandler(w, r, db)
+		return
+	}
+
+	if strings.Contains(path, "/participants") {
+		handlers.ChallengeParticipantsHandler(w, r, db)
+		return
+	}
 
-	// Ensure database directory exists
-	os.MkdirAll("../database", 0755)
+	handlers.ChallengeDetailHandler(w, r, db)
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+// handleTeamRoutes routes individual team operations
+func handleTeamRoutes(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case strings.HasSuffix(path, "/feed/read"):
+		handlers.FeedReadHandler(w, r, db)
+	case strings.HasSuffix(path, "/feed"):
+		handlers.FeedHandler(w, r, db)
+	case strings.HasSuffix(path, "/rotation"):
+		handlers.RotationHandler(w, r, db)
+	case strings.HasSuffix(path, "/agenda"):
+		handlers.AgendaHandler(w, r, db)
+	case strings.HasSuffix(path, "/fairness"):
+		handlers.FairnessHandler(w, r, db)
+	case strings.HasSuffix(path, "/stats"):
+		handlers.TeamStatsHandler(w, r, db)
+	case strings.Contains(path, "/calendar"):
+		handlers.TeamCalendarFeedsHandler(w, r, db)
+	case strings.HasSuffix(path, "/habits"):
+		handlers.TeamHabitsHandler(w, r, db)
+	case strings.Contains(path, "/members"):
+		handlers.TeamMembersHandler(w, r, db)
+	default:
+		handlers.TeamDetailHandler(w, r, db)
+	}
+}
+
+// handleCompletionRoutes routes reactions and comments on a completion
+func handleCompletionRoutes(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case strings.HasSuffix(path, "/reactions"):
+		handlers.ReactionsHandler(w, r, db)
+	case strings.Contains(path, "/comments"):
+		handlers.CommentsHandler(w, r, db)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// databaseDSN returns the database to use: DATABASE_URL when set, which may
+// be a postgres:// URL or a SQLite file path, otherwise the default SQLite file
+func databaseDSN() string {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+	return dbPath
+}
+
+// backupDir returns where snapshots are written: BACKUP_DIR when set,
+// otherwise a backups directory next to the SQLite database
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return database.BackupDir(databaseDSN())
+}
+
+// scheduleBackups starts periodic snapshots when BACKUP_INTERVAL is set,
+// keeping the newest BACKUP_KEEP of them (default 7)
+func scheduleBackups(db *sql.DB) error {
+	setting := os.Getenv("BACKUP_INTERVAL")
+	if setting == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(setting)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid BACKUP_INTERVAL %q", setting)
+	}
+
+	keep := 7
+	if setting := os.Getenv("BACKUP_KEEP"); setting != "" {
+		if keep, err = strconv.Atoi(setting); err != nil || keep < 1 {
+			return fmt.Errorf("invalid BACKUP_KEEP %q", setting)
+		}
+	}
+
+	database.ScheduleBackups(db, backupDir(), interval, keep)
+	fmt.Printf("Backing up every %s to %s, keeping %d\n", interval, backupDir(), keep)
+	return nil
+}
+
+// notesSyncer returns a daily-notes syncer for the vault in NOTES_DIR, or nil
+// if it is not set. NOTES_FILENAME (default YYYY-MM-DD.md), NOTES_DAYS
+// (default 7) and NOTES_CONFLICT (completed, note or app) adjust it.
+func notesSyncer(db *sql.DB) (*notes.Syncer, error) {
+	dir := os.Getenv("NOTES_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+
+	config := notes.DefaultConfig(dir)
+	if setting := os.Getenv("NOTES_FILENAME"); setting != "" {
+		config.Filename = setting
+	}
+	if setting := os.Getenv("NOTES_DAYS"); setting != "" {
+		days, err := strconv.Atoi(setting)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NOTES_DAYS %q", setting)
+		}
+		config.Days = days
+	}
+	if setting := os.Getenv("NOTES_CONFLICT"); setting != "" {
+		config.Conflict = setting
+	}
+
+	return notes.New(db, config)
+}
+
+// watchNotes syncs daily notes every NOTES_INTERVAL (default 1m) when
+// NOTES_DIR is set, starting with an immediate sync
+func watchNotes(db *sql.DB) error {
+	syncer, err := notesSyncer(db)
+	if err != nil || syncer == nil {
+		return err
+	}
+
+	interval := time.Minute
+	if setting := os.Getenv("NOTES_INTERVAL"); setting != "" {
+		if interval, err = time.ParseDuration(setting); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid NOTES_INTERVAL %q", setting)
+		}
+	}
+
+	if _, err := syncer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync notes: %w", err)
+	}
+	syncer.Watch(interval)
+	fmt.Printf("Syncing daily notes in %s every %s\n", os.Getenv("NOTES_DIR"), interval)
+	return nil
+}
+
+// openDatabase opens the configured database
+func openDatabase() (*sql.DB, error) {
+	return database.Open(databaseDSN())
+}
+
+func main() {
+	// Subcommands such as "migrate" run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	db, err := openDatabase()
 	if err != nil {
-		log.Fatal("Failed to open database:", err)
+		log.Fatal(err)
 	}
 	defer db.Close()
 
-	// Test database connection
-	if err := db.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
+	// Bring the schema up to date
+	if err := database.Migrate(db); err != nil {
+		log.Fatal("Failed to migrate database:", err)
 	}
+	fmt.Println("Database initialized successfully")
 
-	// Initialize database tables
-	if err := initDatabase(db); err != nil {
-		log.Fatal("Failed to initialize database:", err)
-	}
+	// Setup routes. Only the core API runs on Postgres; see the README for
+	// the endpoints that require SQLite.
+	var apiHandler http.Handler
+	if database.DialectOf(db) == database.Postgres {
+		fmt.Println("Using PostgreSQL; only the core API is served (see the README)")
+		apiHandler = coreRoutes(db, models.NewPostgresStore(db))
+	} else {
+		mux := apiRoutes(db, models.NewSQLiteStore(db))
+
+		// Admin endpoints are only served when a token is configured
+		if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+			dir := backupDir()
+			mux.HandleFunc("/api/admin/backups", func(w http.ResponseWriter, r *http.Request) {
+				handlers.BackupsHandler(w, r, db, dir, token)
+			})
+		}
+		apiHandler = mux
 
-	// Setup routes
-	apiHandler := apiRoutes(db)
+		if err := scheduleBackups(db); err != nil {
+			log.Fatal(err)
+		}
+		if err := watchNotes(db); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Apply CORS middleware
 	handler := corsMiddleware(apiHandler)
@@ -133,43 +465,3 @@ func main() {
 
 	log.Fatal(http.ListenAndServe(port, handler))
 }
-
-// Initialize database tables
-func initDatabase(db *sql.DB) error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS habits (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			description TEXT,
-			frequency TEXT NOT NULL,
-			target_count INTEGER DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS habit_completions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			habit_id INTEGER NOT NULL,
-			completed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (habit_id) REFERENCES habits(id)
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS habit_streaks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			habit_id INTEGER NOT NULL,
-			current_streak INTEGER DEFAULT 0,
-			longest_streak INTEGER DEFAULT 0,
-			last_completion_date DATE,
-			FOREIGN KEY (habit_id) REFERENCES habits(id)
-		)`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %v", err)
-		}
-	}
-
-	fmt.Println("Database initialized successfully")
-	return nil
-}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"habits/database"
+	"habits/handlers"
+	"habits/models"
+)
+
+// testServer returns the API routes over a fresh, migrated SQLite database
+func testServer(t *testing.T) (http.Handler, *sql.DB) {
+	t.Helper()
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "habits.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return apiRoutes(db, models.NewSQLiteStore(db)), db
+}
+
+// request serves a request as memberID (none when 0) and returns the response
+func request(h http.Handler, method, path string, memberID int, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if memberID != 0 {
+		r.Header.Set(handlers.MemberHeader, strconv.Itoa(memberID))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// createTeam creates a team through the API and returns it with its owner
+func createTeam(t *testing.T, h http.Handler, name string) models.Team {
+	t.Helper()
+
+	w := request(h, "POST", "/api/teams", 0, `{"name": "`+name+`", "owner_name": "`+name+` owner"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create team: %d %s", w.Code, w.Body)
+	}
+	var team models.Team
+	if err := json.NewDecoder(w.Body).Decode(&team); err != nil {
+		t.Fatalf("decode team: %v", err)
+	}
+	if len(team.Members) != 1 || team.Members[0].Role != models.RoleOwner {
+		t.Fatalf("created team members = %+v, want its owner", team.Members)
+	}
+	return team
+}
+
+func TestTeamRoutesRequireMembership(t *testing.T) {
+	h, _ := testServer(t)
+
+	household := createTeam(t, h, "Household")
+	owner := household.Members[0].ID
+	outsider := createTeam(t, h, "Office").Members[0].ID
+
+	w := request(h, "POST", "/api/teams/"+strconv.Itoa(household.ID)+"/members", owner, `{"name": "Sam"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add member: %d %s", w.Code, w.Body)
+	}
+	var member models.TeamMember
+	json.NewDecoder(w.Body).Decode(&member)
+
+	w = request(h, "POST", "/api/teams/"+strconv.Itoa(household.ID)+"/habits", owner, `{"name": "Dishes", "frequency": "daily", "target_count": 1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create team habit: %d %s", w.Code, w.Body)
+	}
+
+	team := "/api/teams/" + strconv.Itoa(household.ID)
+	for _, tc := range []struct {
+		method, path string
+		memberID     int
+		body         string
+		want         int
+	}{
+		{"GET", team + "/habits", 0, "", http.StatusUnauthorized},
+		{"GET", team + "/habits", outsider, "", http.StatusForbidden},
+		{"GET", team + "/stats", outsider, "", http.StatusForbidden},
+		{"GET", team + "/members", outsider, "", http.StatusForbidden},
+		{"GET", team + "/agenda", outsider, "", http.StatusForbidden},
+		{"GET", team + "/feed", outsider, "", http.StatusForbidden},
+		{"GET", team, outsider, "", http.StatusForbidden},
+		{"DELETE", team, outsider, "", http.StatusForbidden},
+		{"POST", team + "/members", outsider, `{"name": "Mallory"}`, http.StatusForbidden},
+		// A plain member may read but not manage the team
+		{"GET", team + "/habits", member.ID, "", http.StatusOK},
+		{"POST", team + "/habits", member.ID, `{"name": "Laundry", "frequency": "daily", "target_count": 1}`, http.StatusForbidden},
+		{"POST", team + "/members", member.ID, `{"name": "Mallory"}`, http.StatusForbidden},
+		{"DELETE", team, member.ID, "", http.StatusForbidden},
+	} {
+		w := request(h, tc.method, tc.path, tc.memberID, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s %s as member %d = %d, want %d (%s)", tc.method, tc.path, tc.memberID, w.Code, tc.want, strings.TrimSpace(w.Body.String()))
+		}
+	}
+}
+
+func TestStatsExcludeTeamHabits(t *testing.T) {
+	h, _ := testServer(t)
+
+	household := createTeam(t, h, "Household")
+	owner := household.Members[0].ID
+	w := request(h, "POST", "/api/teams/"+strconv.Itoa(household.ID)+"/habits", owner, `{"name": "Dishes", "frequency": "daily", "target_count": 1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create team habit: %d %s", w.Code, w.Body)
+	}
+	w = request(h, "POST", "/api/habits", 0, `{"name": "Read", "frequency": "daily", "target_count": 1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create habit: %d %s", w.Code, w.Body)
+	}
+
+	w = request(h, "GET", "/api/stats", 0, "")
+	var stats handlers.Stats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.TotalHabits != 1 {
+		t.Errorf("stats count %d habits, want only the personal one", stats.TotalHabits)
+	}
+}
+
+func TestChallengeLinksRequireHabitAccess(t *testing.T) {
+	h, _ := testServer(t)
+
+	household := createTeam(t, h, "Household")
+	owner := household.Members[0].ID
+	outsider := createTeam(t, h, "Office").Members[0].ID
+	w := request(h, "POST", "/api/teams/"+strconv.Itoa(household.ID)+"/habits", owner, `{"name": "Dishes", "frequency": "daily", "target_count": 1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create team habit: %d %s", w.Code, w.Body)
+	}
+	var habit models.Habit
+	json.NewDecoder(w.Body).Decode(&habit)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	w = request(h, "POST", "/api/challenges", 0, `{"name": "Clean week", "start_date": "`+today+`", "end_date": "`+today+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create challenge: %d %s", w.Code, w.Body)
+	}
+	var challenge models.Challenge
+	json.NewDecoder(w.Body).Decode(&challenge)
+	participants := "/api/challenges/" + strconv.Itoa(challenge.ID) + "/participants"
+
+	join := `{"name": "Household", "habit_id": ` + strconv.Itoa(habit.ID) + `}`
+	if w := request(h, "POST", participants, outsider, join); w.Code != http.StatusForbidden {
+		t.Errorf("outsider linking a team habit = %d, want 403", w.Code)
+	}
+	w = request(h, "POST", participants, owner, join)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("owner linking a team habit = %d %s, want 201", w.Code, w.Body)
+	}
+	var participant models.ChallengeParticipant
+	json.NewDecoder(w.Body).Decode(&participant)
+
+	leave := participants + "/" + strconv.Itoa(participant.ID)
+	if w := request(h, "DELETE", leave, outsider, ""); w.Code != http.StatusForbidden {
+		t.Errorf("outsider removing a team participant = %d, want 403", w.Code)
+	}
+	if w := request(h, "DELETE", leave, owner, ""); w.Code != http.StatusOK {
+		t.Errorf("owner removing a team participant = %d, want 200", w.Code)
+	}
+}
+
+func TestCSVExportRequiresMembership(t *testing.T) {
+	h, _ := testServer(t)
+
+	household := createTeam(t, h, "Household")
+	owner := household.Members[0].ID
+	outsider := createTeam(t, h, "Office").Members[0].ID
+	w := request(h, "POST", "/api/teams/"+strconv.Itoa(household.ID)+"/habits", owner, `{"name": "Dishes", "frequency": "daily", "target_count": 1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create team habit: %d %s", w.Code, w.Body)
+	}
+	var habit models.Habit
+	json.NewDecoder(w.Body).Decode(&habit)
+	if w := request(h, "POST", "/api/habits/"+strconv.Itoa(habit.ID)+"/complete", owner, ""); w.Code != http.StatusOK {
+		t.Fatalf("complete team habit: %d %s", w.Code, w.Body)
+	}
+
+	// Without a filter only personal habits are exported
+	w = request(h, "GET", "/api/export.csv", 0, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Dishes") {
+		t.Errorf("unfiltered export = %d %q, want personal habits only", w.Code, w.Body)
+	}
+
+	for _, path := range []string{
+		"/api/export.csv?team_id=" + strconv.Itoa(household.ID),
+		"/api/export.csv?habit_id=" + strconv.Itoa(habit.ID),
+		"/api/export.csv?type=summary&team_id=" + strconv.Itoa(household.ID),
+	} {
+		if w := request(h, "GET", path, outsider, ""); w.Code != http.StatusForbidden {
+			t.Errorf("GET %s as an outsider = %d, want 403", path, w.Code)
+		}
+		w := request(h, "GET", path, owner, "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Dishes") {
+			t.Errorf("GET %s as a member = %d %q, want the team habit", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCSVExportValuesNotesAndTags(t *testing.T) {
+	h, _ := testServer(t)
+
+	var habits []models.Habit
+	for _, name := range []string{"Read", "Stretch"} {
+		w := request(h, "POST", "/api/habits", 0, `{"name": "`+name+`", "frequency": "daily", "target_count": 1}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create habit: %d %s", w.Code, w.Body)
+		}
+		var habit models.Habit
+		json.NewDecoder(w.Body).Decode(&habit)
+		habits = append(habits, habit)
+	}
+	read, stretch := strconv.Itoa(habits[0].ID), strconv.Itoa(habits[1].ID)
+
+	w := request(h, "PUT", "/api/habits/"+read+"/tags", 0, `{"tags": ["Learning", " evening ", "learning"]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tags":["evening","learning"]`) {
+		t.Fatalf("set tags = %d %s, want them normalized", w.Code, w.Body)
+	}
+	if w := request(h, "PUT", "/api/habits/"+stretch+"/tags", 0, `{"tags": ["a,b"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("tag with a comma = %d, want 400", w.Code)
+	}
+
+	if w := request(h, "POST", "/api/habits/"+read+"/complete", 0, `{"value": 12.5, "note": "=chapter 3"}`); w.Code != http.StatusOK {
+		t.Fatalf("complete with details: %d %s", w.Code, w.Body)
+	}
+	if w := request(h, "POST", "/api/habits/"+stretch+"/complete", 0, ""); w.Code != http.StatusOK {
+		t.Fatalf("complete without a body: %d %s", w.Code, w.Body)
+	}
+
+	w = request(h, "GET", "/api/export.csv?tag=Learning", 0, "")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 2 {
+		t.Fatalf("export tagged learning = %d %q, want a header and one row", w.Code, w.Body)
+	}
+	if !strings.HasSuffix(lines[0], ",member,value,note,tags") || !strings.HasSuffix(lines[1], `,12.5,'=chapter 3,"evening,learning"`) {
+		t.Errorf("export = %q, want the value, guarded note and tags", lines)
+	}
+
+	w = request(h, "GET", "/api/export.csv?type=summary&tag=evening", 0, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Read") || strings.Contains(w.Body.String(), "Stretch") {
+		t.Errorf("summary tagged evening = %d %q, want only Read", w.Code, w.Body)
+	}
+}
+
+func TestTagHolidayCalendars(t *testing.T) {
+	h, db := testServer(t)
+
+	w := request(h, "POST", "/api/habits", 0, `{"name": "Commute by bike", "frequency": "daily", "target_count": 1}`)
+	var habit models.Habit
+	json.NewDecoder(w.Body).Decode(&habit)
+	id := strconv.Itoa(habit.ID)
+	if w := request(h, "PUT", "/api/habits/"+id+"/tags", 0, `{"tags": ["work"]}`); w.Code != http.StatusOK {
+		t.Fatalf("set tags: %d %s", w.Code, w.Body)
+	}
+
+	// Completed two days ago and today, with yesterday a holiday
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if _, err := db.Exec("INSERT INTO habit_completions (habit_id, completed_at) VALUES (?, ?)", habit.ID, today.AddDate(0, 0, -2).Add(8*time.Hour)); err != nil {
+		t.Fatalf("insert completion: %v", err)
+	}
+	if w := request(h, "POST", "/api/habits/"+id+"/complete", 0, ""); w.Code != http.StatusOK {
+		t.Fatalf("complete: %d %s", w.Code, w.Body)
+	}
+	w = request(h, "POST", "/api/holidays", 0, `{"name": "Bank holidays", "dates": ["`+today.AddDate(0, 0, -1).Format("2006-01-02")+`"]}`)
+	var calendar models.HolidayCalendar
+	json.NewDecoder(w.Body).Decode(&calendar)
+
+	w = request(h, "PUT", "/api/tags/Work/holidays", 0, `{"calendar_ids": [`+strconv.Itoa(calendar.ID)+`]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tag":"work"`) {
+		t.Fatalf("attach calendar to tag = %d %s", w.Code, w.Body)
+	}
+	streak, err := models.GetStreak(db, habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak: %v", err)
+	}
+	if streak.CurrentStreak != 2 {
+		t.Errorf("streak with the tag's holiday = %d, want 2", streak.CurrentStreak)
+	}
+
+	// A team's tag calendars are its own and only admins set them
+	household := createTeam(t, h, "Household")
+	outsider := createTeam(t, h, "Office").Members[0].ID
+	path := "/api/tags/work/holidays?team_id=" + strconv.Itoa(household.ID)
+	if w := request(h, "PUT", path, outsider, `{"calendar_ids": []}`); w.Code != http.StatusForbidden {
+		t.Errorf("outsider setting a team tag's calendars = %d, want 403", w.Code)
+	}
+	w = request(h, "GET", path, household.Members[0].ID, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"calendar_ids":[]`) {
+		t.Errorf("team tag calendars = %d %s, want none", w.Code, w.Body)
+	}
+
+	// Untagging the habit drops the holiday again
+	if w := request(h, "PUT", "/api/habits/"+id+"/tags", 0, `{"tags": []}`); w.Code != http.StatusOK {
+		t.Fatalf("clear tags: %d %s", w.Code, w.Body)
+	}
+	if streak, err := models.GetStreak(db, habit.ID); err != nil || streak.CurrentStreak != 1 {
+		t.Errorf("streak without the tag = %+v, %v; want 1", streak, err)
+	}
+}
+
+func TestTimeSeriesValueMetric(t *testing.T) {
+	h, db := testServer(t)
+
+	w := request(h, "POST", "/api/habits", 0, `{"name": "Read", "frequency": "daily", "target_count": 1}`)
+	var habit models.Habit
+	json.NewDecoder(w.Body).Decode(&habit)
+
+	// 12.5 pages two days ago, a completion without a value yesterday and 30 today
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for daysAgo, value := range map[int]interface{}{2: 12.5, 1: nil} {
+		_, err := db.Exec("INSERT INTO habit_completions (habit_id, completed_at, value) VALUES (?, ?, ?)", habit.ID, today.AddDate(0, 0, -daysAgo).Add(8*time.Hour), value)
+		if err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+	}
+	if w := request(h, "POST", "/api/habits/"+strconv.Itoa(habit.ID)+"/complete", 0, `{"value": 30}`); w.Code != http.StatusOK {
+		t.Fatalf("complete: %d %s", w.Code, w.Body)
+	}
+
+	from := today.AddDate(0, 0, -2).Format("2006-01-02")
+	w = request(h, "GET", "/api/charts/timeseries?metric=value&from="+from, 0, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("value series: %d %s", w.Code, w.Body)
+	}
+	var series handlers.TimeSeries
+	json.NewDecoder(w.Body).Decode(&series)
+	if len(series.Series) != 1 || fmt.Sprint(series.Series[0].Data) != "[12.5 0 30]" {
+		t.Errorf("value series = %+v, want [12.5 0 30]", series.Series)
+	}
+
+	w = request(h, "GET", "/api/charts/timeseries?metric=value&granularity=month&from="+from, 0, "")
+	json.NewDecoder(w.Body).Decode(&series)
+	var total float64
+	for _, v := range series.Series[0].Data {
+		total += v
+	}
+	if total != 42.5 {
+		t.Errorf("monthly value series = %v, want a total of 42.5", series.Series[0].Data)
+	}
+}
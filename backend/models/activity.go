@@ -0,0 +1,379 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// Activity event types
+const (
+	EventCompletion      = "completion"
+	EventStreakMilestone = "streak_milestone"
+	EventReaction        = "reaction"
+	EventComment         = "comment"
+)
+
+// streakMilestones are the streak lengths that generate a milestone event
+var streakMilestones = map[int]bool{3: true, 7: true, 14: true, 21: true, 30: true, 50: true, 100: true, 200: true, 365: true}
+
+// ActivityEvent represents an entry in a team's activity feed
+type ActivityEvent struct {
+	ID           int       `json:"id"`
+	TeamID       int       `json:"team_id"`
+	HabitID      int       `json:"habit_id"`
+	HabitName    string    `json:"habit_name"`
+	CompletionID int       `json:"completion_id,omitempty"`
+	MemberID     int       `json:"member_id,omitempty"`
+	MemberName   string    `json:"member_name,omitempty"`
+	Type         string    `json:"type"` // completion, streak_milestone, reaction, comment
+	Data         string    `json:"data,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Computed fields
+	Reactions    map[string]int `json:"reactions,omitempty"`
+	CommentCount int            `json:"comment_count"`
+}
+
+// ActivityFeed is a page of activity events
+type ActivityFeed struct {
+	Events      []ActivityEvent `json:"events"`
+	NextCursor  int             `json:"next_cursor,omitempty"` // pass as before= for the next page
+	UnreadCount int             `json:"unread_count"`
+}
+
+// Reaction represents a member's reaction to a completion
+type Reaction struct {
+	ID           int       `json:"id"`
+	CompletionID int       `json:"completion_id"`
+	MemberID     int       `json:"member_id"`
+	Emoji        string    `json:"emoji"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Comment represents a member's comment on a completion
+type Comment struct {
+	ID           int       `json:"id"`
+	CompletionID int       `json:"completion_id"`
+	MemberID     int       `json:"member_id"`
+	MemberName   string    `json:"member_name"`
+	Body         string    `json:"body"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// recordCompletionActivity adds completion and streak milestone events for a
+// team habit. Personal habits have no feed and are ignored.
+func recordCompletionActivity(db querier, habitID, completionID, memberID int) error {
+	var teamID sql.NullInt64
+	var currentStreak int
+	err := db.QueryRow(`
+		SELECT h.team_id, COALESCE(hs.current_streak, 0)
+		FROM habits h
+		LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
+		WHERE h.id = ?
+	`, habitID).Scan(&teamID, &currentStreak)
+	if err != nil {
+		return err
+	}
+	if !teamID.Valid {
+		return nil
+	}
+
+	event := ActivityEvent{
+		TeamID:       int(teamID.Int64),
+		HabitID:      habitID,
+		CompletionID: completionID,
+		MemberID:     memberID,
+		Type:         EventCompletion,
+	}
+	if err := addActivityEvent(db, &event); err != nil {
+		return err
+	}
+
+	if streakMilestones[currentStreak] {
+		event.Type = EventStreakMilestone
+		event.Data = strconv.Itoa(currentStreak)
+		return addActivityEvent(db, &event)
+	}
+
+	return nil
+}
+
+func addActivityEvent(db querier, event *ActivityEvent) error {
+	event.CreatedAt = time.Now()
+	result, err := db.Exec(`
+		INSERT INTO activity_events (team_id, habit_id, completion_id, member_id, type, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, event.TeamID, event.HabitID, nullableID(event.CompletionID), nullableID(event.MemberID), event.Type, event.Data, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = int(id)
+	return nil
+}
+
+// GetActivityFeed returns a page of a team's activity, newest first. Events
+// with an ID below before are returned when before is non-zero.
+func GetActivityFeed(db *sql.DB, teamID, memberID, before, limit int) (*ActivityFeed, error) {
+	query := `
+		SELECT ae.id, ae.team_id, ae.habit_id, COALESCE(h.name, ''), COALESCE(ae.completion_id, 0),
+		       COALESCE(ae.member_id, 0), COALESCE(tm.name, ''), ae.type, COALESCE(ae.data, ''), ae.created_at,
+		       (SELECT COUNT(*) FROM completion_comments cc WHERE cc.completion_id = ae.completion_id) as comment_count
+		FROM activity_events ae
+		LEFT JOIN habits h ON h.id = ae.habit_id
+		LEFT JOIN team_members tm ON tm.id = ae.member_id
+		WHERE ae.team_id = ? AND (? = 0 OR ae.id < ?)
+		ORDER BY ae.id DESC
+		LIMIT ?
+	`
+
+	// Fetch one extra row to know whether another page exists
+	rows, err := db.Query(query, teamID, before, before, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed := &ActivityFeed{Events: []ActivityEvent{}}
+	for rows.Next() {
+		var e ActivityEvent
+		err := rows.Scan(&e.ID, &e.TeamID, &e.HabitID, &e.HabitName, &e.CompletionID,
+			&e.MemberID, &e.MemberName, &e.Type, &e.Data, &e.CreatedAt, &e.CommentCount)
+		if err != nil {
+			return nil, err
+		}
+		feed.Events = append(feed.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(feed.Events) > limit {
+		feed.Events = feed.Events[:limit]
+		feed.NextCursor = feed.Events[limit-1].ID
+	}
+
+	for i := range feed.Events {
+		if feed.Events[i].CompletionID == 0 {
+			continue
+		}
+		feed.Events[i].Reactions, err = getReactionCounts(db, feed.Events[i].CompletionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	feed.UnreadCount, err = GetUnreadCount(db, teamID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// GetUnreadCount counts a team's events by other members that a member has not read yet
+func GetUnreadCount(db *sql.DB, teamID, memberID int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM activity_events
+		WHERE team_id = ?
+		  AND COALESCE(member_id, 0) != ?
+		  AND id > COALESCE((SELECT last_read_event_id FROM activity_reads WHERE member_id = ?), 0)
+	`
+
+	var count int
+	err := db.QueryRow(query, teamID, memberID, memberID).Scan(&count)
+	return count, err
+}
+
+// MarkActivityRead marks a team's events up to eventID as read for a member.
+// An eventID of 0 marks everything currently in the feed as read.
+func MarkActivityRead(db *sql.DB, teamID, memberID, eventID int) error {
+	if eventID == 0 {
+		err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM activity_events WHERE team_id = ?", teamID).Scan(&eventID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Never move the read marker backwards
+	_, err := db.Exec(`
+		INSERT INTO activity_reads (member_id, last_read_event_id) VALUES (?, ?)
+		ON CONFLICT(member_id) DO UPDATE SET last_read_event_id = MAX(last_read_event_id, excluded.last_read_event_id)
+	`, memberID, eventID)
+	return err
+}
+
+// GetCompletionHabit returns the habit a completion belongs to
+func GetCompletionHabit(db *sql.DB, completionID int) (*Habit, error) {
+	var habitID int
+	err := db.QueryRow("SELECT habit_id FROM habit_completions WHERE id = ?", completionID).Scan(&habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetHabit(db, habitID)
+}
+
+// GetReactions retrieves all reactions on a completion
+func GetReactions(db *sql.DB, completionID int) ([]Reaction, error) {
+	rows, err := db.Query(`
+		SELECT id, completion_id, member_id, emoji, created_at
+		FROM completion_reactions
+		WHERE completion_id = ?
+		ORDER BY id
+	`, completionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []Reaction{}
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.CompletionID, &r.MemberID, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+
+	return reactions, rows.Err()
+}
+
+func getReactionCounts(db *sql.DB, completionID int) (map[string]int, error) {
+	rows, err := db.Query("SELECT emoji, COUNT(*) FROM completion_reactions WHERE completion_id = ? GROUP BY emoji", completionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var emoji string
+		var count int
+		if err := rows.Scan(&emoji, &count); err != nil {
+			return nil, err
+		}
+		counts[emoji] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// AddReaction adds a member's reaction to a completion of a team habit.
+// Reacting twice with the same emoji is a no-op.
+func AddReaction(db *sql.DB, habit *Habit, reaction *Reaction) error {
+	reaction.CreatedAt = time.Now()
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO completion_reactions (completion_id, member_id, emoji, created_at)
+		VALUES (?, ?, ?, ?)
+	`, reaction.CompletionID, reaction.MemberID, reaction.Emoji, reaction.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	reaction.ID = int(id)
+
+	return addActivityEvent(db, &ActivityEvent{
+		TeamID:       habit.TeamID,
+		HabitID:      habit.ID,
+		CompletionID: reaction.CompletionID,
+		MemberID:     reaction.MemberID,
+		Type:         EventReaction,
+		Data:         reaction.Emoji,
+	})
+}
+
+// RemoveReaction removes a member's reaction from a completion
+func RemoveReaction(db *sql.DB, completionID, memberID int, emoji string) error {
+	_, err := db.Exec("DELETE FROM completion_reactions WHERE completion_id = ? AND member_id = ? AND emoji = ?",
+		completionID, memberID, emoji)
+	return err
+}
+
+// GetComments retrieves a page of comments on a completion, oldest first.
+// Comments with an ID above after are returned when after is non-zero.
+func GetComments(db *sql.DB, completionID, after, limit int) ([]Comment, error) {
+	rows, err := db.Query(`
+		SELECT cc.id, cc.completion_id, cc.member_id, COALESCE(tm.name, ''), cc.body, cc.created_at
+		FROM completion_comments cc
+		LEFT JOIN team_members tm ON tm.id = cc.member_id
+		WHERE cc.completion_id = ? AND cc.id > ?
+		ORDER BY cc.id
+		LIMIT ?
+	`, completionID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.CompletionID, &c.MemberID, &c.MemberName, &c.Body, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// AddComment adds a member's comment to a completion of a team habit
+func AddComment(db *sql.DB, habit *Habit, comment *Comment) error {
+	comment.CreatedAt = time.Now()
+	result, err := db.Exec(`
+		INSERT INTO completion_comments (completion_id, member_id, body, created_at)
+		VALUES (?, ?, ?, ?)
+	`, comment.CompletionID, comment.MemberID, comment.Body, comment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	comment.ID = int(id)
+
+	return addActivityEvent(db, &ActivityEvent{
+		TeamID:       habit.TeamID,
+		HabitID:      habit.ID,
+		CompletionID: comment.CompletionID,
+		MemberID:     comment.MemberID,
+		Type:         EventComment,
+		Data:         comment.Body,
+	})
+}
+
+// DeleteComment deletes a comment written by a member
+func DeleteComment(db *sql.DB, completionID, commentID, memberID int) error {
+	result, err := db.Exec("DELETE FROM completion_comments WHERE id = ? AND completion_id = ? AND member_id = ?",
+		commentID, completionID, memberID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
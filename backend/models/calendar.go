@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// CalendarFeed is a revocable, unguessable iCalendar subscription. A feed
+// without a member covers personal habits; a member's feed covers the
+// habits of their team.
+type CalendarFeed struct {
+	ID        int        `json:"id"`
+	MemberID  int        `json:"member_id,omitempty"`
+	TeamID    int        `json:"team_id,omitempty"`
+	Token     string     `json:"token"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CalendarCompletion is a completion shown in a calendar feed
+type CalendarCompletion struct {
+	HabitCompletion
+	MemberName string
+}
+
+// CalendarOccurrence is a period in which a habit is due
+type CalendarOccurrence struct {
+	HabitID     int
+	Start       time.Time // first day of the period
+	End         time.Time // day after the period
+	Target      int
+	Completions int
+}
+
+// Calendar is the content of a calendar feed
+type Calendar struct {
+	Habits      []Habit
+	Completions []CalendarCompletion
+	Occurrences []CalendarOccurrence
+}
+
+// CreateCalendarFeed creates a feed for a team member, or a personal feed
+// when memberID is 0
+func CreateCalendarFeed(db *sql.DB, memberID int) (*CalendarFeed, error) {
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &CalendarFeed{MemberID: memberID, Token: token, CreatedAt: time.Now()}
+	result, err := db.Exec("INSERT INTO calendar_feeds (member_id, token, created_at) VALUES (?, ?, ?)",
+		nullableID(memberID), feed.Token, feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	feed.ID = int(id)
+	return feed, nil
+}
+
+// GetCalendarFeeds retrieves a member's feeds, or the personal feeds when
+// memberID is 0, including revoked ones
+func GetCalendarFeeds(db *sql.DB, memberID int) ([]CalendarFeed, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(member_id, 0), token, created_at, revoked_at
+		FROM calendar_feeds
+		WHERE COALESCE(member_id, 0) = ?
+		ORDER BY created_at DESC
+	`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []CalendarFeed{}
+	for rows.Next() {
+		var feed CalendarFeed
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&feed.ID, &feed.MemberID, &feed.Token, &feed.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			feed.RevokedAt = &revokedAt.Time
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, rows.Err()
+}
+
+// RevokeCalendarFeed revokes a feed of a member (or a personal feed when
+// memberID is 0) so it can no longer be used
+func RevokeCalendarFeed(db *sql.DB, memberID, feedID int) error {
+	result, err := db.Exec("UPDATE calendar_feeds SET revoked_at = ? WHERE id = ? AND COALESCE(member_id, 0) = ? AND revoked_at IS NULL",
+		time.Now(), feedID, memberID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetCalendarFeedByToken resolves an active feed token
+func GetCalendarFeedByToken(db *sql.DB, token string) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := db.QueryRow(`
+		SELECT f.id, COALESCE(f.member_id, 0), COALESCE(m.team_id, 0), f.token, f.created_at
+		FROM calendar_feeds f
+		LEFT JOIN team_members m ON m.id = f.member_id
+		WHERE f.token = ? AND f.revoked_at IS NULL
+	`, token).Scan(&feed.ID, &feed.MemberID, &feed.TeamID, &feed.Token, &feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &feed, nil
+}
+
+// GetCalendar reads a feed's habits, their completions over the last
+// pastDays days, and the periods they are due in from today through
+// futureDays days ahead
+func GetCalendar(db *sql.DB, feed *CalendarFeed, pastDays, futureDays int) (*Calendar, error) {
+	where, args := "h.team_id IS NULL", []interface{}{}
+	if feed.MemberID != 0 {
+		where, args = "h.team_id = ?", []interface{}{feed.TeamID}
+	}
+
+	habits, err := queryHabits(db, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	today := truncateDay(time.Now().UTC())
+	since := today.AddDate(0, 0, -pastDays)
+	if weekStart := PeriodStart("weekly", today); weekStart.Before(since) {
+		since = weekStart // Count completions in the current week
+	}
+
+	rows, err := db.Query(`
+		SELECT c.id, c.habit_id, COALESCE(c.member_id, 0), c.completed_at, COALESCE(m.name, '')
+		FROM habit_completions c
+		JOIN habits h ON h.id = c.habit_id
+		LEFT JOIN team_members m ON m.id = c.member_id
+		WHERE `+where+` AND c.completed_at >= ?
+		ORDER BY c.completed_at
+	`, append(args, since.Format("2006-01-02"))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calendar := &Calendar{Habits: habits}
+	done := make(map[int]map[time.Time]int) // completions per habit and period
+	frequencies := make(map[int]string)
+	for _, habit := range habits {
+		frequencies[habit.ID] = habit.Frequency
+		done[habit.ID] = make(map[time.Time]int)
+	}
+	for rows.Next() {
+		var c CalendarCompletion
+		if err := rows.Scan(&c.ID, &c.HabitID, &c.MemberID, &c.CompletedAt, &c.MemberName); err != nil {
+			return nil, err
+		}
+		c.CompletedAt = c.CompletedAt.UTC()
+		if done[c.HabitID] != nil {
+			done[c.HabitID][PeriodStart(frequencies[c.HabitID], c.CompletedAt)]++
+		}
+		if !c.CompletedAt.Before(today.AddDate(0, 0, -pastDays)) {
+			calendar.Completions = append(calendar.Completions, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	until := today.AddDate(0, 0, futureDays)
+	for i := range habits {
+		habit := &habits[i]
+		for start := PeriodStart(habit.Frequency, today); !start.After(until); start = nextPeriod(habit.Frequency, start) {
+			calendar.Occurrences = append(calendar.Occurrences, CalendarOccurrence{
+				HabitID:     habit.ID,
+				Start:       start,
+				End:         nextPeriod(habit.Frequency, start),
+				Target:      PeriodTarget(habit),
+				Completions: done[habit.ID][start],
+			})
+		}
+	}
+
+	return calendar, nil
+}
@@ -0,0 +1,503 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// Challenge represents a time-boxed group challenge built from a habit template
+type Challenge struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Frequency   string    `json:"frequency"` // template frequency for participant habits
+	TargetCount int       `json:"target_count"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Computed fields
+	Participants []ChallengeParticipant `json:"participants"`
+	IsFinished   bool                   `json:"is_finished"`
+}
+
+// ChallengeParticipant links a participant to the habit tracking their progress
+type ChallengeParticipant struct {
+	ID          int       `json:"id"`
+	ChallengeID int       `json:"challenge_id"`
+	Name        string    `json:"name"`
+	HabitID     int       `json:"habit_id"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// LeaderboardEntry represents a participant's standing in a challenge
+type LeaderboardEntry struct {
+	Rank           int     `json:"rank"`
+	ParticipantID  int     `json:"participant_id"`
+	Name           string  `json:"name"`
+	HabitID        int     `json:"habit_id"`
+	Completions    int     `json:"completions"`
+	CompletionRate float64 `json:"completion_rate"`
+	CurrentStreak  int     `json:"current_streak"`
+	LongestStreak  int     `json:"longest_streak"`
+}
+
+// Leaderboard represents the ranking for a challenge
+type Leaderboard struct {
+	ChallengeID int                `json:"challenge_id"`
+	Final       bool               `json:"final"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+// isFinishedAt reports whether the challenge end date has passed at now
+func (c *Challenge) isFinishedAt(now time.Time) bool {
+	return truncateDay(now).After(truncateDay(c.EndDate))
+}
+
+// CreateChallenge creates a new challenge
+func CreateChallenge(db *sql.DB, challenge *Challenge) error {
+	query := `
+		INSERT INTO challenges (name, description, frequency, target_count, start_date, end_date, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := db.Exec(query, challenge.Name, challenge.Description, challenge.Frequency, challenge.TargetCount,
+		challenge.StartDate.Format("2006-01-02"), challenge.EndDate.Format("2006-01-02"), now)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	challenge.ID = int(id)
+	challenge.CreatedAt = now
+	challenge.Participants = []ChallengeParticipant{}
+	challenge.IsFinished = challenge.isFinishedAt(now)
+
+	return nil
+}
+
+// GetChallenges retrieves all challenges with their participants
+func GetChallenges(db *sql.DB) ([]Challenge, error) {
+	query := `
+		SELECT id, name, description, frequency, target_count, start_date, end_date, created_at
+		FROM challenges
+		ORDER BY start_date DESC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var challenges []Challenge
+	for rows.Next() {
+		var challenge Challenge
+		err := rows.Scan(
+			&challenge.ID, &challenge.Name, &challenge.Description, &challenge.Frequency, &challenge.TargetCount,
+			&challenge.StartDate, &challenge.EndDate, &challenge.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		challenge.IsFinished = challenge.isFinishedAt(time.Now())
+		challenges = append(challenges, challenge)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range challenges {
+		challenges[i].Participants, err = GetChallengeParticipants(db, challenges[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return challenges, nil
+}
+
+// GetChallenge retrieves a single challenge by ID
+func GetChallenge(db *sql.DB, id int) (*Challenge, error) {
+	query := `
+		SELECT id, name, description, frequency, target_count, start_date, end_date, created_at
+		FROM challenges
+		WHERE id = ?
+	`
+
+	var challenge Challenge
+	err := db.QueryRow(query, id).Scan(
+		&challenge.ID, &challenge.Name, &challenge.Description, &challenge.Frequency, &challenge.TargetCount,
+		&challenge.StartDate, &challenge.EndDate, &challenge.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge.IsFinished = challenge.isFinishedAt(time.Now())
+	challenge.Participants, err = GetChallengeParticipants(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// DeleteChallenge deletes a challenge, its participants and frozen results.
+// Participant habits are kept so their history is not lost.
+func DeleteChallenge(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM challenges WHERE id = ?", id)
+	return err
+}
+
+// GetChallengeParticipants retrieves all participants of a challenge
+func GetChallengeParticipants(db *sql.DB, challengeID int) ([]ChallengeParticipant, error) {
+	query := `
+		SELECT id, challenge_id, name, habit_id, joined_at
+		FROM challenge_participants
+		WHERE challenge_id = ?
+		ORDER BY joined_at
+	`
+
+	rows, err := db.Query(query, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []ChallengeParticipant{}
+	for rows.Next() {
+		var p ChallengeParticipant
+		if err := rows.Scan(&p.ID, &p.ChallengeID, &p.Name, &p.HabitID, &p.JoinedAt); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+
+	return participants, rows.Err()
+}
+
+// GetChallengeParticipant retrieves one participant of a challenge
+func GetChallengeParticipant(db *sql.DB, challengeID, participantID int) (*ChallengeParticipant, error) {
+	query := `
+		SELECT id, challenge_id, name, habit_id, joined_at
+		FROM challenge_participants
+		WHERE id = ? AND challenge_id = ?
+	`
+
+	var p ChallengeParticipant
+	err := db.QueryRow(query, participantID, challengeID).Scan(&p.ID, &p.ChallengeID, &p.Name, &p.HabitID, &p.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// JoinChallenge adds a participant to a challenge. If participant.HabitID is
+// zero a new habit is created from the challenge template and linked instead.
+func JoinChallenge(db *sql.DB, challenge *Challenge, participant *ChallengeParticipant) error {
+	if participant.HabitID == 0 {
+		habit := Habit{
+			Name:        challenge.Name,
+			Description: challenge.Description,
+			Frequency:   challenge.Frequency,
+			TargetCount: challenge.TargetCount,
+		}
+		if err := CreateHabit(db, &habit); err != nil {
+			return err
+		}
+		participant.HabitID = habit.ID
+	} else if _, err := GetHabit(db, participant.HabitID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result, err := db.Exec(
+		"INSERT INTO challenge_participants (challenge_id, name, habit_id, joined_at) VALUES (?, ?, ?, ?)",
+		challenge.ID, participant.Name, participant.HabitID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	participant.ID = int(id)
+	participant.ChallengeID = challenge.ID
+	participant.JoinedAt = now
+
+	return nil
+}
+
+// LeaveChallenge removes a participant from a challenge
+func LeaveChallenge(db *sql.DB, challengeID, participantID int) error {
+	result, err := db.Exec("DELETE FROM challenge_participants WHERE id = ? AND challenge_id = ?", participantID, challengeID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetLeaderboard ranks challenge participants by completion rate and streak.
+// Once a challenge has ended its results are frozen and served from storage.
+func GetLeaderboard(db *sql.DB, challenge *Challenge) (*Leaderboard, error) {
+	leaderboard := &Leaderboard{ChallengeID: challenge.ID, Entries: []LeaderboardEntry{}}
+
+	if challenge.IsFinished {
+		entries, err := getFrozenResults(db, challenge.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			leaderboard.Final = true
+			leaderboard.Entries = entries
+			return leaderboard, nil
+		}
+	}
+
+	entries, err := computeLeaderboard(db, challenge, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	leaderboard.Entries = entries
+
+	if challenge.IsFinished && len(entries) > 0 {
+		if err := freezeResults(db, challenge.ID, entries); err != nil {
+			return nil, err
+		}
+		leaderboard.Final = true
+	}
+
+	return leaderboard, nil
+}
+
+func computeLeaderboard(db *sql.DB, challenge *Challenge, now time.Time) ([]LeaderboardEntry, error) {
+	participants := challenge.Participants
+	if participants == nil {
+		var err error
+		participants, err = GetChallengeParticipants(db, challenge.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := truncateDay(challenge.StartDate)
+	end := truncateDay(challenge.EndDate)
+	today := truncateDay(now)
+	if today.Before(end) {
+		end = today
+	}
+
+	// Number of periods elapsed so far, based on the template frequency.
+	// Weekly templates are scored per week of the challenge, needing target
+	// completions in each for multiple_times_week.
+	weekly := challenge.Frequency == "weekly" || challenge.Frequency == "multiple_times_week"
+	target := PeriodTarget(&Habit{Frequency: challenge.Frequency, TargetCount: challenge.TargetCount})
+	periods := 0
+	if !end.Before(start) {
+		days := int(end.Sub(start).Hours()/24) + 1
+		periods = days
+		if weekly {
+			periods = (days + 6) / 7
+		}
+	}
+
+	entries := []LeaderboardEntry{}
+	for _, p := range participants {
+		// Participants who joined after the end are not ranked
+		if !p.JoinedAt.Before(truncateDay(challenge.EndDate).AddDate(0, 0, 1)) {
+			continue
+		}
+
+		dates, err := completionDays(db, p.HabitID, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := LeaderboardEntry{
+			ParticipantID: p.ID,
+			Name:          p.Name,
+			HabitID:       p.HabitID,
+			Completions:   len(dates),
+		}
+		entry.CurrentStreak, entry.LongestStreak = streaksFromDays(dates, end)
+
+		completed := len(dates)
+		if weekly {
+			weeks := make(map[int]int)
+			for _, d := range dates {
+				weeks[int(d.Sub(start).Hours()/24)/7]++
+			}
+			completed = 0
+			for _, n := range weeks {
+				completed += min(n, target)
+			}
+		}
+		if periods > 0 {
+			entry.CompletionRate = float64(completed) / float64(periods*target) * 100
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].CompletionRate != entries[j].CompletionRate {
+			return entries[i].CompletionRate > entries[j].CompletionRate
+		}
+		if entries[i].CurrentStreak != entries[j].CurrentStreak {
+			return entries[i].CurrentStreak > entries[j].CurrentStreak
+		}
+		return entries[i].LongestStreak > entries[j].LongestStreak
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].CompletionRate == entries[i-1].CompletionRate &&
+			entries[i].CurrentStreak == entries[i-1].CurrentStreak &&
+			entries[i].LongestStreak == entries[i-1].LongestStreak {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	return entries, nil
+}
+
+// getFrozenResults returns a finished challenge's stored leaderboard, empty
+// if it has not been frozen yet. freezeResults stores all rows or none.
+func getFrozenResults(db *sql.DB, challengeID int) ([]LeaderboardEntry, error) {
+	query := `
+		SELECT rank, participant_id, name, habit_id, completions, completion_rate, current_streak, longest_streak
+		FROM challenge_results
+		WHERE challenge_id = ?
+		ORDER BY rank, id
+	`
+
+	rows, err := db.Query(query, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var e LeaderboardEntry
+		err := rows.Scan(&e.Rank, &e.ParticipantID, &e.Name, &e.HabitID, &e.Completions,
+			&e.CompletionRate, &e.CurrentStreak, &e.LongestStreak)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// freezeResults stores a finished challenge's final leaderboard. The rows
+// are written in one transaction so a failure leaves no partial results, and
+// a concurrent freeze of the same challenge keeps the rows stored first.
+func freezeResults(db *sql.DB, challengeID int, entries []LeaderboardEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT OR IGNORE INTO challenge_results
+			(challenge_id, rank, participant_id, name, habit_id, completions, completion_rate, current_streak, longest_streak, frozen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	for _, e := range entries {
+		_, err := tx.Exec(query, challengeID, e.Rank, e.ParticipantID, e.Name, e.HabitID, e.Completions,
+			e.CompletionRate, e.CurrentStreak, e.LongestStreak, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// completionDays returns the distinct days a habit was completed within [from, to]
+func completionDays(db *sql.DB, habitID int, from, to time.Time) ([]time.Time, error) {
+	query := `
+		SELECT DISTINCT DATE(completed_at) as day
+		FROM habit_completions
+		WHERE habit_id = ? AND completed_at >= ? AND completed_at < ?
+		ORDER BY day
+	`
+
+	rows, err := db.Query(query, habitID, from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, t)
+	}
+
+	return days, rows.Err()
+}
+
+// streaksFromDays computes the current streak (ending on asOf or the day before)
+// and the longest run of consecutive days from a sorted list of days
+func streaksFromDays(days []time.Time, asOf time.Time) (current, longest int) {
+	run := 0
+	for i, d := range days {
+		if i > 0 && d.Sub(days[i-1]) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	if len(days) == 0 {
+		return 0, longest
+	}
+
+	last := days[len(days)-1]
+	gap := truncateDay(asOf).Sub(last)
+	if gap <= 24*time.Hour {
+		current = run
+	}
+
+	return current, longest
+}
+
+// truncateDay returns the UTC midnight of the calendar day of t
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
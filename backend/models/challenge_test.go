@@ -0,0 +1,87 @@
+package models
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderboardScoresWeeklyTargets(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+
+	today := truncateDay(time.Now().UTC())
+	challenge := &Challenge{
+		Name: "Run", Frequency: "multiple_times_week", TargetCount: 3,
+		StartDate: today.AddDate(0, 0, -13), EndDate: today,
+	}
+	if err := CreateChallenge(db, challenge); err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	participant := &ChallengeParticipant{Name: "Ana"}
+	if err := JoinChallenge(db, challenge, participant); err != nil {
+		t.Fatalf("JoinChallenge: %v", err)
+	}
+
+	// Five runs in the first week count for three, one run in the second
+	for _, daysAgo := range []int{13, 12, 11, 10, 9, 2} {
+		_, err := db.Exec("INSERT INTO habit_completions (habit_id, completed_at) VALUES (?, ?)",
+			participant.HabitID, today.AddDate(0, 0, -daysAgo).Add(12*time.Hour))
+		if err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+	}
+
+	challenge, err := GetChallenge(db, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetChallenge: %v", err)
+	}
+	entries, err := computeLeaderboard(db, challenge, today)
+	if err != nil {
+		t.Fatalf("computeLeaderboard: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("leaderboard = %+v, want one entry", entries)
+	}
+	if want := 4.0 / 6 * 100; math.Abs(entries[0].CompletionRate-want) > 0.01 {
+		t.Errorf("completion rate = %.2f, want %.2f", entries[0].CompletionRate, want)
+	}
+	if entries[0].Completions != 6 {
+		t.Errorf("completions = %d, want 6", entries[0].Completions)
+	}
+}
+
+func TestLeaderboardFreezesParticipantsAtEnd(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+
+	today := truncateDay(time.Now().UTC())
+	challenge := &Challenge{
+		Name: "Read", Frequency: "daily", TargetCount: 1,
+		StartDate: today.AddDate(0, 0, -10), EndDate: today.AddDate(0, 0, -3),
+	}
+	if err := CreateChallenge(db, challenge); err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	for _, name := range []string{"Ana", "Ben"} {
+		if err := JoinChallenge(db, challenge, &ChallengeParticipant{Name: name}); err != nil {
+			t.Fatalf("JoinChallenge: %v", err)
+		}
+	}
+	// Ana joined before the end; Ben's row was added after it
+	_, err := db.Exec("UPDATE challenge_participants SET joined_at = ? WHERE name = 'Ana'", today.AddDate(0, 0, -10))
+	if err != nil {
+		t.Fatalf("backdate participant: %v", err)
+	}
+
+	challenge, err = GetChallenge(db, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetChallenge: %v", err)
+	}
+	leaderboard, err := GetLeaderboard(db, challenge)
+	if err != nil {
+		t.Fatalf("GetLeaderboard: %v", err)
+	}
+	if !leaderboard.Final || len(leaderboard.Entries) != 1 || leaderboard.Entries[0].Name != "Ana" {
+		t.Errorf("leaderboard = %+v, want Ana's final result only", leaderboard)
+	}
+}
@@ -0,0 +1,636 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"habits/database"
+)
+
+// ExportVersion is the version of the export document format written by
+// ExportData. Documents with a newer version are rejected on import.
+const ExportVersion = 1
+
+// Import modes
+const (
+	ImportMerge   = "merge"   // add to existing data, reusing matching records
+	ImportReplace = "replace" // delete all teams and habits first
+)
+
+// Export is a portable dump of teams, habits, their settings, completions
+// and streaks. IDs are only meaningful within the document; they are
+// remapped on import.
+type Export struct {
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Teams      []ExportTeam  `json:"teams"`
+	Habits     []ExportHabit `json:"habits"`
+}
+
+// ExportTeam is a team and its members in an export document
+type ExportTeam struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	Members   []ExportMember `json:"members"`
+}
+
+// ExportMember is a team member in an export document
+type ExportMember struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportHabit is a habit with its settings and history in an export document
+type ExportHabit struct {
+	ID          int                `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Frequency   string             `json:"frequency"`
+	TargetCount int                `json:"target_count"`
+	TeamID      int                `json:"team_id,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	Streak      *ExportStreak      `json:"streak,omitempty"` // recomputed from completions when absent
+	Rotation    *ExportRotation    `json:"rotation,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	Completions []ExportCompletion `json:"completions"`
+}
+
+// ExportStreak is a habit's streak record in an export document
+type ExportStreak struct {
+	Current            int    `json:"current"`
+	Longest            int    `json:"longest"`
+	LastCompletionDate string `json:"last_completion_date,omitempty"` // YYYY-MM-DD
+}
+
+// ExportRotation is a team habit's chore rotation in an export document
+type ExportRotation struct {
+	Strategy  string `json:"strategy"`
+	StartDate string `json:"start_date"` // YYYY-MM-DD
+	MemberIDs []int  `json:"member_ids"`
+}
+
+// ExportCompletion is a habit completion in an export document
+type ExportCompletion struct {
+	CompletedAt time.Time `json:"completed_at"`
+	MemberID    int       `json:"member_id,omitempty"`
+	Value       *float64  `json:"value,omitempty"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// ImportOptions controls how ImportData applies a document
+type ImportOptions struct {
+	Mode    string // ImportMerge or ImportReplace
+	DryRun  bool   // report the changes without making them
+	Discard bool   // let a replace delete data that export documents do not carry
+}
+
+// unexportedData is the data a replace deletes along with teams and habits
+// that export documents do not carry, by the name reported for it
+var unexportedData = []struct{ name, query string }{
+	{"challenge_participants", "SELECT COUNT(*) FROM challenge_participants"},
+	{"share_links", "SELECT COUNT(*) FROM share_links"},
+	{"activity_events", "SELECT COUNT(*) FROM activity_events"},
+	{"comments", "SELECT COUNT(*) FROM completion_comments"},
+	{"reactions", "SELECT COUNT(*) FROM completion_reactions"},
+	{"holiday_links", "SELECT COUNT(*) FROM habit_holiday_calendars"},
+	{"tag_holiday_links", "SELECT COUNT(*) FROM tag_holiday_calendars WHERE team_id IS NOT NULL"}, // personal ones survive
+	{"chore_assignments", "SELECT COUNT(*) FROM chore_assignments"},
+	{"team_calendar_feeds", "SELECT COUNT(*) FROM calendar_feeds WHERE member_id IS NOT NULL"},
+}
+
+// DiscardError refuses a replace that would delete data the document
+// cannot restore, unless ImportOptions.Discard is set
+type DiscardError struct {
+	Discarded map[string]int
+}
+
+func (e *DiscardError) Error() string {
+	var parts []string
+	for _, data := range unexportedData {
+		if n := e.Discarded[data.name]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, strings.ReplaceAll(data.name, "_", " ")))
+		}
+	}
+	return "replace would delete data that exports do not include (" + strings.Join(parts, ", ") + "); set discard=true to import anyway"
+}
+
+// ImportResult reports what an import changed, or would change on a dry run
+type ImportResult struct {
+	Mode               string          `json:"mode"`
+	DryRun             bool            `json:"dry_run"`
+	TeamsDeleted       int             `json:"teams_deleted"`
+	HabitsDeleted      int             `json:"habits_deleted"`
+	TeamsCreated       int             `json:"teams_created"`
+	TeamsMatched       int             `json:"teams_matched"`
+	MembersCreated     int             `json:"members_created"`
+	MembersMatched     int             `json:"members_matched"`
+	HabitsCreated      int             `json:"habits_created"`
+	HabitsMatched      int             `json:"habits_matched"`
+	CompletionsAdded   int             `json:"completions_added"`
+	CompletionsSkipped int             `json:"completions_skipped"` // already recorded for that day
+	Discarded          map[string]int  `json:"discarded,omitempty"` // deleted by a replace and not in the document
+	Habits             []ImportedHabit `json:"habits"`
+}
+
+// ImportedHabit reports what happened to one habit of the document
+type ImportedHabit struct {
+	SourceID           int    `json:"source_id"`
+	ID                 int    `json:"id,omitempty"` // not set on a dry run
+	Name               string `json:"name"`
+	Action             string `json:"action"` // created, merged
+	CompletionsAdded   int    `json:"completions_added"`
+	CompletionsSkipped int    `json:"completions_skipped"`
+}
+
+// ExportData reads all teams and habits into an export document, in one
+// transaction so the document is a consistent snapshot
+func ExportData(db *sql.DB) (*Export, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Read only
+
+	return exportData(tx)
+}
+
+func exportData(db querier) (*Export, error) {
+	export := &Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Teams:      []ExportTeam{},
+		Habits:     []ExportHabit{},
+	}
+
+	teams, err := getTeams(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(teams) - 1; i >= 0; i-- { // Oldest first
+		members, err := getTeamMembers(db, teams[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		team := ExportTeam{ID: teams[i].ID, Name: teams[i].Name, CreatedAt: teams[i].CreatedAt, Members: []ExportMember{}}
+		for _, m := range members {
+			team.Members = append(team.Members, ExportMember{ID: m.ID, Name: m.Name, Role: m.Role, CreatedAt: m.CreatedAt})
+		}
+		export.Teams = append(export.Teams, team)
+	}
+
+	rows, err := db.Query(`
+		SELECT h.id, h.name, COALESCE(h.description, ''), h.frequency, h.target_count, COALESCE(h.team_id, 0),
+		       h.created_at, h.updated_at, COALESCE(hs.current_streak, 0), COALESCE(hs.longest_streak, 0),
+		       hs.last_completion_date
+		FROM habits h
+		LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
+		ORDER BY h.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int) // habit ID to position in export.Habits
+	for rows.Next() {
+		var h ExportHabit
+		var streak ExportStreak
+		var lastCompletion sql.NullTime
+		err := rows.Scan(&h.ID, &h.Name, &h.Description, &h.Frequency, &h.TargetCount, &h.TeamID,
+			&h.CreatedAt, &h.UpdatedAt, &streak.Current, &streak.Longest, &lastCompletion)
+		if err != nil {
+			return nil, err
+		}
+		if lastCompletion.Valid {
+			streak.LastCompletionDate = lastCompletion.Time.Format("2006-01-02")
+		}
+		h.Streak = &streak
+		h.Completions = []ExportCompletion{}
+		index[h.ID] = len(export.Habits)
+		export.Habits = append(export.Habits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range export.Habits {
+		h := &export.Habits[i]
+		if h.TeamID == 0 {
+			continue
+		}
+		rotation, err := getRotation(db, h.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.Rotation = &ExportRotation{
+			Strategy:  rotation.Strategy,
+			StartDate: rotation.StartDate.Format("2006-01-02"),
+			MemberIDs: rotation.MemberIDs,
+		}
+	}
+
+	tags, err := loadTags(db, "1 = 1")
+	if err != nil {
+		return nil, err
+	}
+	for id, habitTags := range tags {
+		export.Habits[index[id]].Tags = habitTags
+	}
+
+	completions, err := db.Query("SELECT habit_id, COALESCE(member_id, 0), completed_at, value, note FROM habit_completions ORDER BY habit_id, completed_at")
+	if err != nil {
+		return nil, err
+	}
+	defer completions.Close()
+
+	for completions.Next() {
+		var habitID int
+		var c ExportCompletion
+		if err := completions.Scan(&habitID, &c.MemberID, &c.CompletedAt, &c.Value, &c.Note); err != nil {
+			return nil, err
+		}
+		c.CompletedAt = c.CompletedAt.UTC()
+		if i, ok := index[habitID]; ok {
+			export.Habits[i].Completions = append(export.Habits[i].Completions, c)
+		}
+	}
+
+	return export, completions.Err()
+}
+
+// validFrequency reports whether frequency is a known habit frequency
+func validFrequency(frequency string) bool {
+	return frequency == "daily" || frequency == "weekly" || frequency == "multiple_times_week"
+}
+
+// ValidateExport checks that an export document can be imported: a supported
+// version, required fields, and references that resolve within the document
+func ValidateExport(data *Export) error {
+	if data.Version < 1 || data.Version > ExportVersion {
+		return fmt.Errorf("unsupported export version %d (supported: 1 to %d)", data.Version, ExportVersion)
+	}
+
+	teamMembers := make(map[int]map[int]bool)
+	memberSeen := make(map[int]bool)
+	for _, team := range data.Teams {
+		if team.Name == "" {
+			return fmt.Errorf("team %d has no name", team.ID)
+		}
+		if _, ok := teamMembers[team.ID]; ok {
+			return fmt.Errorf("duplicate team id %d", team.ID)
+		}
+		teamMembers[team.ID] = make(map[int]bool)
+		for _, m := range team.Members {
+			if m.Name == "" {
+				return fmt.Errorf("member %d of team %d has no name", m.ID, team.ID)
+			}
+			if m.Role != "" && !ValidRole(m.Role) {
+				return fmt.Errorf("member %d of team %d has unknown role %q", m.ID, team.ID, m.Role)
+			}
+			if memberSeen[m.ID] {
+				return fmt.Errorf("duplicate member id %d", m.ID)
+			}
+			memberSeen[m.ID] = true
+			teamMembers[team.ID][m.ID] = true
+		}
+	}
+
+	habitSeen := make(map[int]bool)
+	for _, h := range data.Habits {
+		if h.Name == "" {
+			return fmt.Errorf("habit %d has no name", h.ID)
+		}
+		if habitSeen[h.ID] {
+			return fmt.Errorf("duplicate habit id %d", h.ID)
+		}
+		habitSeen[h.ID] = true
+		if h.Frequency != "" && !validFrequency(h.Frequency) {
+			return fmt.Errorf("habit %d has unknown frequency %q", h.ID, h.Frequency)
+		}
+
+		if _, err := NormalizeTags(h.Tags); err != nil {
+			return fmt.Errorf("habit %d: %v", h.ID, err)
+		}
+
+		members := teamMembers[h.TeamID]
+		if h.TeamID != 0 && members == nil {
+			return fmt.Errorf("habit %d belongs to team %d, which is not in the export", h.ID, h.TeamID)
+		}
+		for _, c := range h.Completions {
+			if c.CompletedAt.IsZero() {
+				return fmt.Errorf("habit %d has a completion without a time", h.ID)
+			}
+			if c.MemberID != 0 && !members[c.MemberID] {
+				return fmt.Errorf("habit %d has a completion by member %d, who is not in its team", h.ID, c.MemberID)
+			}
+		}
+
+		if r := h.Rotation; r != nil {
+			if h.TeamID == 0 {
+				return fmt.Errorf("habit %d has a rotation but no team", h.ID)
+			}
+			if !ValidRotationStrategy(r.Strategy) {
+				return fmt.Errorf("habit %d has unknown rotation strategy %q", h.ID, r.Strategy)
+			}
+			if _, err := time.Parse("2006-01-02", r.StartDate); err != nil {
+				return fmt.Errorf("habit %d has an invalid rotation start date %q", h.ID, r.StartDate)
+			}
+			for _, id := range r.MemberIDs {
+				if !members[id] {
+					return fmt.Errorf("habit %d rotates to member %d, who is not in its team", h.ID, id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportData applies a validated export document in one transaction. Teams,
+// members and habits get new IDs. When merging, a team matches an existing
+// team with the same name, a member an existing member of the team with the
+// same name, and a habit an existing habit with the same name in the same
+// team; matched habits gain only completions on days they lack. On a dry
+// run the transaction is rolled back after computing the result.
+func ImportData(db *sql.DB, data *Export, opts ImportOptions) (*ImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportMerge
+	}
+	if opts.Mode != ImportMerge && opts.Mode != ImportReplace {
+		return nil, fmt.Errorf("unknown import mode %q", opts.Mode)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{Mode: opts.Mode, DryRun: opts.DryRun, Habits: []ImportedHabit{}}
+
+	if opts.Mode == ImportReplace {
+		if result.Discarded, err = countUnexported(tx); err != nil {
+			return nil, err
+		}
+		if len(result.Discarded) > 0 && !opts.DryRun && !opts.Discard {
+			return nil, &DiscardError{Discarded: result.Discarded}
+		}
+
+		// Everything else hangs off teams and habits and cascades
+		if result.HabitsDeleted, err = deleteAll(tx, "habits"); err != nil {
+			return nil, err
+		}
+		if result.TeamsDeleted, err = deleteAll(tx, "teams"); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	teamIDs := make(map[int]int)
+	memberIDs := make(map[int]int)
+	for _, team := range data.Teams {
+		id, matched, err := importTeam(tx, team, now)
+		if err != nil {
+			return nil, err
+		}
+		teamIDs[team.ID] = id
+		if matched {
+			result.TeamsMatched++
+		} else {
+			result.TeamsCreated++
+		}
+
+		for _, m := range team.Members {
+			memberID, matched, err := importMember(tx, id, m, now)
+			if err != nil {
+				return nil, err
+			}
+			memberIDs[m.ID] = memberID
+			if matched {
+				result.MembersMatched++
+			} else {
+				result.MembersCreated++
+			}
+		}
+	}
+
+	for _, h := range data.Habits {
+		imported, err := importHabit(tx, h, teamIDs[h.TeamID], memberIDs, now)
+		if err != nil {
+			return nil, err
+		}
+		if imported.Action == "merged" {
+			result.HabitsMatched++
+		} else {
+			result.HabitsCreated++
+		}
+		result.CompletionsAdded += imported.CompletionsAdded
+		result.CompletionsSkipped += imported.CompletionsSkipped
+
+		if opts.DryRun {
+			imported.ID = 0
+		}
+		result.Habits = append(result.Habits, *imported)
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
+
+// countUnexported counts the rows of unexportedData, leaving out empty ones
+func countUnexported(tx *sql.Tx) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, data := range unexportedData {
+		var n int
+		if err := tx.QueryRow(data.query).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			counts[data.name] = n
+		}
+	}
+	return counts, nil
+}
+
+// deleteAll deletes every row of table, returning how many there were
+func deleteAll(tx *sql.Tx, table string) (int, error) {
+	res, err := tx.Exec("DELETE FROM " + table)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// importTeam finds a team with the same name or creates it
+func importTeam(tx *sql.Tx, team ExportTeam, now time.Time) (int, bool, error) {
+	var id int
+	err := tx.QueryRow("SELECT id FROM teams WHERE name = ? ORDER BY id LIMIT 1", team.Name).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	res, err := tx.Exec("INSERT INTO teams (name, created_at) VALUES (?, ?)", team.Name, orNow(team.CreatedAt, now))
+	if err != nil {
+		return 0, false, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), false, err
+}
+
+// importMember finds a member of the team with the same name or adds it
+func importMember(tx *sql.Tx, teamID int, m ExportMember, now time.Time) (int, bool, error) {
+	var id int
+	err := tx.QueryRow("SELECT id FROM team_members WHERE team_id = ? AND name = ? ORDER BY id LIMIT 1", teamID, m.Name).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	role := m.Role
+	if role == "" {
+		role = RoleMember
+	}
+	res, err := tx.Exec("INSERT INTO team_members (team_id, name, role, created_at) VALUES (?, ?, ?, ?)",
+		teamID, m.Name, role, orNow(m.CreatedAt, now))
+	if err != nil {
+		return 0, false, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), false, err
+}
+
+// importHabit finds a habit with the same name in the team or creates it,
+// then adds its completions. Created habits keep the document's streak and
+// rotation; merged habits keep their own rotation and have their streak
+// recomputed if completions were added.
+func importHabit(tx *sql.Tx, h ExportHabit, teamID int, memberIDs map[int]int, now time.Time) (*ImportedHabit, error) {
+	imported := &ImportedHabit{SourceID: h.ID, Name: h.Name, Action: "merged"}
+
+	err := tx.QueryRow("SELECT id FROM habits WHERE name = ? AND COALESCE(team_id, 0) = ? ORDER BY id LIMIT 1", h.Name, teamID).Scan(&imported.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	created := err == sql.ErrNoRows
+
+	if created {
+		imported.Action = "created"
+		frequency := h.Frequency
+		if frequency == "" {
+			frequency = "daily"
+		}
+		targetCount := h.TargetCount
+		if targetCount == 0 {
+			targetCount = 1
+		}
+
+		res, err := tx.Exec(`
+			INSERT INTO habits (name, description, frequency, target_count, team_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, h.Name, h.Description, frequency, targetCount, nullableID(teamID), orNow(h.CreatedAt, now), orNow(h.UpdatedAt, now))
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		imported.ID = int(id)
+
+		if _, err := tx.Exec("INSERT INTO habit_streaks (habit_id, current_streak, longest_streak) VALUES (?, 0, 0)", imported.ID); err != nil {
+			return nil, err
+		}
+
+		if r := h.Rotation; r != nil {
+			if err := importRotation(tx, imported.ID, r, memberIDs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tags, err := NormalizeTags(h.Tags) // Checked by ValidateExport
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO habit_tags (habit_id, tag) VALUES (?, ?)", imported.ID, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range h.Completions {
+		res, err := tx.Exec("INSERT OR IGNORE INTO habit_completions (habit_id, member_id, completed_at, value, note) VALUES (?, ?, ?, ?, ?)",
+			imported.ID, nullableID(memberIDs[c.MemberID]), c.CompletedAt.UTC(), c.Value, c.Note)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			imported.CompletionsSkipped++
+		} else {
+			imported.CompletionsAdded++
+		}
+	}
+
+	if created && h.Streak != nil {
+		var lastCompletion interface{}
+		if h.Streak.LastCompletionDate != "" {
+			lastCompletion = h.Streak.LastCompletionDate
+		}
+		_, err := tx.Exec("UPDATE habit_streaks SET current_streak = ?, longest_streak = ?, last_completion_date = ? WHERE habit_id = ?",
+			h.Streak.Current, h.Streak.Longest, lastCompletion, imported.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else if imported.CompletionsAdded > 0 {
+		if err := recalculateStreak(tx, database.SQLite, imported.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return imported, nil
+}
+
+// importRotation recreates a habit's rotation with remapped members
+func importRotation(tx *sql.Tx, habitID int, r *ExportRotation, memberIDs map[int]int) error {
+	_, err := tx.Exec("INSERT INTO habit_rotations (habit_id, strategy, start_date) VALUES (?, ?, ?)", habitID, r.Strategy, r.StartDate)
+	if err != nil {
+		return err
+	}
+
+	for position, memberID := range r.MemberIDs {
+		_, err := tx.Exec("INSERT INTO rotation_members (habit_id, member_id, position) VALUES (?, ?, ?)", habitID, memberIDs[memberID], position)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orNow returns t, or now when t is unset
+func orNow(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
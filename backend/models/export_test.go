@@ -0,0 +1,176 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"habits/database"
+)
+
+// seedExport fills a database with a team habit on a rotation and a personal
+// habit, both with some history
+func seedExport(t *testing.T) *Export {
+	t.Helper()
+
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+
+	team := &Team{Name: "Household"}
+	owner := &TeamMember{Name: "Ana"}
+	if err := CreateTeam(db, team, owner); err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	member := &TeamMember{TeamID: team.ID, Name: "Ben", Role: RoleAdmin}
+	if err := AddTeamMember(db, member); err != nil {
+		t.Fatalf("AddTeamMember: %v", err)
+	}
+
+	chore := &Habit{Name: "Dishes", Frequency: "daily", TargetCount: 1, TeamID: team.ID}
+	read := &Habit{Name: "Read", Description: "20 pages", Frequency: "multiple_times_week", TargetCount: 3}
+	for _, habit := range []*Habit{chore, read} {
+		if err := CreateHabit(db, habit); err != nil {
+			t.Fatalf("CreateHabit: %v", err)
+		}
+	}
+	if err := SetRotation(db, chore, &Rotation{Strategy: RotationLeastRecent, MemberIDs: []int{member.ID, owner.ID}}); err != nil {
+		t.Fatalf("SetRotation: %v", err)
+	}
+
+	today := truncateDay(time.Now().UTC())
+	for daysAgo := 1; daysAgo <= 4; daysAgo++ {
+		at := today.AddDate(0, 0, -daysAgo).Add(8 * time.Hour)
+		by := owner.ID
+		if daysAgo%2 == 0 {
+			by = member.ID
+		}
+		if _, err := db.Exec("INSERT INTO habit_completions (habit_id, member_id, completed_at) VALUES (?, ?, ?)", chore.ID, by, at); err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+		_, err := db.Exec("INSERT INTO habit_completions (habit_id, completed_at, value, note) VALUES (?, ?, ?, ?)",
+			read.ID, at.Add(12*time.Hour), 20+daysAgo, fmt.Sprintf("chapter %d", 5-daysAgo))
+		if err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+	}
+	if err := SetHabitTags(db, read.ID, []string{"Evening", "learning"}); err != nil {
+		t.Fatalf("SetHabitTags: %v", err)
+	}
+	for _, habit := range []*Habit{chore, read} {
+		if err := recalculateStreak(db, database.SQLite, habit.ID); err != nil {
+			t.Fatalf("recalculateStreak: %v", err)
+		}
+	}
+
+	export, err := ExportData(db)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	return export
+}
+
+// canonicalExport describes an export without its IDs, which imports remap,
+// so exports of the same data compare equal
+func canonicalExport(e *Export) string {
+	var b strings.Builder
+	teams := make(map[int]string)
+	members := make(map[int]string)
+	for _, team := range e.Teams {
+		teams[team.ID] = team.Name
+		fmt.Fprintf(&b, "team %q\n", team.Name)
+		for _, m := range team.Members {
+			members[m.ID] = m.Name
+			fmt.Fprintf(&b, "  member %q %s\n", m.Name, m.Role)
+		}
+	}
+	for _, h := range e.Habits {
+		fmt.Fprintf(&b, "habit %q %q %s/%d team %q tags %q streak %+v\n", h.Name, h.Description, h.Frequency, h.TargetCount, teams[h.TeamID], h.Tags, *h.Streak)
+		if r := h.Rotation; r != nil {
+			fmt.Fprintf(&b, "  rotation %s from %s:", r.Strategy, r.StartDate)
+			for _, id := range r.MemberIDs {
+				fmt.Fprintf(&b, " %q", members[id])
+			}
+			b.WriteString("\n")
+		}
+		for _, c := range h.Completions {
+			fmt.Fprintf(&b, "  done %s by %q", c.CompletedAt.Format(time.RFC3339), members[c.MemberID])
+			if c.Value != nil {
+				fmt.Fprintf(&b, " value %g", *c.Value)
+			}
+			fmt.Fprintf(&b, " note %q\n", c.Note)
+		}
+	}
+	return b.String()
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	export := seedExport(t)
+	if got := canonicalExport(export); !strings.Contains(got, `tags ["evening" "learning"]`) || !strings.Contains(got, `value 21 note "chapter 4"`) {
+		t.Fatalf("export lacks the tags, values or notes:\n%s", got)
+	}
+	if err := ValidateExport(export); err != nil {
+		t.Fatalf("ValidateExport: %v", err)
+	}
+
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+	result, err := ImportData(db, export, ImportOptions{Mode: ImportReplace})
+	if err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+	if result.TeamsCreated != 1 || result.MembersCreated != 2 || result.HabitsCreated != 2 || result.CompletionsAdded != 8 {
+		t.Errorf("import result = %+v, want 1 team, 2 members, 2 habits and 8 completions created", result)
+	}
+
+	reexport, err := ExportData(db)
+	if err != nil {
+		t.Fatalf("ExportData after import: %v", err)
+	}
+	if got, want := canonicalExport(reexport), canonicalExport(export); got != want {
+		t.Errorf("export after import:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestImportIsIdempotent(t *testing.T) {
+	export := seedExport(t)
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+
+	if _, err := ImportData(db, export, ImportOptions{Mode: ImportMerge}); err != nil {
+		t.Fatalf("first ImportData: %v", err)
+	}
+	first, err := ExportData(db)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+
+	result, err := ImportData(db, export, ImportOptions{Mode: ImportMerge})
+	if err != nil {
+		t.Fatalf("second ImportData: %v", err)
+	}
+	if result.TeamsCreated != 0 || result.MembersCreated != 0 || result.HabitsCreated != 0 || result.CompletionsAdded != 0 {
+		t.Errorf("second import = %+v, want everything matched", result)
+	}
+	if result.TeamsMatched != 1 || result.MembersMatched != 2 || result.HabitsMatched != 2 || result.CompletionsSkipped != 8 {
+		t.Errorf("second import = %+v, want 1 team, 2 members, 2 habits matched and 8 completions skipped", result)
+	}
+
+	second, err := ExportData(db)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	if got, want := canonicalExport(second), canonicalExport(first); got != want {
+		t.Errorf("export after importing twice:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A dry run changes nothing either
+	if _, err := ImportData(db, export, ImportOptions{Mode: ImportReplace, DryRun: true}); err != nil {
+		t.Fatalf("dry run ImportData: %v", err)
+	}
+	third, err := ExportData(db)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	if got, want := canonicalExport(third), canonicalExport(first); got != want {
+		t.Errorf("export after a dry run:\n%s\nwant:\n%s", got, want)
+	}
+}
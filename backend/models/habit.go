@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql"
 	"time"
+
+	"habits/database"
 )
 
 // Habit represents a habit in the system
@@ -12,20 +14,33 @@ type Habit struct {
 	Description string    `json:"description"`
 	Frequency   string    `json:"frequency"` // daily, weekly, multiple_times_week
 	TargetCount int       `json:"target_count"`
+	TeamID      int       `json:"team_id,omitempty"` // 0 for personal habits
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	// Computed fields
-	CurrentStreak    int     `json:"current_streak"`
-	LongestStreak    int     `json:"longest_streak"`
-	CompletionRate   float64 `json:"completion_rate"`
-	IsCompletedToday bool    `json:"is_completed_today"`
+	CurrentStreak     int     `json:"current_streak"`
+	LongestStreak     int     `json:"longest_streak"`
+	CompletionRate    float64 `json:"completion_rate"` // % of periods meeting the target, last 4 weeks
+	IsCompletedToday  bool    `json:"is_completed_today"`
+	PeriodCompletions int     `json:"period_completions"` // completions in the current day or week
+	PeriodTarget      int     `json:"period_target"`
+	IsSkipDay         bool    `json:"is_skip_day"` // today is a holiday for this habit
 }
 
 // HabitCompletion represents a habit completion record
 type HabitCompletion struct {
 	ID          int       `json:"id"`
 	HabitID     int       `json:"habit_id"`
+	MemberID    int       `json:"member_id,omitempty"` // team member who completed it
 	CompletedAt time.Time `json:"completed_at"`
+	Value       *float64  `json:"value,omitempty"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// CompletionDetails is what a completion can record besides who made it
+type CompletionDetails struct {
+	Value *float64 `json:"value"` // a quantity such as pages read, nil when not measured
+	Note  string   `json:"note"`
 }
 
 // HabitStreak represents streak data for a habit
@@ -37,14 +52,22 @@ type HabitStreak struct {
 	LastCompletionDate time.Time `json:"last_completion_date"`
 }
 
+// querier is implemented by both *sql.DB and *sql.Tx, so helpers can run
+// standalone or as part of a transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // CreateHabit creates a new habit in the database
 func CreateHabit(db *sql.DB, habit *Habit) error {
 	query := `
-		INSERT INTO habits (name, description, frequency, target_count, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO habits (name, description, frequency, target_count, team_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := db.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, time.Now(), time.Now())
+	result, err := db.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, nullableID(habit.TeamID), time.Now(), time.Now())
 	if err != nil {
 		return err
 	}
@@ -64,18 +87,42 @@ func CreateHabit(db *sql.DB, habit *Habit) error {
 	return err
 }
 
-// GetHabits retrieves all habits with their current streaks
+// habitSelect is the base query for reading habits with their streaks
+const habitSelect = `
+	SELECT h.id, h.name, h.description, h.frequency, h.target_count, h.team_id, h.created_at, h.updated_at,
+	       COALESCE(hs.current_streak, 0) as current_streak,
+	       COALESCE(hs.longest_streak, 0) as longest_streak
+	FROM habits h
+	LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
+`
+
+// scanHabit scans a row produced by habitSelect
+func scanHabit(scanner interface{ Scan(...interface{}) error }, habit *Habit) error {
+	var teamID sql.NullInt64
+	err := scanner.Scan(
+		&habit.ID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &teamID,
+		&habit.CreatedAt, &habit.UpdatedAt, &habit.CurrentStreak, &habit.LongestStreak,
+	)
+	habit.TeamID = int(teamID.Int64)
+	return err
+}
+
+// GetHabits retrieves the personal habits with their current streaks and
+// progress. Team habits are only listed to members, with GetTeamHabits.
 func GetHabits(db *sql.DB) ([]Habit, error) {
-	query := `
-		SELECT h.id, h.name, h.description, h.frequency, h.target_count, h.created_at, h.updated_at,
-		       COALESCE(hs.current_streak, 0) as current_streak,
-		       COALESCE(hs.longest_streak, 0) as longest_streak
-		FROM habits h
-		LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
-		ORDER BY h.created_at DESC
-	`
+	return queryHabits(db, "h.team_id IS NULL")
+}
+
+// GetTeamHabits retrieves all habits belonging to a team
+func GetTeamHabits(db *sql.DB, teamID int) ([]Habit, error) {
+	return queryHabits(db, "h.team_id = ?", teamID)
+}
 
-	rows, err := db.Query(query)
+// queryHabits reads the habits matching where (a condition on habits h) and
+// their progress, in three queries however many habits match: the habits,
+// their holidays and their completions over the progress window
+func queryHabits(db *sql.DB, where string, args ...interface{}) ([]Habit, error) {
+	rows, err := db.Query(habitSelect+" WHERE "+where+" ORDER BY h.created_at DESC", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,18 +131,32 @@ func GetHabits(db *sql.DB) ([]Habit, error) {
 	var habits []Habit
 	for rows.Next() {
 		var habit Habit
-		err := rows.Scan(
-			&habit.ID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount,
-			&habit.CreatedAt, &habit.UpdatedAt, &habit.CurrentStreak, &habit.LongestStreak,
-		)
-		if err != nil {
+		if err := scanHabit(rows, &habit); err != nil {
 			return nil, err
 		}
+		habits = append(habits, habit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		// Check if completed today
-		habit.IsCompletedToday, _ = IsHabitCompletedToday(db, habit.ID)
+	if len(habits) == 0 {
+		return habits, nil
+	}
 
-		habits = append(habits, habit)
+	now := time.Now()
+	dateArg := func(day time.Time) interface{} {
+		return day.Format("2006-01-02")
+	}
+	skipQuery, skipArgs := skipDaysQuery(where, args, now, dateArg)
+	skip, err := loadSkipDays(db, skipQuery, skipArgs...)
+	if err != nil {
+		return nil, err
+	}
+	query, args := progressQuery(where, args, now, dateArg)
+	if err := loadProgress(db, habits, now, skip, query, args...); err != nil {
+		return nil, err
 	}
 
 	return habits, nil
@@ -103,28 +164,15 @@ func GetHabits(db *sql.DB) ([]Habit, error) {
 
 // GetHabit retrieves a single habit by ID
 func GetHabit(db *sql.DB, id int) (*Habit, error) {
-	query := `
-		SELECT h.id, h.name, h.description, h.frequency, h.target_count, h.created_at, h.updated_at,
-		       COALESCE(hs.current_streak, 0) as current_streak,
-		       COALESCE(hs.longest_streak, 0) as longest_streak
-		FROM habits h
-		LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
-		WHERE h.id = ?
-	`
-
-	var habit Habit
-	err := db.QueryRow(query, id).Scan(
-		&habit.ID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount,
-		&habit.CreatedAt, &habit.UpdatedAt, &habit.CurrentStreak, &habit.LongestStreak,
-	)
+	habits, err := queryHabits(db, "h.id = ?", id)
 	if err != nil {
 		return nil, err
 	}
+	if len(habits) == 0 {
+		return nil, sql.ErrNoRows
+	}
 
-	// Check if completed today
-	habit.IsCompletedToday, _ = IsHabitCompletedToday(db, habit.ID)
-
-	return &habit, nil
+	return &habits[0], nil
 }
 
 // UpdateHabit updates an existing habit
@@ -139,28 +187,23 @@ func UpdateHabit(db *sql.DB, habit *Habit) error {
 	return err
 }
 
-// DeleteHabit deletes a habit and all related data
+// DeleteHabit deletes a habit. Its completions, streak, rotation, activity
+// and share links are removed by the cascading foreign keys.
 func DeleteHabit(db *sql.DB, id int) error {
-	// Delete in order due to foreign key constraints
-	_, err := db.Exec("DELETE FROM habit_completions WHERE habit_id = ?", id)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("DELETE FROM habit_streaks WHERE habit_id = ?", id)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("DELETE FROM habits WHERE id = ?", id)
+	_, err := db.Exec("DELETE FROM habits WHERE id = ?", id)
 	return err
 }
 
+// completedToday matches completions made today. Completion times are stored
+// in UTC, so a range on the raw column matches DATE(completed_at) while still
+// using the (habit_id, completed_at) index.
+const completedToday = "completed_at >= DATE('now') AND completed_at < DATE('now', '+1 day')"
+
 // IsHabitCompletedToday checks if a habit was completed today
 func IsHabitCompletedToday(db *sql.DB, habitID int) (bool, error) {
 	query := `
 		SELECT COUNT(*) FROM habit_completions 
-		WHERE habit_id = ? AND DATE(completed_at) = DATE('now')
+		WHERE habit_id = ? AND ` + completedToday + `
 	`
 
 	var count int
@@ -170,127 +213,233 @@ func IsHabitCompletedToday(db *sql.DB, habitID int) (bool, error) {
 
 // CompleteHabit marks a habit as completed for today
 func CompleteHabit(db *sql.DB, habitID int) error {
-	// Check if already completed today
-	completed, err := IsHabitCompletedToday(db, habitID)
+	return CompleteHabitAs(db, habitID, 0)
+}
+
+// CompleteHabitAs marks a habit as completed for today by a team member.
+// A memberID of 0 records the completion without a member.
+func CompleteHabitAs(db *sql.DB, habitID, memberID int) error {
+	return CompleteHabitWithDetails(db, habitID, memberID, CompletionDetails{})
+}
+
+// CompleteHabitWithDetails marks a habit as completed for today by a team
+// member (or none when memberID is 0), recording a value and note. The
+// completion, streak and activity are written in one transaction, and the
+// unique daily completion index makes concurrent duplicate requests a no-op.
+func CompleteHabitWithDetails(db *sql.DB, habitID, memberID int, details CompletionDetails) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Insert completion record unless the habit is already completed today
+	now := time.Now().UTC()
+	result, err := tx.Exec("INSERT OR IGNORE INTO habit_completions (habit_id, member_id, completed_at, value, note) VALUES (?, ?, ?, ?, ?)",
+		habitID, nullableID(memberID), now, details.Value, details.Note)
 	if err != nil {
 		return err
 	}
-	if completed {
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
 		return nil // Already completed today
 	}
 
-	// Insert completion record
-	_, err = db.Exec("INSERT INTO habit_completions (habit_id, completed_at) VALUES (?, ?)", habitID, time.Now())
+	completionID, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
 
-	// Update streak
-	return UpdateHabitStreak(db, habitID)
+	// Rebuild the streak, which may have broken since the last completion
+	if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+		return err
+	}
+
+	if err := recordCompletionActivity(tx, habitID, int(completionID), memberID); err != nil {
+		return err
+	}
+
+	// Keep who was assigned the chore this period, whatever the rotation becomes
+	if err := recordAssignment(tx, habitID, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // UncompleteHabit removes the completion for today
 func UncompleteHabit(db *sql.DB, habitID int) error {
-	// Check if completed today
-	completed, err := IsHabitCompletedToday(db, habitID)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	if !completed {
-		return nil // Not completed today
+	defer tx.Rollback()
+
+	// Delete completion record for today; its reactions and comments cascade
+	result, err := tx.Exec("DELETE FROM habit_completions WHERE habit_id = ? AND "+completedToday, habitID)
+	if err != nil {
+		return err
 	}
 
-	// Delete completion record for today
-	_, err = db.Exec("DELETE FROM habit_completions WHERE habit_id = ? AND DATE(completed_at) = DATE('now')", habitID)
+	deleted, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if deleted == 0 {
+		return nil // Not completed today
+	}
+
+	// Rebuild the streak from the remaining completions
+	if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+		return err
+	}
 
-	// Update streak (decrease it)
-	return UpdateHabitStreakOnUncomplete(db, habitID)
+	return tx.Commit()
 }
 
-// UpdateHabitStreak updates the streak for a habit
-func UpdateHabitStreak(db *sql.DB, habitID int) error {
-	// This is a simplified streak calculation
-	// In a real implementation, you'd want more sophisticated logic
-	query := `
-		UPDATE habit_streaks 
-		SET current_streak = current_streak + 1,
-		    longest_streak = CASE 
-		        WHEN current_streak + 1 > longest_streak THEN current_streak + 1
-		        ELSE longest_streak
-		    END,
-		    last_completion_date = DATE('now')
+// GetCompletions retrieves all completions of a habit, oldest first
+func GetCompletions(db *sql.DB, habitID int) ([]HabitCompletion, error) {
+	rows, err := db.Query(`
+		SELECT id, habit_id, COALESCE(member_id, 0), completed_at, value, note
+		FROM habit_completions
 		WHERE habit_id = ?
-	`
+		ORDER BY completed_at
+	`, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	_, err := db.Exec(query, habitID)
-	return err
+	completions := []HabitCompletion{}
+	for rows.Next() {
+		var c HabitCompletion
+		if err := rows.Scan(&c.ID, &c.HabitID, &c.MemberID, &c.CompletedAt, &c.Value, &c.Note); err != nil {
+			return nil, err
+		}
+		completions = append(completions, c)
+	}
+
+	return completions, rows.Err()
+}
+
+// GetStreak retrieves the streak record of a habit
+func GetStreak(db *sql.DB, habitID int) (*HabitStreak, error) {
+	var streak HabitStreak
+	var lastCompletion sql.NullTime
+	err := db.QueryRow(`
+		SELECT id, habit_id, current_streak, longest_streak, last_completion_date
+		FROM habit_streaks
+		WHERE habit_id = ?
+	`, habitID).Scan(&streak.ID, &streak.HabitID, &streak.CurrentStreak, &streak.LongestStreak, &lastCompletion)
+	if err != nil {
+		return nil, err
+	}
+
+	streak.LastCompletionDate = lastCompletion.Time
+	return &streak, nil
 }
 
-// UpdateHabitStreakOnUncomplete updates the streak when a habit is uncompleted
+// UpdateHabitStreak recalculates the streak for a habit from its completions
+func UpdateHabitStreak(db *sql.DB, habitID int) error {
+	return recalculateStreak(db, database.SQLite, habitID)
+}
+
+// UpdateHabitStreakOnUncomplete updates the streak when a habit is
+// uncompleted, by recalculating it from the remaining completions
 func UpdateHabitStreakOnUncomplete(db *sql.DB, habitID int) error {
-	// Get current and longest streak before updating
-	var currentStreak, longestStreak int
-	err := db.QueryRow("SELECT current_streak, longest_streak FROM habit_streaks WHERE habit_id = ?", habitID).Scan(&currentStreak, &longestStreak)
+	return recalculateStreak(db, database.SQLite, habitID)
+}
+
+// recalculateStreak rebuilds a habit's streak record from its completion
+// history, for when completions are added out of order (e.g. on import) or
+// its skip days change, and after every completion or uncompletion. The
+// current streak counts the run of consecutive days ending with the last
+// completion, if that was today or yesterday. Skip days between completions
+// do not break a run.
+func recalculateStreak(db querier, d database.Dialect, habitID int) error {
+	if d == database.Postgres {
+		// Rebuilds of one habit's streak wait for each other, so each reads
+		// the completions the previous one committed. SQLite writes are
+		// serialized already.
+		var id int
+		err := db.QueryRow("SELECT id FROM habit_streaks WHERE habit_id = $1 FOR UPDATE", habitID).Scan(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	skip, err := habitSkipDays(db, d, habitID)
 	if err != nil {
 		return err
 	}
 
-	// Decrease the current streak by 1, but don't go below 0
-	newCurrentStreak := currentStreak - 1
-	if newCurrentStreak < 0 {
-		newCurrentStreak = 0
+	// skipped reports whether every day strictly between from and to is a skip day
+	skipped := func(from, to time.Time) bool {
+		for day := from.AddDate(0, 0, 1); day.Before(to); day = day.AddDate(0, 0, 1) {
+			if !skip[day] {
+				return false
+			}
+		}
+		return true
 	}
 
-	// Update current streak
-	_, err = db.Exec("UPDATE habit_streaks SET current_streak = ? WHERE habit_id = ?", newCurrentStreak, habitID)
+	// Dates are read as text, which both dialects write as YYYY-MM-DD
+	day := "CAST(" + d.Date("completed_at") + " AS TEXT)"
+	rows, err := db.Query(d.Rebind("SELECT DISTINCT "+day+" FROM habit_completions WHERE habit_id = ? ORDER BY 1"), habitID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	// If the current streak was equal to the longest streak and we're decreasing it,
-	// we need to recalculate the longest streak from the remaining completions
-	if currentStreak == longestStreak && currentStreak > 0 {
-		// Calculate the actual longest streak from completion history
-		query := `
-			WITH consecutive_days AS (
-				SELECT 
-					DATE(completed_at) as completion_date,
-					ROW_NUMBER() OVER (ORDER BY DATE(completed_at)) as row_num
-				FROM habit_completions 
-				WHERE habit_id = ?
-				ORDER BY DATE(completed_at)
-			),
-			streaks AS (
-				SELECT 
-					completion_date,
-					DATE(completion_date, '-' || (row_num - 1) || ' days') as streak_start
-				FROM consecutive_days
-			),
-			streak_lengths AS (
-				SELECT 
-					streak_start,
-					COUNT(*) as length
-				FROM streaks
-				GROUP BY streak_start
-			)
-			SELECT COALESCE(MAX(length), 0) as max_streak
-			FROM streak_lengths
-		`
-
-		var actualLongestStreak int
-		err = db.QueryRow(query, habitID).Scan(&actualLongestStreak)
+	var last time.Time
+	run, longest := 0, 0
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return err
+		}
+		date, err := time.Parse("2006-01-02", day[:min(len(day), 10)])
 		if err != nil {
 			return err
 		}
 
-		// Update the longest streak if it's different
-		if actualLongestStreak != longestStreak {
-			_, err = db.Exec("UPDATE habit_streaks SET longest_streak = ? WHERE habit_id = ?", actualLongestStreak, habitID)
+		if !last.IsZero() && skipped(last, date) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
 		}
+		last = date
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	current := run
+	if last.IsZero() || !skipped(last, truncateDay(time.Now().UTC())) {
+		current = 0 // Broken since the last completion
 	}
 
+	var lastCompletion interface{}
+	if !last.IsZero() {
+		lastCompletion = last.Format("2006-01-02")
+	}
+	_, err = db.Exec(d.Rebind("UPDATE habit_streaks SET current_streak = ?, longest_streak = ?, last_completion_date = ? WHERE habit_id = ?"),
+		current, longest, lastCompletion, habitID)
 	return err
 }
+
+// nullableID maps a zero ID to NULL for optional foreign keys
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"habits/database"
+)
+
+// statements counts the statements run through the sqlite3_counting driver
+var statements atomic.Int64
+
+func init() {
+	sql.Register("sqlite3_counting", countingDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// countingDriver wraps the SQLite driver to count the statements run on
+// its connections
+type countingDriver struct {
+	driver.Driver
+}
+
+func (d countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type countingConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	statements.Add(1)
+	return c.SQLiteConn.Prepare(query)
+}
+
+func (c countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	statements.Add(1)
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	statements.Add(1)
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+// seedHabits creates n personal habits, each completed on the last two
+// weeks' even days
+func seedHabits(b *testing.B, db *sql.DB, n int) {
+	b.Helper()
+
+	for i := 0; i < n; i++ {
+		habit := &Habit{Name: fmt.Sprintf("Habit %d", i), Frequency: "daily", TargetCount: 1}
+		if i%3 == 0 {
+			habit.Frequency, habit.TargetCount = "weekly", 3
+		}
+		if err := CreateHabit(db, habit); err != nil {
+			b.Fatalf("CreateHabit: %v", err)
+		}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	_, err := db.Exec(`
+		WITH RECURSIVE days(n) AS (SELECT 0 UNION ALL SELECT n + 2 FROM days WHERE n < 12)
+		INSERT INTO habit_completions (habit_id, completed_at)
+		SELECT h.id, DATETIME(?, '-' || days.n || ' days', '+12 hours')
+		FROM habits h, days
+	`, today.Format("2006-01-02"))
+	if err != nil {
+		b.Fatalf("seed completions: %v", err)
+	}
+}
+
+func TestConcurrentCompletionsStayUnique(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+
+	habit := &Habit{Name: "Stretch", Frequency: "daily", TargetCount: 1}
+	if err := CreateHabit(db, habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+
+	// Many clients completing the habit at once record it once
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- CompleteHabit(db, habit.ID)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("CompleteHabit: %v", err)
+		}
+	}
+
+	completions, err := GetCompletions(db, habit.ID)
+	if err != nil {
+		t.Fatalf("GetCompletions: %v", err)
+	}
+	if len(completions) != 1 {
+		t.Errorf("GetCompletions = %d completions, want 1", len(completions))
+	}
+	streak, err := GetStreak(db, habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak: %v", err)
+	}
+	if streak.CurrentStreak != 1 {
+		t.Errorf("streak = %d, want 1", streak.CurrentStreak)
+	}
+
+	// The unique index holds even for a second row inserted directly
+	_, err = db.Exec("INSERT INTO habit_completions (habit_id, completed_at) VALUES (?, ?)", habit.ID, time.Now().UTC())
+	if err == nil {
+		t.Error("inserting a second completion for today succeeded, want a unique constraint error")
+	}
+}
+
+// BenchmarkGetHabits lists habits with their progress, reporting the
+// statements per listing, which stay the same however many habits there are
+func BenchmarkGetHabits(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("habits=%d", n), func(b *testing.B) {
+			db, err := sql.Open("sqlite3_counting", filepath.Join(b.TempDir(), "habits.db")+"?_foreign_keys=on&_journal_mode=WAL")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			if err := database.Migrate(db); err != nil {
+				b.Fatalf("migrate: %v", err)
+			}
+			seedHabits(b, db, n)
+
+			b.ResetTimer()
+			start := statements.Load()
+			for i := 0; i < b.N; i++ {
+				habits, err := GetHabits(db)
+				if err != nil {
+					b.Fatalf("GetHabits: %v", err)
+				}
+				if len(habits) != n {
+					b.Fatalf("GetHabits = %d habits, want %d", len(habits), n)
+				}
+			}
+			b.StopTimer()
+
+			perListing := float64(statements.Load()-start) / float64(b.N)
+			b.ReportMetric(perListing, "queries/op")
+			if perListing != 3 {
+				b.Errorf("GetHabits ran %.1f queries per listing, want 3", perListing)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"habits/database"
+)
+
+// ErrUnknownHolidayCalendar is returned when attaching a calendar that does not exist
+var ErrUnknownHolidayCalendar = errors.New("unknown holiday calendar")
+
+// HabitCalendarLinks is a subquery of the holiday calendars (calendar_id)
+// each habit (habit_id) skips: those attached to it and those attached to
+// one of its tags in its team, or among personal habits
+const HabitCalendarLinks = `(
+	SELECT habit_id, calendar_id FROM habit_holiday_calendars
+	UNION
+	SELECT ht.habit_id, tc.calendar_id
+	FROM tag_holiday_calendars tc
+	JOIN habit_tags ht ON ht.tag = tc.tag
+	JOIN habits th ON th.id = ht.habit_id
+	WHERE COALESCE(tc.team_id, 0) = COALESCE(th.team_id, 0)
+)`
+
+// HolidayCalendar is a named set of dates that habits can treat as skip days
+type HolidayCalendar struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Computed fields
+	Holidays []Holiday `json:"holidays,omitempty"`
+	HabitIDs []int     `json:"habit_ids"` // habits skipping its dates, directly or through a tag
+}
+
+// Holiday is a date in a holiday calendar
+type Holiday struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name,omitempty"`
+}
+
+// CreateHolidayCalendar creates a calendar with its holidays. Repeated dates
+// keep the first name given.
+func CreateHolidayCalendar(db *sql.DB, calendar *HolidayCalendar) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	calendar.CreatedAt = time.Now()
+	result, err := tx.Exec("INSERT INTO holiday_calendars (name, created_at) VALUES (?, ?)", calendar.Name, calendar.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	calendar.ID = int(id)
+	calendar.HabitIDs = []int{}
+
+	for _, holiday := range calendar.Holidays {
+		_, err := tx.Exec("INSERT OR IGNORE INTO holidays (calendar_id, date, name) VALUES (?, ?, ?)", calendar.ID, holiday.Date, holiday.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetHolidayCalendars retrieves all holiday calendars with the habits they
+// are attached to, without their holidays
+func GetHolidayCalendars(db *sql.DB) ([]HolidayCalendar, error) {
+	rows, err := db.Query("SELECT id, name, created_at FROM holiday_calendars ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calendars := []HolidayCalendar{}
+	index := make(map[int]int)
+	for rows.Next() {
+		calendar := HolidayCalendar{HabitIDs: []int{}}
+		if err := rows.Scan(&calendar.ID, &calendar.Name, &calendar.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[calendar.ID] = len(calendars)
+		calendars = append(calendars, calendar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	links, err := db.Query("SELECT calendar_id, habit_id FROM " + HabitCalendarLinks + " hc ORDER BY habit_id")
+	if err != nil {
+		return nil, err
+	}
+	defer links.Close()
+
+	for links.Next() {
+		var calendarID, habitID int
+		if err := links.Scan(&calendarID, &habitID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[calendarID]; ok {
+			calendars[i].HabitIDs = append(calendars[i].HabitIDs, habitID)
+		}
+	}
+
+	return calendars, links.Err()
+}
+
+// GetHolidayCalendar retrieves a holiday calendar with its holidays and the
+// habits it is attached to
+func GetHolidayCalendar(db *sql.DB, id int) (*HolidayCalendar, error) {
+	calendar := HolidayCalendar{Holidays: []Holiday{}, HabitIDs: []int{}}
+	err := db.QueryRow("SELECT id, name, created_at FROM holiday_calendars WHERE id = ?", id).
+		Scan(&calendar.ID, &calendar.Name, &calendar.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT date, name FROM holidays WHERE calendar_id = ? ORDER BY date", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var holiday Holiday
+		var date time.Time
+		if err := rows.Scan(&date, &holiday.Name); err != nil {
+			return nil, err
+		}
+		holiday.Date = date.Format("2006-01-02")
+		calendar.Holidays = append(calendar.Holidays, holiday)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	calendar.HabitIDs, err = calendarHabitIDs(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &calendar, nil
+}
+
+// DeleteHolidayCalendar deletes a holiday calendar and recomputes the
+// streaks of the habits it was attached to
+func DeleteHolidayCalendar(db *sql.DB, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	habitIDs, err := calendarHabitIDs(tx, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM holiday_calendars WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, habitID := range habitIDs {
+		if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetHabitHolidayCalendars returns the IDs of the calendars attached to a habit
+func GetHabitHolidayCalendars(db *sql.DB, habitID int) ([]int, error) {
+	rows, err := db.Query("SELECT calendar_id FROM habit_holiday_calendars WHERE habit_id = ? ORDER BY calendar_id", habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetHabitHolidayCalendars replaces the calendars attached to a habit and
+// recomputes its streak with the new skip days
+func SetHabitHolidayCalendars(db *sql.DB, habitID int, calendarIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM habit_holiday_calendars WHERE habit_id = ?", habitID); err != nil {
+		return err
+	}
+
+	for _, calendarID := range calendarIDs {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM holiday_calendars WHERE id = ?", calendarID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrUnknownHolidayCalendar
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO habit_holiday_calendars (habit_id, calendar_id) VALUES (?, ?)", habitID, calendarID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTagHolidayCalendars returns the IDs of the calendars attached to a tag
+// of a team's habits, or of the personal habits when teamID is 0
+func GetTagHolidayCalendars(db *sql.DB, teamID int, tag string) ([]int, error) {
+	rows, err := db.Query("SELECT calendar_id FROM tag_holiday_calendars WHERE COALESCE(team_id, 0) = ? AND tag = ? ORDER BY calendar_id", teamID, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetTagHolidayCalendars replaces the calendars attached to a tag of a
+// team's habits (or of the personal habits when teamID is 0) and recomputes
+// the streaks of the habits with the tag
+func SetTagHolidayCalendars(db *sql.DB, teamID int, tag string, calendarIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tag_holiday_calendars WHERE COALESCE(team_id, 0) = ? AND tag = ?", teamID, tag); err != nil {
+		return err
+	}
+
+	for _, calendarID := range calendarIDs {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM holiday_calendars WHERE id = ?", calendarID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrUnknownHolidayCalendar
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO tag_holiday_calendars (team_id, tag, calendar_id) VALUES (?, ?, ?)", nullableID(teamID), tag, calendarID)
+		if err != nil {
+			return err
+		}
+	}
+
+	tagged, err := loadTags(tx, "COALESCE(h.team_id, 0) = ? AND t.tag = ?", teamID, tag)
+	if err != nil {
+		return err
+	}
+	for habitID := range tagged {
+		if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// calendarHabitIDs returns the habits a holiday calendar applies to
+func calendarHabitIDs(db querier, calendarID int) ([]int, error) {
+	rows, err := db.Query("SELECT habit_id FROM "+HabitCalendarLinks+" hc WHERE calendar_id = ? ORDER BY habit_id", calendarID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// habitSkipDays returns every holiday of the calendars a habit skips
+func habitSkipDays(db querier, d database.Dialect, habitID int) (map[time.Time]bool, error) {
+	rows, err := db.Query(d.Rebind(`
+		SELECT DISTINCT hd.date
+		FROM `+HabitCalendarLinks+` hc
+		JOIN holidays hd ON hd.calendar_id = hc.calendar_id
+		WHERE hc.habit_id = ?
+	`), habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skip := make(map[time.Time]bool)
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		skip[truncateDay(day)] = true
+	}
+
+	return skip, rows.Err()
+}
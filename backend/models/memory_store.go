@@ -0,0 +1,295 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory HabitStore with the same behaviour as the
+// SQLite store, for tests and ephemeral servers. Days are compared in UTC,
+// like SQLite's DATE().
+type MemoryStore struct {
+	mu          sync.Mutex
+	habits      map[int]Habit
+	completions map[int][]HabitCompletion
+	streaks     map[int]HabitStreak
+	members     map[int]TeamMember
+	nextID      int
+	now         func() time.Time
+}
+
+// NewMemoryStore returns an empty in-memory HabitStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		habits:      make(map[int]Habit),
+		completions: make(map[int][]HabitCompletion),
+		streaks:     make(map[int]HabitStreak),
+		members:     make(map[int]TeamMember),
+		now:         time.Now,
+	}
+}
+
+func dayOf(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func (s *MemoryStore) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *MemoryStore) CreateHabit(habit *Habit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	habit.ID = s.newID()
+	habit.CreatedAt = now
+	habit.UpdatedAt = now
+
+	stored := *habit
+	stored.CurrentStreak, stored.LongestStreak = 0, 0
+	s.habits[habit.ID] = stored
+	s.streaks[habit.ID] = HabitStreak{ID: s.newID(), HabitID: habit.ID}
+
+	return nil
+}
+
+func (s *MemoryStore) GetHabits() ([]Habit, error) {
+	return s.listHabits(func(h Habit) bool { return h.TeamID == 0 }), nil
+}
+
+func (s *MemoryStore) GetTeamHabits(teamID int) ([]Habit, error) {
+	return s.listHabits(func(h Habit) bool { return h.TeamID == teamID }), nil
+}
+
+func (s *MemoryStore) listHabits(keep func(Habit) bool) []Habit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var habits []Habit
+	for id, habit := range s.habits {
+		if keep(habit) {
+			habits = append(habits, s.withComputed(id))
+		}
+	}
+
+	// Newest first, like the SQLite store
+	sort.Slice(habits, func(i, j int) bool {
+		if !habits[i].CreatedAt.Equal(habits[j].CreatedAt) {
+			return habits[i].CreatedAt.After(habits[j].CreatedAt)
+		}
+		return habits[i].ID > habits[j].ID
+	})
+
+	return habits
+}
+
+// withComputed returns a copy of a habit with its computed fields filled in.
+// The caller must hold s.mu.
+func (s *MemoryStore) withComputed(id int) Habit {
+	habit := s.habits[id]
+	streak := s.streaks[id]
+	habit.CurrentStreak = streak.CurrentStreak
+	habit.LongestStreak = streak.LongestStreak
+
+	now := s.now()
+	since := progressSince(now)
+	today := truncateDay(now.UTC())
+	weeks := make(map[time.Time]weekProgress)
+	for _, c := range s.completions[id] {
+		day := truncateDay(c.CompletedAt.UTC())
+		if day.Before(since) {
+			continue
+		}
+		start := PeriodStart("weekly", day)
+		week := weeks[start]
+		week.Completions++
+		week.Today = week.Today || day.Equal(today)
+		weeks[start] = week
+	}
+	applyProgress(&habit, weeks, nil, now) // Holidays are not supported in memory
+	return habit
+}
+
+func (s *MemoryStore) GetHabit(id int) (*Habit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.habits[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	habit := s.withComputed(id)
+	return &habit, nil
+}
+
+func (s *MemoryStore) UpdateHabit(habit *Habit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.habits[habit.ID]
+	if !ok {
+		return nil // Matches an UPDATE that affects no rows
+	}
+
+	stored.Name = habit.Name
+	stored.Description = habit.Description
+	stored.Frequency = habit.Frequency
+	stored.TargetCount = habit.TargetCount
+	stored.UpdatedAt = s.now()
+	s.habits[habit.ID] = stored
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteHabit(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.habits, id)
+	delete(s.completions, id)
+	delete(s.streaks, id)
+
+	return nil
+}
+
+// completedToday reports whether a habit has a completion today. The caller must hold s.mu.
+func (s *MemoryStore) completedToday(habitID int) bool {
+	today := dayOf(s.now())
+	for _, c := range s.completions[habitID] {
+		if dayOf(c.CompletedAt) == today {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) IsHabitCompletedToday(habitID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.completedToday(habitID), nil
+}
+
+func (s *MemoryStore) CompleteHabit(habitID, memberID int, details CompletionDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.completedToday(habitID) {
+		return nil // Already completed today
+	}
+
+	now := s.now()
+	s.completions[habitID] = append(s.completions[habitID], HabitCompletion{
+		ID:          s.newID(),
+		HabitID:     habitID,
+		MemberID:    memberID,
+		CompletedAt: now,
+		Value:       details.Value,
+		Note:        details.Note,
+	})
+
+	s.recalculateStreak(habitID)
+	return nil
+}
+
+func (s *MemoryStore) UncompleteHabit(habitID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.completedToday(habitID) {
+		return nil // Not completed today
+	}
+
+	today := dayOf(s.now())
+	var kept []HabitCompletion
+	for _, c := range s.completions[habitID] {
+		if dayOf(c.CompletedAt) != today {
+			kept = append(kept, c)
+		}
+	}
+	s.completions[habitID] = kept
+
+	s.recalculateStreak(habitID)
+	return nil
+}
+
+// recalculateStreak rebuilds a habit's streak record from its completions,
+// like the SQL stores. The caller must hold s.mu.
+func (s *MemoryStore) recalculateStreak(habitID int) {
+	streak, ok := s.streaks[habitID]
+	if !ok {
+		return // No streak record to update, as with the SQL UPDATE
+	}
+
+	var days []time.Time
+	seen := make(map[string]bool)
+	for _, c := range s.completions[habitID] {
+		day := dayOf(c.CompletedAt)
+		if seen[day] {
+			continue
+		}
+		seen[day] = true
+		t, _ := time.Parse("2006-01-02", day)
+		days = append(days, t)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	streak.CurrentStreak, streak.LongestStreak = streaksFromDays(days, s.now())
+	streak.LastCompletionDate = time.Time{}
+	if len(days) > 0 {
+		streak.LastCompletionDate = days[len(days)-1]
+	}
+	s.streaks[habitID] = streak
+}
+
+func (s *MemoryStore) GetCompletions(habitID int) ([]HabitCompletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	completions := append([]HabitCompletion{}, s.completions[habitID]...)
+	sort.SliceStable(completions, func(i, j int) bool {
+		return completions[i].CompletedAt.Before(completions[j].CompletedAt)
+	})
+
+	return completions, nil
+}
+
+func (s *MemoryStore) GetStreak(habitID int) (*HabitStreak, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streak, ok := s.streaks[habitID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &streak, nil
+}
+
+// AddTeamMember registers a team member so team habits can be acted on
+func (s *MemoryStore) AddTeamMember(member *TeamMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if member.Role == "" {
+		member.Role = RoleMember
+	}
+	member.ID = s.newID()
+	member.CreatedAt = s.now()
+	s.members[member.ID] = *member
+}
+
+func (s *MemoryStore) GetTeamMember(teamID, memberID int) (*TeamMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, ok := s.members[memberID]
+	if !ok || member.TeamID != teamID {
+		return nil, ErrNotFound
+	}
+
+	return &member, nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"habits/database"
+)
+
+// GetPersonalHabits retrieves the habits that belong to no team, with their
+// streaks and progress
+func GetPersonalHabits(db *sql.DB) ([]Habit, error) {
+	return GetHabits(db)
+}
+
+// GetCompletedOn returns the personal habits completed on a day (UTC)
+func GetCompletedOn(db *sql.DB, day time.Time) (map[int]bool, error) {
+	day = truncateDay(day)
+	rows, err := db.Query(`
+		SELECT DISTINCT c.habit_id
+		FROM habit_completions c
+		JOIN habits h ON h.id = c.habit_id
+		WHERE h.team_id IS NULL AND c.completed_at >= ? AND c.completed_at < ?
+	`, day.Format("2006-01-02"), day.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := make(map[int]bool)
+	for rows.Next() {
+		var habitID int
+		if err := rows.Scan(&habitID); err != nil {
+			return nil, err
+		}
+		completed[habitID] = true
+	}
+
+	return completed, rows.Err()
+}
+
+// SetCompletedOn completes a habit on a day (UTC) by a team member (0 for
+// none), or removes its completions that day, and recomputes its streak.
+// Past days are completed at noon. It reports whether anything changed.
+func SetCompletedOn(db *sql.DB, habitID, memberID int, day time.Time, done bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	day = truncateDay(day)
+	var result sql.Result
+	if done {
+		at := day.Add(12 * time.Hour)
+		if day.Equal(truncateDay(time.Now().UTC())) {
+			at = time.Now().UTC()
+		}
+		result, err = tx.Exec("INSERT OR IGNORE INTO habit_completions (habit_id, member_id, completed_at) VALUES (?, ?, ?)",
+			habitID, nullableID(memberID), at)
+	} else {
+		result, err = tx.Exec("DELETE FROM habit_completions WHERE habit_id = ? AND completed_at >= ? AND completed_at < ?",
+			habitID, day.Format("2006-01-02"), day.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if changed == 0 {
+		return false, nil // Already completed, or not completed, that day
+	}
+
+	if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+		return false, err
+	}
+
+	if done {
+		completionID, err := result.LastInsertId()
+		if err != nil {
+			return false, err
+		}
+		if err := recordCompletionActivity(tx, habitID, int(completionID), memberID); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetNoteSyncState returns whether each habit was checked on a day as of
+// the last daily-notes sync. Habits not yet synced that day are missing.
+func GetNoteSyncState(db *sql.DB, day time.Time) (map[int]bool, error) {
+	rows, err := db.Query("SELECT habit_id, checked FROM note_sync_state WHERE day = ?", truncateDay(day).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	state := make(map[int]bool)
+	for rows.Next() {
+		var habitID int
+		var checked bool
+		if err := rows.Scan(&habitID, &checked); err != nil {
+			return nil, err
+		}
+		state[habitID] = checked
+	}
+
+	return state, rows.Err()
+}
+
+// SaveNoteSyncState records whether each habit is checked on a day after a
+// daily-notes sync
+func SaveNoteSyncState(db *sql.DB, day time.Time, checked map[int]bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	date := truncateDay(day).Format("2006-01-02")
+	for habitID, done := range checked {
+		_, err := tx.Exec("INSERT OR REPLACE INTO note_sync_state (habit_id, day, checked, synced_at) VALUES (?, ?, ?, ?)",
+			habitID, date, done, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"habits/database"
+)
+
+// PostgresStore is a HabitStore backed by a PostgreSQL database. Days are
+// compared in UTC, like SQLite's DATE().
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore returns a HabitStore using db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// UTC calendar dates, matching the unique daily completion index
+const (
+	pgToday         = "(CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date"
+	pgCompletionDay = "(completed_at AT TIME ZONE 'UTC')::date"
+)
+
+// pgHabitSelect is habitSelect tolerating a NULL description
+const pgHabitSelect = `
+	SELECT h.id, h.name, COALESCE(h.description, ''), h.frequency, h.target_count, h.team_id, h.created_at, h.updated_at,
+	       COALESCE(hs.current_streak, 0) as current_streak,
+	       COALESCE(hs.longest_streak, 0) as longest_streak
+	FROM habits h
+	LEFT JOIN habit_streaks hs ON h.id = hs.habit_id
+`
+
+func (s *PostgresStore) CreateHabit(habit *Habit) error {
+	now := time.Now()
+	err := s.db.QueryRow(`
+		INSERT INTO habits (name, description, frequency, target_count, team_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, nullableID(habit.TeamID), now, now).Scan(&habit.ID)
+	if err != nil {
+		return err
+	}
+
+	habit.CreatedAt = now
+	habit.UpdatedAt = now
+
+	// Initialize streak record
+	_, err = s.db.Exec("INSERT INTO habit_streaks (habit_id, current_streak, longest_streak) VALUES ($1, 0, 0)", habit.ID)
+	return err
+}
+
+func (s *PostgresStore) GetHabits() ([]Habit, error) {
+	return s.queryHabits("h.team_id IS NULL")
+}
+
+func (s *PostgresStore) GetTeamHabits(teamID int) ([]Habit, error) {
+	return s.queryHabits("h.team_id = ?", teamID)
+}
+
+// queryHabits reads the habits matching where (a condition on habits h, with
+// ? placeholders) and their progress in three queries: the habits, their
+// holidays and their completions over the progress window
+func (s *PostgresStore) queryHabits(where string, args ...interface{}) ([]Habit, error) {
+	rows, err := s.db.Query(database.Postgres.Rebind(pgHabitSelect+" WHERE "+where+" ORDER BY h.created_at DESC"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var habits []Habit
+	for rows.Next() {
+		var habit Habit
+		if err := scanHabit(rows, &habit); err != nil {
+			return nil, err
+		}
+		habits = append(habits, habit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(habits) == 0 {
+		return habits, nil
+	}
+
+	now := time.Now()
+	dateArg := func(day time.Time) interface{} {
+		return day
+	}
+	skipQuery, skipArgs := skipDaysQuery(where, args, now, dateArg)
+	skip, err := loadSkipDays(s.db, database.Postgres.Rebind(skipQuery), skipArgs...)
+	if err != nil {
+		return nil, err
+	}
+	query, args := progressQuery(where, args, now, dateArg)
+	if err := loadProgress(s.db, habits, now, skip, database.Postgres.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return habits, nil
+}
+
+func (s *PostgresStore) GetHabit(id int) (*Habit, error) {
+	habits, err := s.queryHabits("h.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(habits) == 0 {
+		return nil, ErrNotFound
+	}
+	return &habits[0], nil
+}
+
+func (s *PostgresStore) UpdateHabit(habit *Habit) error {
+	_, err := s.db.Exec(`
+		UPDATE habits
+		SET name = $1, description = $2, frequency = $3, target_count = $4, updated_at = $5
+		WHERE id = $6
+	`, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, time.Now(), habit.ID)
+	return err
+}
+
+func (s *PostgresStore) DeleteHabit(id int) error {
+	_, err := s.db.Exec("DELETE FROM habits WHERE id = $1", id)
+	return err
+}
+
+func (s *PostgresStore) IsHabitCompletedToday(habitID int) (bool, error) {
+	var completed bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM habit_completions
+			WHERE habit_id = $1 AND `+pgCompletionDay+` = `+pgToday+`
+		)
+	`, habitID).Scan(&completed)
+	return completed, err
+}
+
+func (s *PostgresStore) CompleteHabit(habitID, memberID int, details CompletionDetails) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The unique daily completion index turns a second completion into a no-op
+	result, err := tx.Exec(`
+		INSERT INTO habit_completions (habit_id, member_id, completed_at, value, note)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`, habitID, nullableID(memberID), time.Now(), details.Value, details.Note)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return nil // Already completed today
+	}
+
+	// Rebuild the streak, which may have broken since the last completion
+	if err := recalculateStreak(tx, database.Postgres, habitID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) UncompleteHabit(habitID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM habit_completions WHERE habit_id = $1 AND "+pgCompletionDay+" = "+pgToday, habitID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return nil // Not completed today
+	}
+
+	// Rebuild the streak from the remaining completions
+	if err := recalculateStreak(tx, database.Postgres, habitID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetCompletions(habitID int) ([]HabitCompletion, error) {
+	rows, err := s.db.Query(`
+		SELECT id, habit_id, COALESCE(member_id, 0), completed_at, value, note
+		FROM habit_completions
+		WHERE habit_id = $1
+		ORDER BY completed_at
+	`, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completions := []HabitCompletion{}
+	for rows.Next() {
+		var c HabitCompletion
+		if err := rows.Scan(&c.ID, &c.HabitID, &c.MemberID, &c.CompletedAt, &c.Value, &c.Note); err != nil {
+			return nil, err
+		}
+		completions = append(completions, c)
+	}
+
+	return completions, rows.Err()
+}
+
+func (s *PostgresStore) GetStreak(habitID int) (*HabitStreak, error) {
+	var streak HabitStreak
+	var lastCompletion sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, habit_id, current_streak, longest_streak, last_completion_date
+		FROM habit_streaks
+		WHERE habit_id = $1
+	`, habitID).Scan(&streak.ID, &streak.HabitID, &streak.CurrentStreak, &streak.LongestStreak, &lastCompletion)
+	if err != nil {
+		return nil, err
+	}
+
+	streak.LastCompletionDate = lastCompletion.Time
+	return &streak, nil
+}
+
+func (s *PostgresStore) GetTeamMember(teamID, memberID int) (*TeamMember, error) {
+	var m TeamMember
+	err := s.db.QueryRow(`
+		SELECT id, team_id, name, role, created_at
+		FROM team_members
+		WHERE id = $1 AND team_id = $2
+	`, memberID, teamID).Scan(&m.ID, &m.TeamID, &m.Name, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// progressWeeks is how many full weeks before the current one
+// CompletionRate looks back
+const progressWeeks = 4
+
+// weekProgress is a habit's completions in one Monday-based week
+type weekProgress struct {
+	Completions int
+	Today       bool // one of the completions was today
+}
+
+// progressSince returns the earliest day that affects habit progress at now
+func progressSince(now time.Time) time.Time {
+	return PeriodStart("weekly", truncateDay(now.UTC())).AddDate(0, 0, -7*progressWeeks)
+}
+
+// PeriodTarget is the number of completions a habit needs in one period
+func PeriodTarget(habit *Habit) int {
+	if habit.Frequency == "multiple_times_week" && habit.TargetCount > 1 {
+		return habit.TargetCount
+	}
+	return 1
+}
+
+// WeekTarget is a habit's target in the week starting at week, lowered by one
+// for each of its skip days that week
+func WeekTarget(target int, week time.Time, skip map[time.Time]bool) int {
+	for day := week; day.Before(week.AddDate(0, 0, 7)); day = day.AddDate(0, 0, 1) {
+		if skip[day] {
+			target--
+		}
+	}
+	if target < 0 {
+		return 0
+	}
+	return target
+}
+
+// applyProgress fills in the computed fields of a habit from its weekly
+// completions since progressSince(now) and its skip days:
+//   - IsCompletedToday and IsSkipDay
+//   - PeriodCompletions and PeriodTarget for the current day or week
+//   - CompletionRate, the share of periods meeting the target over the
+//     window, not counting periods before the habit was created or the
+//     current period until its target is met. Skip days are not counted
+//     for daily habits and lower the target of their week otherwise; a
+//     week whose target drops to zero is not counted.
+func applyProgress(habit *Habit, weeks map[time.Time]weekProgress, skip map[time.Time]bool, now time.Time) {
+	today := truncateDay(now.UTC())
+	thisWeek := PeriodStart("weekly", today)
+	target := PeriodTarget(habit)
+
+	habit.IsCompletedToday = weeks[thisWeek].Today
+	habit.IsSkipDay = skip[today]
+	habit.PeriodTarget = target
+
+	first := progressSince(now)
+	created := truncateDay(habit.CreatedAt.UTC())
+
+	if habit.Frequency == "daily" {
+		habit.PeriodCompletions = 0
+		if habit.IsCompletedToday {
+			habit.PeriodCompletions = 1
+		}
+
+		// At most one completion per day, so days completed is the sum
+		if first.Before(created) {
+			first = created
+		}
+		completed := 0
+		for week, progress := range weeks {
+			if !week.Before(PeriodStart("weekly", first)) {
+				completed += progress.Completions
+			}
+		}
+		days := int(today.Sub(first).Hours()/24) + 1
+		if !habit.IsCompletedToday {
+			days-- // Today is still in progress
+		}
+		for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+			if skip[day] {
+				days--
+			}
+		}
+		if completed > days {
+			completed = days
+		}
+
+		habit.CompletionRate = 0
+		if days > 0 {
+			habit.CompletionRate = float64(completed) / float64(days) * 100
+		}
+		return
+	}
+
+	habit.PeriodCompletions = weeks[thisWeek].Completions
+	habit.PeriodTarget = WeekTarget(target, thisWeek, skip)
+	if createdWeek := PeriodStart("weekly", created); first.Before(createdWeek) {
+		first = createdWeek
+	}
+
+	var total float64
+	periods := 0
+	for week := first; !week.After(thisWeek); week = week.AddDate(0, 0, 7) {
+		target := WeekTarget(target, week, skip)
+		if target == 0 {
+			continue // Every required day was skipped
+		}
+		done := weeks[week].Completions
+		if done > target {
+			done = target
+		}
+		if week.Equal(thisWeek) && done < target {
+			continue // Still in progress
+		}
+		total += float64(done) / float64(target)
+		periods++
+	}
+
+	habit.CompletionRate = 0
+	if periods > 0 {
+		habit.CompletionRate = total / float64(periods) * 100
+	}
+}
+
+// progressQuery builds the query for loadProgress: for each habit matching
+// where (a condition on habits h), its completions in each week of the window
+// and today. Counting with conditional sums keeps it to one row per habit.
+// dateArg converts a UTC midnight into the driver's argument for comparing
+// with completed_at.
+func progressQuery(where string, whereArgs []interface{}, now time.Time, dateArg func(time.Time) interface{}) (string, []interface{}) {
+	today := truncateDay(now.UTC())
+	since := progressSince(now)
+
+	var args []interface{}
+	columns := ""
+	count := func(from, to time.Time) {
+		columns += ", SUM(CASE WHEN c.completed_at >= ? AND c.completed_at < ? THEN 1 ELSE 0 END)"
+		args = append(args, dateArg(from), dateArg(to))
+	}
+	for week := since; !week.After(today); week = week.AddDate(0, 0, 7) {
+		count(week, week.AddDate(0, 0, 7))
+	}
+	count(today, today.AddDate(0, 0, 1))
+
+	query := `
+		SELECT c.habit_id` + columns + `
+		FROM habit_completions c
+		WHERE c.habit_id IN (SELECT h.id FROM habits h WHERE ` + where + `) AND c.completed_at >= ?
+		GROUP BY c.habit_id
+	`
+	args = append(args, whereArgs...)
+	args = append(args, dateArg(since))
+
+	return query, args
+}
+
+// skipDaysQuery builds the query for loadSkipDays: the holidays of the
+// habits matching where that fall in the progress window at now. dateArg is
+// as for progressQuery.
+func skipDaysQuery(where string, whereArgs []interface{}, now time.Time, dateArg func(time.Time) interface{}) (string, []interface{}) {
+	query := `
+		SELECT DISTINCT hc.habit_id, hd.date
+		FROM ` + HabitCalendarLinks + ` hc
+		JOIN holidays hd ON hd.calendar_id = hc.calendar_id
+		WHERE hc.habit_id IN (SELECT h.id FROM habits h WHERE ` + where + `) AND hd.date >= ? AND hd.date < ?
+	`
+	today := truncateDay(now.UTC())
+	args := append(append([]interface{}{}, whereArgs...), dateArg(progressSince(now)), dateArg(PeriodStart("weekly", today).AddDate(0, 0, 7)))
+
+	return query, args
+}
+
+// loadSkipDays reads the rows of a query built by skipDaysQuery into skip
+// days per habit
+func loadSkipDays(db *sql.DB, query string, args ...interface{}) (map[int]map[time.Time]bool, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skip := make(map[int]map[time.Time]bool)
+	for rows.Next() {
+		var habitID int
+		var day time.Time
+		if err := rows.Scan(&habitID, &day); err != nil {
+			return nil, err
+		}
+		if skip[habitID] == nil {
+			skip[habitID] = make(map[time.Time]bool)
+		}
+		skip[habitID][truncateDay(day)] = true
+	}
+
+	return skip, rows.Err()
+}
+
+// loadProgress applies progress to habits from the rows of a query built by
+// progressQuery at now and their skip days, so a listing costs one query
+// rather than one per habit
+func loadProgress(db *sql.DB, habits []Habit, now time.Time, skip map[int]map[time.Time]bool, query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	since := progressSince(now)
+	weeks := make(map[int]map[time.Time]weekProgress)
+	for rows.Next() {
+		var habitID, today int
+		counts := make([]int, progressWeeks+1)
+		dest := []interface{}{&habitID}
+		for i := range counts {
+			dest = append(dest, &counts[i])
+		}
+		dest = append(dest, &today)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		habitWeeks := make(map[time.Time]weekProgress)
+		for i, completions := range counts {
+			habitWeeks[since.AddDate(0, 0, 7*i)] = weekProgress{Completions: completions}
+		}
+		thisWeek := PeriodStart("weekly", truncateDay(now.UTC()))
+		current := habitWeeks[thisWeek]
+		current.Today = today > 0
+		habitWeeks[thisWeek] = current
+		weeks[habitID] = habitWeeks
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range habits {
+		applyProgress(&habits[i], weeks[habits[i].ID], skip[habits[i].ID], now)
+	}
+
+	return nil
+}
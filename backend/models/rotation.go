@@ -0,0 +1,661 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Rotation strategies for assigning a team habit to members
+const (
+	RotationRoundRobin  = "round_robin"
+	RotationLeastRecent = "least_recent"
+)
+
+// ValidRotationStrategy reports whether strategy is a known rotation strategy
+func ValidRotationStrategy(strategy string) bool {
+	return strategy == RotationRoundRobin || strategy == RotationLeastRecent
+}
+
+// Rotation describes how responsibility for a team habit rotates between members
+type Rotation struct {
+	HabitID   int       `json:"habit_id"`
+	Strategy  string    `json:"strategy"`   // round_robin, least_recent
+	MemberIDs []int     `json:"member_ids"` // rotation order
+	StartDate time.Time `json:"start_date"`
+}
+
+// ChoreAssignment records which member is responsible for a habit in a period
+type ChoreAssignment struct {
+	HabitID     int       `json:"habit_id"`
+	PeriodStart time.Time `json:"period_start"`
+	MemberID    int       `json:"member_id"`
+}
+
+// AgendaItem is a team habit due in a period with its assigned member
+type AgendaItem struct {
+	Habit
+	PeriodStart    time.Time `json:"period_start"`
+	AssignedTo     int       `json:"assigned_to,omitempty"`
+	AssignedToName string    `json:"assigned_to_name,omitempty"`
+	CompletedBy    []int     `json:"completed_by"`
+}
+
+// MemberFairness summarises chore assignments and completions for a member
+type MemberFairness struct {
+	MemberID               int     `json:"member_id"`
+	Name                   string  `json:"name"`
+	Assigned               int     `json:"assigned"`
+	CompletedAssigned      int     `json:"completed_assigned"`
+	CompletedTotal         int     `json:"completed_total"`
+	ShareOfAssignments     float64 `json:"share_of_assignments"`
+	ShareOfCompletions     float64 `json:"share_of_completions"`
+	AssignedCompletionRate float64 `json:"assigned_completion_rate"`
+}
+
+// PeriodStart returns the first day of the habit period containing t.
+// Daily habits rotate every day; all other frequencies rotate weekly on Mondays.
+func PeriodStart(frequency string, t time.Time) time.Time {
+	day := truncateDay(t)
+	if frequency == "daily" {
+		return day
+	}
+
+	offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+	return day.AddDate(0, 0, -offset)
+}
+
+// nextPeriod returns the start of the period following start
+func nextPeriod(frequency string, start time.Time) time.Time {
+	if frequency == "daily" {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// SetRotation creates or replaces the rotation for a habit. The old
+// rotation's assignments for the periods started before the current one are
+// recorded first, so the history keeps who was responsible; assignments for
+// the current and future periods are discarded so they follow the new rules.
+// The rotation is replaced in one transaction, so a failure keeps the old one.
+func SetRotation(db *sql.DB, habit *Habit, rotation *Rotation) error {
+	rotation.HabitID = habit.ID
+	rotation.StartDate = PeriodStart(habit.Frequency, time.Now())
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := getRotation(tx, habit.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if old != nil {
+		assignments, err := assignmentsBetween(tx, habit, old, old.StartDate, rotation.StartDate.AddDate(0, 0, -1))
+		if err != nil {
+			return err
+		}
+		for periodStart, memberID := range assignments {
+			if err := insertAssignment(tx, habit.ID, periodStart, memberID); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO habit_rotations (habit_id, strategy, start_date) VALUES (?, ?, ?)
+		ON CONFLICT(habit_id) DO UPDATE SET strategy = excluded.strategy, start_date = excluded.start_date
+	`, habit.ID, rotation.Strategy, rotation.StartDate.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM rotation_members WHERE habit_id = ?", habit.ID)
+	if err != nil {
+		return err
+	}
+
+	for position, memberID := range rotation.MemberIDs {
+		_, err = tx.Exec("INSERT INTO rotation_members (habit_id, member_id, position) VALUES (?, ?, ?)", habit.ID, memberID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM chore_assignments WHERE habit_id = ? AND period_start >= ?",
+		habit.ID, rotation.StartDate.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRotation retrieves the rotation for a habit
+func GetRotation(db *sql.DB, habitID int) (*Rotation, error) {
+	return getRotation(db, habitID)
+}
+
+func getRotation(db querier, habitID int) (*Rotation, error) {
+	rotation := Rotation{HabitID: habitID, MemberIDs: []int{}}
+	err := db.QueryRow("SELECT strategy, start_date FROM habit_rotations WHERE habit_id = ?", habitID).
+		Scan(&rotation.Strategy, &rotation.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT member_id FROM rotation_members WHERE habit_id = ? ORDER BY position", habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err != nil {
+			return nil, err
+		}
+		rotation.MemberIDs = append(rotation.MemberIDs, memberID)
+	}
+
+	return &rotation, rows.Err()
+}
+
+// getTeamRotations retrieves the rotations of a team's habits by habit ID
+func getTeamRotations(db querier, teamID int) (map[int]*Rotation, error) {
+	rows, err := db.Query(`
+		SELECT r.habit_id, r.strategy, r.start_date, m.member_id
+		FROM habit_rotations r
+		JOIN habits h ON h.id = r.habit_id
+		LEFT JOIN rotation_members m ON m.habit_id = r.habit_id
+		WHERE h.team_id = ?
+		ORDER BY r.habit_id, m.position
+	`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rotations := make(map[int]*Rotation)
+	for rows.Next() {
+		var rotation Rotation
+		var memberID sql.NullInt64
+		if err := rows.Scan(&rotation.HabitID, &rotation.Strategy, &rotation.StartDate, &memberID); err != nil {
+			return nil, err
+		}
+		if rotations[rotation.HabitID] == nil {
+			rotation.MemberIDs = []int{}
+			rotations[rotation.HabitID] = &rotation
+		}
+		if memberID.Valid {
+			r := rotations[rotation.HabitID]
+			r.MemberIDs = append(r.MemberIDs, int(memberID.Int64))
+		}
+	}
+
+	return rotations, rows.Err()
+}
+
+// DeleteRotation removes a habit's rotation and its assignment history
+func DeleteRotation(db *sql.DB, habitID int) error {
+	return deleteRotation(db, habitID)
+}
+
+func deleteRotation(db querier, habitID int) error {
+	for _, table := range []string{"chore_assignments", "rotation_members", "habit_rotations"} {
+		if _, err := db.Exec("DELETE FROM "+table+" WHERE habit_id = ?", habitID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAssignment returns the member responsible for a habit in the period
+// containing date: the recorded assignment, otherwise the one the rotation
+// gives. Nothing is recorded; completions and rotation changes do that.
+// It returns 0 when the habit has no rotation or no rotation members.
+func GetAssignment(db *sql.DB, habit *Habit, rotation *Rotation, date time.Time) (int, error) {
+	assignments, err := assignmentsBetween(db, habit, rotation, date, date)
+	if err != nil {
+		return 0, err
+	}
+	return assignments[PeriodStart(habit.Frequency, date)], nil
+}
+
+// recordAssignment records who is responsible for a habit in the period
+// containing day, if the habit has a rotation, so the assignment a member
+// completed stays in place when the rotation later changes
+func recordAssignment(db querier, habitID int, day time.Time) error {
+	habit := Habit{ID: habitID}
+	if err := db.QueryRow("SELECT frequency FROM habits WHERE id = ?", habitID).Scan(&habit.Frequency); err != nil {
+		return err
+	}
+
+	rotation, err := getRotation(db, habitID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	assignments, err := assignmentsBetween(db, &habit, rotation, day, day)
+	if err != nil {
+		return err
+	}
+	periodStart := PeriodStart(habit.Frequency, day)
+	if memberID, ok := assignments[periodStart]; ok {
+		return insertAssignment(db, habitID, periodStart, memberID)
+	}
+	return nil
+}
+
+// insertAssignment records an assignment unless its period already has one
+func insertAssignment(db querier, habitID int, periodStart time.Time, memberID int) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO chore_assignments (habit_id, period_start, member_id) VALUES (?, ?, ?)",
+		habitID, periodStart.Format("2006-01-02"), memberID)
+	return err
+}
+
+// assignmentsBetween returns the member responsible for a habit in each
+// period overlapping [from, to], keyed by period start: the recorded
+// assignment where there is one, otherwise the one the rotation gives.
+// Unrecorded periods before the rotation started are left out, as are all
+// unrecorded periods when it has no members. It runs a fixed number of
+// queries however long the range.
+func assignmentsBetween(db querier, habit *Habit, rotation *Rotation, from, to time.Time) (map[time.Time]int, error) {
+	assignments := make(map[time.Time]int)
+	first := PeriodStart(habit.Frequency, from)
+	start := truncateDay(rotation.StartDate)
+
+	rows, err := db.Query("SELECT period_start, member_id FROM chore_assignments WHERE habit_id = ? AND period_start >= ? AND period_start <= ?",
+		habit.ID, first.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(map[time.Time]int)
+	for rows.Next() {
+		var periodStart time.Time
+		var memberID int
+		if err := rows.Scan(&periodStart, &memberID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recorded[truncateDay(periodStart)] = memberID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// For least_recent, each member's last completion before the first
+	// period, and the completions within the range to advance it by
+	var lastDone map[int]string
+	var done []memberDay
+	if rotation.Strategy == RotationLeastRecent {
+		lastDone, err = lastDoneBefore(db, habit.ID, first)
+		if err != nil {
+			return nil, err
+		}
+		done, err = memberDays(db, habit.ID, first, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for p := first; !p.After(to); p = nextPeriod(habit.Frequency, p) {
+		day := p.Format("2006-01-02")
+		for len(done) > 0 && done[0].day < day {
+			lastDone[done[0].memberID] = done[0].day
+			done = done[1:]
+		}
+
+		if memberID, ok := recorded[p]; ok {
+			assignments[p] = memberID
+			continue
+		}
+		if p.Before(start) || len(rotation.MemberIDs) == 0 {
+			continue
+		}
+		if rotation.Strategy == RotationLeastRecent {
+			assignments[p] = leastRecentMember(rotation.MemberIDs, lastDone)
+		} else {
+			assignments[p] = roundRobinMember(habit, rotation, p)
+		}
+	}
+
+	return assignments, nil
+}
+
+// roundRobinMember returns the rotation member whose turn the period starting
+// at periodStart is, counting periods without stepping through them so long
+// ranges stay cheap
+func roundRobinMember(habit *Habit, rotation *Rotation, periodStart time.Time) int {
+	periods := int(periodStart.Sub(truncateDay(rotation.StartDate)).Hours() / 24)
+	if habit.Frequency != "daily" {
+		periods = (periods + 6) / 7
+	}
+	return rotation.MemberIDs[periods%len(rotation.MemberIDs)]
+}
+
+// leastRecentMember picks the rotation member who completed the habit least
+// recently according to lastDone, preferring rotation order on ties
+func leastRecentMember(memberIDs []int, lastDone map[int]string) int {
+	chosen := memberIDs[0]
+	for _, memberID := range memberIDs {
+		day, done := lastDone[memberID]
+		if !done {
+			return memberID
+		}
+		if day < lastDone[chosen] {
+			chosen = memberID
+		}
+	}
+	return chosen
+}
+
+// memberDay is a day a member completed a habit
+type memberDay struct {
+	memberID int
+	day      string
+}
+
+// lastDoneBefore returns the day each member last completed a habit before
+// the given day
+func lastDoneBefore(db querier, habitID int, before time.Time) (map[int]string, error) {
+	rows, err := db.Query(`
+		SELECT member_id, MAX(DATE(completed_at))
+		FROM habit_completions
+		WHERE habit_id = ? AND member_id IS NOT NULL AND completed_at < ?
+		GROUP BY member_id
+	`, habitID, before.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastDone := make(map[int]string)
+	for rows.Next() {
+		var memberID int
+		var day string
+		if err := rows.Scan(&memberID, &day); err != nil {
+			return nil, err
+		}
+		lastDone[memberID] = day
+	}
+
+	return lastDone, rows.Err()
+}
+
+// memberDays returns the days members completed a habit within [from, to],
+// oldest first
+func memberDays(db querier, habitID int, from, to time.Time) ([]memberDay, error) {
+	rows, err := db.Query(`
+		SELECT member_id, DATE(completed_at) AS day
+		FROM habit_completions
+		WHERE habit_id = ? AND member_id IS NOT NULL AND completed_at >= ? AND completed_at < ?
+		ORDER BY day
+	`, habitID, from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []memberDay
+	for rows.Next() {
+		var d memberDay
+		if err := rows.Scan(&d.memberID, &d.day); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+
+	return days, rows.Err()
+}
+
+// GetTeamAgenda lists a team's habits for the period containing date along
+// with the assigned member and who has completed them so far. It runs the
+// same few queries however many habits the team has; nothing is recorded.
+func GetTeamAgenda(db *sql.DB, teamID int, date time.Time) ([]AgendaItem, error) {
+	habits, err := GetTeamHabits(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := GetTeamMembers(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string)
+	for _, m := range members {
+		names[m.ID] = m.Name
+	}
+
+	rotations, err := getTeamRotations(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Daily habits cover the day, all others the week; each query picks the
+	// bounds matching the habit's frequency
+	day := truncateDay(date)
+	week := PeriodStart("weekly", date)
+	bounds := []interface{}{
+		day.Format("2006-01-02"), week.Format("2006-01-02"),
+		nextPeriod("daily", day).Format("2006-01-02"), nextPeriod("weekly", week).Format("2006-01-02"),
+	}
+	const periodStart = "CASE WHEN h.frequency = 'daily' THEN ? ELSE ? END"
+
+	recorded := make(map[int]int)
+	rows, err := db.Query(`
+		SELECT a.habit_id, a.member_id
+		FROM chore_assignments a
+		JOIN habits h ON h.id = a.habit_id
+		WHERE h.team_id = ? AND a.period_start = `+periodStart, teamID, bounds[0], bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var habitID, memberID int
+		if err := rows.Scan(&habitID, &memberID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recorded[habitID] = memberID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	completedBy := make(map[int][]int)
+	rows, err = db.Query(`
+		SELECT DISTINCT c.habit_id, c.member_id
+		FROM habit_completions c
+		JOIN habits h ON h.id = c.habit_id
+		WHERE h.team_id = ? AND c.member_id IS NOT NULL
+			AND c.completed_at >= `+periodStart+` AND c.completed_at < `+periodStart+`
+		ORDER BY c.habit_id, c.member_id
+	`, append([]interface{}{teamID}, bounds...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var habitID, memberID int
+		if err := rows.Scan(&habitID, &memberID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		completedBy[habitID] = append(completedBy[habitID], memberID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Each member's last completion before the period, for least_recent
+	lastDone := make(map[int]map[int]string)
+	rows, err = db.Query(`
+		SELECT c.habit_id, c.member_id, MAX(DATE(c.completed_at))
+		FROM habit_completions c
+		JOIN habits h ON h.id = c.habit_id
+		JOIN habit_rotations r ON r.habit_id = h.id
+		WHERE h.team_id = ? AND r.strategy = ? AND c.member_id IS NOT NULL AND c.completed_at < `+periodStart+`
+		GROUP BY c.habit_id, c.member_id
+	`, teamID, RotationLeastRecent, bounds[0], bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var habitID, memberID int
+		var day string
+		if err := rows.Scan(&habitID, &memberID, &day); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if lastDone[habitID] == nil {
+			lastDone[habitID] = make(map[int]string)
+		}
+		lastDone[habitID][memberID] = day
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	agenda := []AgendaItem{}
+	for i := range habits {
+		habit := &habits[i]
+		item := AgendaItem{
+			Habit:       *habit,
+			PeriodStart: PeriodStart(habit.Frequency, date),
+			CompletedBy: []int{},
+		}
+		if ids := completedBy[habit.ID]; ids != nil {
+			item.CompletedBy = ids
+		}
+
+		rotation := rotations[habit.ID]
+		if memberID, ok := recorded[habit.ID]; ok {
+			item.AssignedTo = memberID
+		} else if rotation != nil && len(rotation.MemberIDs) > 0 && !item.PeriodStart.Before(truncateDay(rotation.StartDate)) {
+			if rotation.Strategy == RotationLeastRecent {
+				item.AssignedTo = leastRecentMember(rotation.MemberIDs, lastDone[habit.ID])
+			} else {
+				item.AssignedTo = roundRobinMember(habit, rotation, item.PeriodStart)
+			}
+		}
+		item.AssignedToName = names[item.AssignedTo]
+
+		agenda = append(agenda, item)
+	}
+
+	return agenda, nil
+}
+
+// GetTeamFairness counts assignments and completions per member for a team's
+// habits over the periods overlapping [from, to]. Assignments are looked up
+// with a few queries per habit however long the range, and are not recorded.
+func GetTeamFairness(db *sql.DB, teamID int, from, to time.Time) ([]MemberFairness, error) {
+	members, err := GetTeamMembers(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	habits, err := GetTeamHabits(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotations, err := getTeamRotations(db, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]*MemberFairness)
+	for _, m := range members {
+		stats[m.ID] = &MemberFairness{MemberID: m.ID, Name: m.Name}
+	}
+
+	today := truncateDay(time.Now())
+	if to.After(today) {
+		to = today
+	}
+
+	totalAssigned, totalCompleted := 0, 0
+	for i := range habits {
+		habit := &habits[i]
+
+		// Completions per period and member for this habit
+		done := make(map[time.Time]map[int]bool)
+		rows, err := db.Query(`
+			SELECT DATE(completed_at), member_id FROM habit_completions
+			WHERE habit_id = ? AND member_id IS NOT NULL AND completed_at >= ? AND completed_at < ?
+		`, habit.ID, PeriodStart(habit.Frequency, from).Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var day string
+			var memberID int
+			if err := rows.Scan(&day, &memberID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			t, err := time.Parse("2006-01-02", day)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			period := PeriodStart(habit.Frequency, t)
+			if done[period] == nil {
+				done[period] = make(map[int]bool)
+			}
+			done[period][memberID] = true
+			if s, ok := stats[memberID]; ok {
+				s.CompletedTotal++
+				totalCompleted++
+			}
+		}
+		rows.Close()
+
+		rotation := rotations[habit.ID]
+		if rotation == nil {
+			continue
+		}
+
+		assignments, err := assignmentsBetween(db, habit, rotation, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for period, memberID := range assignments {
+			s, ok := stats[memberID]
+			if !ok {
+				continue
+			}
+			s.Assigned++
+			totalAssigned++
+			if done[period][memberID] {
+				s.CompletedAssigned++
+			}
+		}
+	}
+
+	fairness := []MemberFairness{}
+	for _, m := range members {
+		s := stats[m.ID]
+		if totalAssigned > 0 {
+			s.ShareOfAssignments = float64(s.Assigned) / float64(totalAssigned) * 100
+		}
+		if totalCompleted > 0 {
+			s.ShareOfCompletions = float64(s.CompletedTotal) / float64(totalCompleted) * 100
+		}
+		if s.Assigned > 0 {
+			s.AssignedCompletionRate = float64(s.CompletedAssigned) / float64(s.Assigned) * 100
+		}
+		fairness = append(fairness, *s)
+	}
+
+	return fairness, nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rotationTeam creates a team with two members besides its owner and a daily
+// team habit
+func rotationTeam(t *testing.T, db *sql.DB) (*Habit, []int) {
+	t.Helper()
+
+	team := &Team{Name: "Household"}
+	if err := CreateTeam(db, team, &TeamMember{Name: "Owner"}); err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	var memberIDs []int
+	for _, name := range []string{"Ana", "Ben"} {
+		member := &TeamMember{TeamID: team.ID, Name: name, Role: RoleMember}
+		if err := AddTeamMember(db, member); err != nil {
+			t.Fatalf("AddTeamMember: %v", err)
+		}
+		memberIDs = append(memberIDs, member.ID)
+	}
+
+	habit := &Habit{Name: "Dishes", Frequency: "daily", TargetCount: 1, TeamID: team.ID}
+	if err := CreateHabit(db, habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+	return habit, memberIDs
+}
+
+func countAssignments(t *testing.T, db *sql.DB, habitID int) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM chore_assignments WHERE habit_id = ?", habitID).Scan(&n); err != nil {
+		t.Fatalf("count assignments: %v", err)
+	}
+	return n
+}
+
+func TestAgendaRecordsNothing(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+	habit, memberIDs := rotationTeam(t, db)
+
+	if err := SetRotation(db, habit, &Rotation{Strategy: RotationRoundRobin, MemberIDs: memberIDs}); err != nil {
+		t.Fatalf("SetRotation: %v", err)
+	}
+
+	agenda, err := GetTeamAgenda(db, habit.TeamID, time.Now())
+	if err != nil {
+		t.Fatalf("GetTeamAgenda: %v", err)
+	}
+	if len(agenda) != 1 || agenda[0].AssignedTo != memberIDs[0] {
+		t.Fatalf("agenda = %+v, want the habit assigned to member %d", agenda, memberIDs[0])
+	}
+	if n := countAssignments(t, db, habit.ID); n != 0 {
+		t.Errorf("reading the agenda recorded %d assignments, want none", n)
+	}
+
+	// Completing the chore records the period's assignment
+	if err := CompleteHabitAs(db, habit.ID, memberIDs[1]); err != nil {
+		t.Fatalf("CompleteHabitAs: %v", err)
+	}
+	if n := countAssignments(t, db, habit.ID); n != 1 {
+		t.Errorf("completing recorded %d assignments, want 1", n)
+	}
+	agenda, err = GetTeamAgenda(db, habit.TeamID, time.Now())
+	if err != nil {
+		t.Fatalf("GetTeamAgenda: %v", err)
+	}
+	if agenda[0].AssignedTo != memberIDs[0] || len(agenda[0].CompletedBy) != 1 || agenda[0].CompletedBy[0] != memberIDs[1] {
+		t.Errorf("agenda after completing = %+v, want member %d assigned and %d done", agenda[0], memberIDs[0], memberIDs[1])
+	}
+}
+
+func TestSetRotationKeepsHistory(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+	habit, memberIDs := rotationTeam(t, db)
+
+	if err := SetRotation(db, habit, &Rotation{Strategy: RotationRoundRobin, MemberIDs: memberIDs}); err != nil {
+		t.Fatalf("SetRotation: %v", err)
+	}
+	// Let the rotation have started three days ago
+	today := truncateDay(time.Now())
+	_, err := db.Exec("UPDATE habit_rotations SET start_date = ? WHERE habit_id = ?", today.AddDate(0, 0, -3).Format("2006-01-02"), habit.ID)
+	if err != nil {
+		t.Fatalf("backdate rotation: %v", err)
+	}
+
+	before, err := GetTeamFairness(db, habit.TeamID, today.AddDate(0, 0, -3), today.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("GetTeamFairness: %v", err)
+	}
+
+	if err := SetRotation(db, habit, &Rotation{Strategy: RotationRoundRobin, MemberIDs: memberIDs[1:]}); err != nil {
+		t.Fatalf("SetRotation: %v", err)
+	}
+	if n := countAssignments(t, db, habit.ID); n != 3 {
+		t.Errorf("replacing the rotation recorded %d past assignments, want 3", n)
+	}
+
+	after, err := GetTeamFairness(db, habit.TeamID, today.AddDate(0, 0, -3), today.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("GetTeamFairness: %v", err)
+	}
+	for i := range before {
+		if before[i].Assigned != after[i].Assigned {
+			t.Errorf("member %d assigned %d past periods before the change, %d after", before[i].MemberID, before[i].Assigned, after[i].Assigned)
+		}
+	}
+	// Ana, Ben, Ana over the three past days
+	if before[1].Assigned != 2 || before[2].Assigned != 1 {
+		t.Errorf("fairness = %+v, want Ana assigned twice and Ben once", before)
+	}
+}
+
+func TestLeastRecentAgenda(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+	habit, memberIDs := rotationTeam(t, db)
+
+	if err := SetRotation(db, habit, &Rotation{Strategy: RotationLeastRecent, MemberIDs: memberIDs}); err != nil {
+		t.Fatalf("SetRotation: %v", err)
+	}
+	// Ana did the chore yesterday, Ben two days ago
+	today := truncateDay(time.Now())
+	for i, memberID := range memberIDs {
+		_, err := db.Exec("INSERT INTO habit_completions (habit_id, member_id, completed_at) VALUES (?, ?, ?)",
+			habit.ID, memberID, today.AddDate(0, 0, -1-i).Add(12*time.Hour))
+		if err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+	}
+
+	agenda, err := GetTeamAgenda(db, habit.TeamID, time.Now())
+	if err != nil {
+		t.Fatalf("GetTeamAgenda: %v", err)
+	}
+	assigned, err := GetAssignment(db, habit, &Rotation{HabitID: habit.ID, Strategy: RotationLeastRecent, MemberIDs: memberIDs, StartDate: today}, time.Now())
+	if err != nil {
+		t.Fatalf("GetAssignment: %v", err)
+	}
+	if agenda[0].AssignedTo != memberIDs[1] || assigned != memberIDs[1] {
+		t.Errorf("assigned %d in the agenda and %d alone, want Ben (%d)", agenda[0].AssignedTo, assigned, memberIDs[1])
+	}
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+)
+
+// ShareLink is a revocable, unguessable public link to a habit's progress
+type ShareLink struct {
+	ID        int        `json:"id"`
+	HabitID   int        `json:"habit_id"`
+	Token     string     `json:"token"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HeatmapDay is the number of completions of a habit on a day
+type HeatmapDay struct {
+	Date  string `json:"date"` // YYYY-MM-DD
+	Count int    `json:"count"`
+}
+
+// SharedProgress is the public view of a habit served through a share link
+type SharedProgress struct {
+	Name          string       `json:"name"`
+	Description   string       `json:"description"`
+	Frequency     string       `json:"frequency"`
+	CurrentStreak int          `json:"current_streak"`
+	LongestStreak int          `json:"longest_streak"`
+	From          string       `json:"from"`
+	To            string       `json:"to"`
+	Heatmap       []HeatmapDay `json:"heatmap"`
+}
+
+// newShareToken returns a random URL-safe token with 256 bits of entropy
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateShareLink creates a new share link for a habit
+func CreateShareLink(db *sql.DB, habitID int) (*ShareLink, error) {
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &ShareLink{HabitID: habitID, Token: token, CreatedAt: time.Now()}
+	result, err := db.Exec("INSERT INTO share_links (habit_id, token, created_at) VALUES (?, ?, ?)",
+		link.HabitID, link.Token, link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	link.ID = int(id)
+	return link, nil
+}
+
+// GetShareLinks retrieves all share links of a habit, including revoked ones
+func GetShareLinks(db *sql.DB, habitID int) ([]ShareLink, error) {
+	rows, err := db.Query(`
+		SELECT id, habit_id, token, created_at, revoked_at
+		FROM share_links
+		WHERE habit_id = ?
+		ORDER BY created_at DESC
+	`, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var link ShareLink
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&link.ID, &link.HabitID, &link.Token, &link.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			link.RevokedAt = &revokedAt.Time
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// RevokeShareLink revokes a share link so it can no longer be used
+func RevokeShareLink(db *sql.DB, habitID, linkID int) error {
+	result, err := db.Exec("UPDATE share_links SET revoked_at = ? WHERE id = ? AND habit_id = ? AND revoked_at IS NULL",
+		time.Now(), linkID, habitID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetHabitByShareToken resolves an active share token to its habit
+func GetHabitByShareToken(db *sql.DB, token string) (*Habit, error) {
+	var habitID int
+	err := db.QueryRow("SELECT habit_id FROM share_links WHERE token = ? AND revoked_at IS NULL", token).Scan(&habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetHabit(db, habitID)
+}
+
+// GetSharedProgress builds the public progress view of a habit over the last year
+func GetSharedProgress(db *sql.DB, habit *Habit) (*SharedProgress, error) {
+	to := truncateDay(time.Now())
+	from := to.AddDate(-1, 0, 1)
+
+	heatmap, err := GetHabitHeatmap(db, habit.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SharedProgress{
+		Name:          habit.Name,
+		Description:   habit.Description,
+		Frequency:     habit.Frequency,
+		CurrentStreak: habit.CurrentStreak,
+		LongestStreak: habit.LongestStreak,
+		From:          from.Format("2006-01-02"),
+		To:            to.Format("2006-01-02"),
+		Heatmap:       heatmap,
+	}, nil
+}
+
+// GetHabitHeatmap returns completions per day for a habit over [from, to],
+// including days without completions
+func GetHabitHeatmap(db *sql.DB, habitID int, from, to time.Time) ([]HeatmapDay, error) {
+	rows, err := db.Query(`
+		SELECT DATE(completed_at) as day, COUNT(*)
+		FROM habit_completions
+		WHERE habit_id = ? AND completed_at >= ? AND completed_at < ?
+		GROUP BY day
+	`, habitID, from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	heatmap := []HeatmapDay{}
+	for d := truncateDay(from); !d.After(truncateDay(to)); d = d.AddDate(0, 0, 1) {
+		day := d.Format("2006-01-02")
+		heatmap = append(heatmap, HeatmapDay{Date: day, Count: counts[day]})
+	}
+
+	return heatmap, nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"habits/database"
+)
+
+// SheetCell is one habit's day on a monthly tracker sheet
+type SheetCell struct {
+	Scheduled bool // the habit existed and the day is not a holiday for it
+	Holiday   bool
+	Completed bool
+}
+
+// SheetRow is one habit's month on a tracker sheet
+type SheetRow struct {
+	Habit Habit
+	Days  []SheetCell // indexed by day of the month - 1
+}
+
+// MonthSheet is a printable monthly habit tracker
+type MonthSheet struct {
+	Month time.Time // first day of the month, UTC
+	Days  int
+	Rows  []SheetRow
+}
+
+// Day returns the date of a day of the sheet's month
+func (s *MonthSheet) Day(day int) time.Time {
+	return s.Month.AddDate(0, 0, day-1)
+}
+
+// GetMonthSheet lays out a month for habits: which days each is scheduled
+// on, which are its holidays and which it was already completed on
+func GetMonthSheet(db *sql.DB, habits []Habit, month time.Time) (*MonthSheet, error) {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	next := first.AddDate(0, 1, 0)
+	sheet := &MonthSheet{Month: first, Days: int(next.Sub(first).Hours() / 24)}
+
+	completed := make(map[int]map[int]bool) // days completed per habit
+	if len(habits) > 0 {
+		ids := make([]interface{}, 0, len(habits)+2)
+		for _, habit := range habits {
+			ids = append(ids, habit.ID)
+		}
+		rows, err := db.Query(`
+			SELECT habit_id, completed_at
+			FROM habit_completions
+			WHERE habit_id IN (?`+strings.Repeat(", ?", len(habits)-1)+`) AND completed_at >= ? AND completed_at < ?
+		`, append(ids, first.Format("2006-01-02"), next.Format("2006-01-02"))...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var habitID int
+			var at time.Time
+			if err := rows.Scan(&habitID, &at); err != nil {
+				return nil, err
+			}
+			if completed[habitID] == nil {
+				completed[habitID] = make(map[int]bool)
+			}
+			completed[habitID][at.UTC().Day()] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+	}
+
+	for _, habit := range habits {
+		skip, err := habitSkipDays(db, database.SQLite, habit.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		created := truncateDay(habit.CreatedAt.UTC())
+		row := SheetRow{Habit: habit, Days: make([]SheetCell, sheet.Days)}
+		for day := 1; day <= sheet.Days; day++ {
+			date := sheet.Day(day)
+			row.Days[day-1] = SheetCell{
+				Holiday:   skip[date],
+				Scheduled: !date.Before(created) && !skip[date],
+				Completed: completed[habit.ID][day],
+			}
+		}
+		sheet.Rows = append(sheet.Rows, row)
+	}
+
+	return sheet, nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// SQLiteStore is a HabitStore backed by the SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore returns a HabitStore using db
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) CreateHabit(habit *Habit) error {
+	return CreateHabit(s.db, habit)
+}
+
+func (s *SQLiteStore) GetHabits() ([]Habit, error) {
+	return GetHabits(s.db)
+}
+
+func (s *SQLiteStore) GetTeamHabits(teamID int) ([]Habit, error) {
+	return GetTeamHabits(s.db, teamID)
+}
+
+func (s *SQLiteStore) GetHabit(id int) (*Habit, error) {
+	return GetHabit(s.db, id)
+}
+
+func (s *SQLiteStore) UpdateHabit(habit *Habit) error {
+	return UpdateHabit(s.db, habit)
+}
+
+func (s *SQLiteStore) DeleteHabit(id int) error {
+	return DeleteHabit(s.db, id)
+}
+
+func (s *SQLiteStore) CompleteHabit(habitID, memberID int, details CompletionDetails) error {
+	return CompleteHabitWithDetails(s.db, habitID, memberID, details)
+}
+
+func (s *SQLiteStore) UncompleteHabit(habitID int) error {
+	return UncompleteHabit(s.db, habitID)
+}
+
+func (s *SQLiteStore) IsHabitCompletedToday(habitID int) (bool, error) {
+	return IsHabitCompletedToday(s.db, habitID)
+}
+
+func (s *SQLiteStore) GetCompletions(habitID int) ([]HabitCompletion, error) {
+	return GetCompletions(s.db, habitID)
+}
+
+func (s *SQLiteStore) GetStreak(habitID int) (*HabitStreak, error) {
+	return GetStreak(s.db, habitID)
+}
+
+func (s *SQLiteStore) GetTeamMember(teamID, memberID int) (*TeamMember, error) {
+	return GetTeamMember(s.db, teamID, memberID)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// ErrNotFound is returned by a HabitStore when a record does not exist. It is
+// sql.ErrNoRows so callers can treat every store like the SQLite one.
+var ErrNotFound = sql.ErrNoRows
+
+// Compile-time checks that every store implements HabitStore
+var (
+	_ HabitStore = (*SQLiteStore)(nil)
+	_ HabitStore = (*PostgresStore)(nil)
+	_ HabitStore = (*MemoryStore)(nil)
+)
+
+// HabitStore is the storage for habits, their completions and streaks
+type HabitStore interface {
+	CreateHabit(habit *Habit) error
+	GetHabits() ([]Habit, error) // personal habits; team habits are listed per team
+	GetTeamHabits(teamID int) ([]Habit, error)
+	GetHabit(id int) (*Habit, error)
+	UpdateHabit(habit *Habit) error
+	DeleteHabit(id int) error
+
+	// CompleteHabit marks a habit completed today, by a team member when
+	// memberID is non-zero, with an optional value and note. Completing
+	// twice on one day is a no-op that keeps the first completion's details.
+	CompleteHabit(habitID, memberID int, details CompletionDetails) error
+	UncompleteHabit(habitID int) error
+	IsHabitCompletedToday(habitID int) (bool, error)
+	GetCompletions(habitID int) ([]HabitCompletion, error)
+
+	GetStreak(habitID int) (*HabitStreak, error)
+
+	// GetTeamMember resolves the member acting on a team habit
+	GetTeamMember(teamID, memberID int) (*TeamMember, error)
+}
@@ -0,0 +1,362 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"habits/database"
+)
+
+// storeCase is a HabitStore under test, with a way to add a team member
+// for its team habits and one to record a habit's first completion on a
+// past day, streak included, as if it had been completed then
+type storeCase struct {
+	name        string
+	store       HabitStore
+	addMember   func(t *testing.T, teamName string) *TeamMember
+	completedOn func(t *testing.T, habitID int, day time.Time)
+}
+
+// testStores returns a fresh SQLite store and in-memory store, and a
+// Postgres store when POSTGRES_DSN points at a database the tests may
+// create schemas in
+func testStores(t *testing.T) []storeCase {
+	t.Helper()
+
+	sqliteDB := openTestDB(t, filepath.Join(t.TempDir(), "habits.db"))
+	memory := NewMemoryStore()
+	stores := []storeCase{
+		{"sqlite", NewSQLiteStore(sqliteDB), sqlMember(sqliteDB), sqlCompletedOn(sqliteDB)},
+		{"memory", memory, func(t *testing.T, teamName string) *TeamMember {
+			member := &TeamMember{TeamID: memory.newID(), Name: teamName + " owner", Role: RoleOwner}
+			memory.AddTeamMember(member)
+			return member
+		}, func(t *testing.T, habitID int, day time.Time) {
+			memory.mu.Lock()
+			defer memory.mu.Unlock()
+			memory.completions[habitID] = append(memory.completions[habitID], HabitCompletion{ID: memory.newID(), HabitID: habitID, CompletedAt: day})
+			memory.streaks[habitID] = HabitStreak{ID: memory.streaks[habitID].ID, HabitID: habitID, CurrentStreak: 1, LongestStreak: 1, LastCompletionDate: day}
+		}},
+	}
+
+	if dsn := os.Getenv("POSTGRES_DSN"); dsn != "" {
+		postgresDB := openTestDB(t, postgresTestSchema(t, dsn))
+		stores = append(stores, storeCase{"postgres", NewPostgresStore(postgresDB), sqlMember(postgresDB), sqlCompletedOn(postgresDB)})
+	}
+
+	return stores
+}
+
+// openTestDB opens and migrates a test database, closing it after the test
+func openTestDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+
+	db, err := database.Open(dsn)
+	if err != nil {
+		t.Fatalf("open %s: %v", dsn, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// postgresTestSchema creates a schema for one test, dropped afterwards, and
+// returns dsn with its search_path set to it
+func postgresTestSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	admin, err := database.Open(dsn)
+	if err != nil {
+		t.Fatalf("open POSTGRES_DSN: %v", err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("habits_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin, err := database.Open(dsn)
+		if err != nil {
+			t.Errorf("open POSTGRES_DSN: %v", err)
+			return
+		}
+		defer admin.Close()
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("POSTGRES_DSN must be a postgres:// URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// sqlMember creates a team with an owner in a SQL database
+func sqlMember(db *sql.DB) func(t *testing.T, teamName string) *TeamMember {
+	return func(t *testing.T, teamName string) *TeamMember {
+		t.Helper()
+
+		d := database.DialectOf(db)
+		now := time.Now().UTC()
+		member := &TeamMember{Name: teamName + " owner", Role: RoleOwner}
+		err := db.QueryRow(d.Rebind("INSERT INTO teams (name, created_at) VALUES (?, ?) RETURNING id"), teamName, now).Scan(&member.TeamID)
+		if err != nil {
+			t.Fatalf("create team: %v", err)
+		}
+		err = db.QueryRow(d.Rebind("INSERT INTO team_members (team_id, name, role, created_at) VALUES (?, ?, ?, ?) RETURNING id"),
+			member.TeamID, member.Name, member.Role, now).Scan(&member.ID)
+		if err != nil {
+			t.Fatalf("add team member: %v", err)
+		}
+		return member
+	}
+}
+
+// sqlCompletedOn records a completion on a past day in a SQL database, with
+// the streak it left at the time
+func sqlCompletedOn(db *sql.DB) func(t *testing.T, habitID int, day time.Time) {
+	return func(t *testing.T, habitID int, day time.Time) {
+		t.Helper()
+
+		d := database.DialectOf(db)
+		if _, err := db.Exec(d.Rebind("INSERT INTO habit_completions (habit_id, completed_at) VALUES (?, ?)"), habitID, day); err != nil {
+			t.Fatalf("insert completion: %v", err)
+		}
+		_, err := db.Exec(d.Rebind("UPDATE habit_streaks SET current_streak = 1, longest_streak = 1, last_completion_date = ? WHERE habit_id = ?"),
+			day.Format("2006-01-02"), habitID)
+		if err != nil {
+			t.Fatalf("update streak: %v", err)
+		}
+	}
+}
+
+func TestHabitStore(t *testing.T) {
+	for _, tc := range testStores(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			testHabitCRUD(t, tc)
+			testCompletions(t, tc)
+			testStreakAfterGap(t, tc)
+			testTeamHabits(t, tc)
+		})
+	}
+}
+
+func testHabitCRUD(t *testing.T, tc storeCase) {
+	store := tc.store
+
+	habit := &Habit{Name: "Read", Description: "20 pages", Frequency: "daily", TargetCount: 1}
+	if err := store.CreateHabit(habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+	if habit.ID == 0 {
+		t.Fatal("CreateHabit did not set the habit's ID")
+	}
+
+	got, err := store.GetHabit(habit.ID)
+	if err != nil {
+		t.Fatalf("GetHabit: %v", err)
+	}
+	if got.Name != "Read" || got.Description != "20 pages" || got.Frequency != "daily" || got.TargetCount != 1 {
+		t.Errorf("GetHabit = %+v, want the created habit", got)
+	}
+
+	habit.Name, habit.Frequency, habit.TargetCount = "Read more", "weekly", 3
+	if err := store.UpdateHabit(habit); err != nil {
+		t.Fatalf("UpdateHabit: %v", err)
+	}
+	got, err = store.GetHabit(habit.ID)
+	if err != nil {
+		t.Fatalf("GetHabit after update: %v", err)
+	}
+	if got.Name != "Read more" || got.Frequency != "weekly" || got.TargetCount != 3 {
+		t.Errorf("GetHabit after update = %+v, want the updated habit", got)
+	}
+
+	habits, err := store.GetHabits()
+	if err != nil {
+		t.Fatalf("GetHabits: %v", err)
+	}
+	if !containsHabit(habits, habit.ID) {
+		t.Errorf("GetHabits = %v, want habit %d", habits, habit.ID)
+	}
+
+	if err := store.DeleteHabit(habit.ID); err != nil {
+		t.Fatalf("DeleteHabit: %v", err)
+	}
+	if _, err := store.GetHabit(habit.ID); err != ErrNotFound {
+		t.Errorf("GetHabit after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testCompletions(t *testing.T, tc storeCase) {
+	store := tc.store
+
+	habit := &Habit{Name: "Walk", Frequency: "daily", TargetCount: 1}
+	if err := store.CreateHabit(habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+
+	completed, err := store.IsHabitCompletedToday(habit.ID)
+	if err != nil || completed {
+		t.Fatalf("IsHabitCompletedToday before completing = %v, %v; want false", completed, err)
+	}
+
+	// Completing twice on one day records one completion, with the first details
+	for i, minutes := range []float64{30, 45} {
+		details := CompletionDetails{Value: &minutes, Note: fmt.Sprintf("walk %d", i+1)}
+		if err := store.CompleteHabit(habit.ID, 0, details); err != nil {
+			t.Fatalf("CompleteHabit #%d: %v", i+1, err)
+		}
+	}
+	completions, err := store.GetCompletions(habit.ID)
+	if err != nil {
+		t.Fatalf("GetCompletions: %v", err)
+	}
+	if len(completions) != 1 {
+		t.Fatalf("GetCompletions = %d completions, want 1", len(completions))
+	}
+	if completions[0].HabitID != habit.ID || completions[0].MemberID != 0 {
+		t.Errorf("completion = %+v, want habit %d without a member", completions[0], habit.ID)
+	}
+	if c := completions[0]; c.Value == nil || *c.Value != 30 || c.Note != "walk 1" {
+		t.Errorf("completion = %+v, want the first value and note", c)
+	}
+
+	completed, err = store.IsHabitCompletedToday(habit.ID)
+	if err != nil || !completed {
+		t.Errorf("IsHabitCompletedToday after completing = %v, %v; want true", completed, err)
+	}
+	streak, err := store.GetStreak(habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak: %v", err)
+	}
+	if streak.CurrentStreak != 1 || streak.LongestStreak != 1 {
+		t.Errorf("streak after completing = %d (longest %d), want 1 (1)", streak.CurrentStreak, streak.LongestStreak)
+	}
+
+	if err := store.UncompleteHabit(habit.ID); err != nil {
+		t.Fatalf("UncompleteHabit: %v", err)
+	}
+	completed, err = store.IsHabitCompletedToday(habit.ID)
+	if err != nil || completed {
+		t.Errorf("IsHabitCompletedToday after uncompleting = %v, %v; want false", completed, err)
+	}
+	if completions, err := store.GetCompletions(habit.ID); err != nil || len(completions) != 0 {
+		t.Errorf("GetCompletions after uncompleting = %d completions, %v; want none", len(completions), err)
+	}
+	streak, err = store.GetStreak(habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak after uncompleting: %v", err)
+	}
+	if streak.CurrentStreak != 0 {
+		t.Errorf("streak after uncompleting = %d, want 0", streak.CurrentStreak)
+	}
+
+	// Uncompleting a habit not completed today is a no-op
+	if err := store.UncompleteHabit(habit.ID); err != nil {
+		t.Errorf("UncompleteHabit twice: %v", err)
+	}
+}
+
+func testStreakAfterGap(t *testing.T, tc storeCase) {
+	store := tc.store
+
+	habit := &Habit{Name: "Run", Frequency: "daily", TargetCount: 1}
+	if err := store.CreateHabit(habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+	tc.completedOn(t, habit.ID, truncateDay(time.Now().UTC()).AddDate(0, 0, -5).Add(8*time.Hour))
+
+	// The streak of five days ago broke, so today's completion starts a new one
+	if err := store.CompleteHabit(habit.ID, 0, CompletionDetails{}); err != nil {
+		t.Fatalf("CompleteHabit: %v", err)
+	}
+	streak, err := store.GetStreak(habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak: %v", err)
+	}
+	if streak.CurrentStreak != 1 || streak.LongestStreak != 1 {
+		t.Errorf("streak after a gap = %d (longest %d), want 1 (1)", streak.CurrentStreak, streak.LongestStreak)
+	}
+
+	if err := store.UncompleteHabit(habit.ID); err != nil {
+		t.Fatalf("UncompleteHabit: %v", err)
+	}
+	streak, err = store.GetStreak(habit.ID)
+	if err != nil {
+		t.Fatalf("GetStreak after uncompleting: %v", err)
+	}
+	if streak.CurrentStreak != 0 || streak.LongestStreak != 1 {
+		t.Errorf("streak after uncompleting = %d (longest %d), want 0 (1)", streak.CurrentStreak, streak.LongestStreak)
+	}
+}
+
+func testTeamHabits(t *testing.T, tc storeCase) {
+	store := tc.store
+	member := tc.addMember(t, "Household")
+
+	got, err := store.GetTeamMember(member.TeamID, member.ID)
+	if err != nil {
+		t.Fatalf("GetTeamMember: %v", err)
+	}
+	if got.Name != member.Name || got.Role != RoleOwner {
+		t.Errorf("GetTeamMember = %+v, want %+v", got, member)
+	}
+	if _, err := store.GetTeamMember(member.TeamID+1000, member.ID); err != ErrNotFound {
+		t.Errorf("GetTeamMember of another team: err = %v, want ErrNotFound", err)
+	}
+
+	habit := &Habit{Name: "Dishes", Frequency: "daily", TargetCount: 1, TeamID: member.TeamID}
+	if err := store.CreateHabit(habit); err != nil {
+		t.Fatalf("CreateHabit: %v", err)
+	}
+
+	habits, err := store.GetHabits()
+	if err != nil {
+		t.Fatalf("GetHabits: %v", err)
+	}
+	if containsHabit(habits, habit.ID) {
+		t.Errorf("GetHabits lists team habit %d", habit.ID)
+	}
+	habits, err = store.GetTeamHabits(member.TeamID)
+	if err != nil {
+		t.Fatalf("GetTeamHabits: %v", err)
+	}
+	if len(habits) != 1 || habits[0].ID != habit.ID || habits[0].TeamID != member.TeamID {
+		t.Errorf("GetTeamHabits = %v, want only habit %d", habits, habit.ID)
+	}
+
+	if err := store.CompleteHabit(habit.ID, member.ID, CompletionDetails{}); err != nil {
+		t.Fatalf("CompleteHabit: %v", err)
+	}
+	completions, err := store.GetCompletions(habit.ID)
+	if err != nil {
+		t.Fatalf("GetCompletions: %v", err)
+	}
+	if len(completions) != 1 || completions[0].MemberID != member.ID {
+		t.Errorf("GetCompletions = %+v, want one completion by member %d", completions, member.ID)
+	}
+}
+
+func containsHabit(habits []Habit, id int) bool {
+	for _, habit := range habits {
+		if habit.ID == id {
+			return true
+		}
+	}
+	return false
+}
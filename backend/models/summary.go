@@ -0,0 +1,217 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"habits/database"
+)
+
+// CompletionFilter selects completions and habits for reports. From and To
+// are inclusive days; a zero From means no lower bound.
+type CompletionFilter struct {
+	From     time.Time
+	To       time.Time
+	HabitIDs []int  // all habits when empty
+	TeamID   int    // a team's habits; personal habits when 0 and HabitIDs is empty
+	Tag      string // habits with this tag, when set
+}
+
+// where returns the condition on habits h selected by the filter
+func (f CompletionFilter) where() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if len(f.HabitIDs) > 0 {
+		conditions = append(conditions, "h.id IN (?"+strings.Repeat(", ?", len(f.HabitIDs)-1)+")")
+		for _, id := range f.HabitIDs {
+			args = append(args, id)
+		}
+	}
+	if f.TeamID != 0 {
+		conditions = append(conditions, "h.team_id = ?")
+		args = append(args, f.TeamID)
+	} else if len(f.HabitIDs) == 0 {
+		conditions = append(conditions, "h.team_id IS NULL")
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "h.id IN (SELECT habit_id FROM habit_tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// CompletionRecord is a completion with the names of its habit, team and
+// member, and its habit's tags
+type CompletionRecord struct {
+	HabitID     int
+	HabitName   string
+	TeamName    string
+	MemberName  string
+	CompletedAt time.Time
+	Value       *float64
+	Note        string
+	Tags        []string
+}
+
+// EachCompletion calls fn for every completion matching the filter, ordered
+// by habit and time, without loading them all into memory
+func EachCompletion(db *sql.DB, filter CompletionFilter, fn func(CompletionRecord) error) error {
+	where, args := filter.where()
+	tags, err := loadTags(db, where, args...)
+	if err != nil {
+		return err
+	}
+
+	if !filter.From.IsZero() {
+		where += " AND c.completed_at >= ?"
+		args = append(args, filter.From.Format("2006-01-02"))
+	}
+	where += " AND c.completed_at < ?"
+	args = append(args, filter.To.AddDate(0, 0, 1).Format("2006-01-02"))
+
+	rows, err := db.Query(`
+		SELECT h.id, h.name, COALESCE(t.name, ''), COALESCE(m.name, ''), c.completed_at, c.value, c.note
+		FROM habit_completions c
+		JOIN habits h ON h.id = c.habit_id
+		LEFT JOIN teams t ON t.id = h.team_id
+		LEFT JOIN team_members m ON m.id = c.member_id
+		WHERE `+where+`
+		ORDER BY c.habit_id, c.completed_at
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record CompletionRecord
+		err := rows.Scan(&record.HabitID, &record.HabitName, &record.TeamName, &record.MemberName, &record.CompletedAt, &record.Value, &record.Note)
+		if err != nil {
+			return err
+		}
+		record.CompletedAt = record.CompletedAt.UTC()
+		record.Tags = tags[record.HabitID]
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// HabitSummary is a habit's streaks and how often it met its target in
+// each period (day or week) of a date range. Holidays are not counted as
+// days and lower the target of their week.
+type HabitSummary struct {
+	Habit
+	TeamName       string
+	Tags           []string
+	From           time.Time // first day counted: the range start or the habit's creation
+	To             time.Time
+	Completions    int
+	Periods        int // periods counted, excluding the current one until it is met
+	PeriodsMet     int
+	PeriodRate     float64 // % of periods meeting the target
+	LastCompletion time.Time
+}
+
+// GetHabitSummaries summarises the habits matching the filter over its date
+// range, which is clamped to today
+func GetHabitSummaries(db *sql.DB, filter CompletionFilter) ([]HabitSummary, error) {
+	where, args := filter.where()
+	habits, err := queryHabits(db, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make(map[int]string)
+	teamList, err := GetTeams(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teamList {
+		teams[team.ID] = team.Name
+	}
+	tags, err := loadTags(db, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	today := truncateDay(time.Now().UTC())
+	to := truncateDay(filter.To)
+	if to.After(today) {
+		to = today
+	}
+
+	summaries := make([]HabitSummary, 0, len(habits))
+	index := make(map[int]int)
+	for _, habit := range habits {
+		from := truncateDay(filter.From)
+		if created := truncateDay(habit.CreatedAt.UTC()); from.Before(created) {
+			from = created
+		}
+		index[habit.ID] = len(summaries)
+		summaries = append(summaries, HabitSummary{Habit: habit, TeamName: teams[habit.TeamID], Tags: tags[habit.ID], From: from, To: to})
+	}
+
+	// Completions per habit and period, counted in one pass
+	counts := make(map[int]map[time.Time]int)
+	err = EachCompletion(db, CompletionFilter{From: filter.From, To: to, HabitIDs: filter.HabitIDs, TeamID: filter.TeamID, Tag: filter.Tag}, func(c CompletionRecord) error {
+		i, ok := index[c.HabitID]
+		if !ok {
+			return nil
+		}
+		s := &summaries[i]
+		s.Completions++
+		if c.CompletedAt.After(s.LastCompletion) {
+			s.LastCompletion = c.CompletedAt
+		}
+
+		if counts[c.HabitID] == nil {
+			counts[c.HabitID] = make(map[time.Time]int)
+		}
+		counts[c.HabitID][PeriodStart(s.Frequency, c.CompletedAt)]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range summaries {
+		s := &summaries[i]
+		current := PeriodStart(s.Frequency, today)
+		skip, err := habitSkipDays(db, database.SQLite, s.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for period := PeriodStart(s.Frequency, s.From); !period.After(s.To); period = nextPeriod(s.Frequency, period) {
+			target := PeriodTarget(&s.Habit)
+			if s.Frequency == "daily" && skip[period] {
+				continue // Holiday
+			}
+			if s.Frequency != "daily" {
+				target = WeekTarget(target, period, skip)
+			}
+			if target == 0 {
+				continue // Every required day was a holiday
+			}
+			met := counts[s.ID][period] >= target
+			if period.Equal(current) && !met {
+				continue // Still in progress
+			}
+			s.Periods++
+			if met {
+				s.PeriodsMet++
+			}
+		}
+		if s.Periods > 0 {
+			s.PeriodRate = float64(s.PeriodsMet) / float64(s.Periods) * 100
+		}
+	}
+
+	return summaries, nil
+}
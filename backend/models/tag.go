@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+
+	"habits/database"
+)
+
+// maxTagLen limits the length of a habit tag
+const maxTagLen = 50
+
+// ErrInvalidTag is returned for a tag that is empty, too long or contains a comma
+var ErrInvalidTag = errors.New("tags must be 1 to 50 characters without commas")
+
+// NormalizeTags trims and lowercases tags, drops duplicates and sorts them
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len([]rune(tag)) > maxTagLen || strings.Contains(tag, ",") {
+			return nil, ErrInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// GetHabitTags returns a habit's tags in alphabetical order
+func GetHabitTags(db *sql.DB, habitID int) ([]string, error) {
+	tags, err := loadTags(db, "h.id = ?", habitID)
+	if err != nil {
+		return nil, err
+	}
+	if tags[habitID] == nil {
+		return []string{}, nil
+	}
+	return tags[habitID], nil
+}
+
+// SetHabitTags replaces a habit's tags and recomputes its streak with the
+// holiday calendars of its new tags
+func SetHabitTags(db *sql.DB, habitID int, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM habit_tags WHERE habit_id = ?", habitID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO habit_tags (habit_id, tag) VALUES (?, ?)", habitID, tag); err != nil {
+			return err
+		}
+	}
+
+	if err := recalculateStreak(tx, database.SQLite, habitID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadTags returns the tags of the habits matching where (a condition on
+// habits h), in alphabetical order, by habit ID
+func loadTags(db querier, where string, args ...interface{}) (map[int][]string, error) {
+	rows, err := db.Query(`
+		SELECT t.habit_id, t.tag
+		FROM habit_tags t
+		JOIN habits h ON h.id = t.habit_id
+		WHERE `+where+`
+		ORDER BY t.habit_id, t.tag
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var habitID int
+		var tag string
+		if err := rows.Scan(&habitID, &tag); err != nil {
+			return nil, err
+		}
+		tags[habitID] = append(tags[habitID], tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,264 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Team member roles, in increasing order of privilege
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+var roleRank = map[string]int{
+	RoleMember: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// ValidRole reports whether role is a known team role
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Team represents a shared workspace whose habits belong to all its members
+type Team struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Computed fields
+	Members []TeamMember `json:"members"`
+}
+
+// TeamMember represents a member of a team and their role
+type TeamMember struct {
+	ID        int       `json:"id"`
+	TeamID    int       `json:"team_id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"` // owner, admin, member
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasRole reports whether the member's role is at least the given role
+func (m *TeamMember) HasRole(role string) bool {
+	return roleRank[m.Role] >= roleRank[role]
+}
+
+// CreateTeam creates a new team with owner as its first member. Both are
+// written in one transaction, so a team never exists without its owner.
+func CreateTeam(db *sql.DB, team *Team, owner *TeamMember) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT INTO teams (name, created_at) VALUES (?, ?)", team.Name, now)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	team.ID = int(id)
+	team.CreatedAt = now
+
+	owner.TeamID = team.ID
+	owner.Role = RoleOwner
+	if err := addTeamMember(tx, owner); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	team.Members = []TeamMember{*owner}
+	return nil
+}
+
+// GetTeams retrieves all teams
+func GetTeams(db *sql.DB) ([]Team, error) {
+	return getTeams(db)
+}
+
+func getTeams(db querier) ([]Team, error) {
+	rows, err := db.Query("SELECT id, name, created_at FROM teams ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []Team
+	for rows.Next() {
+		var team Team
+		if err := rows.Scan(&team.ID, &team.Name, &team.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+
+	return teams, rows.Err()
+}
+
+// GetTeam retrieves a single team by ID along with its members
+func GetTeam(db *sql.DB, id int) (*Team, error) {
+	var team Team
+	err := db.QueryRow("SELECT id, name, created_at FROM teams WHERE id = ?", id).Scan(&team.ID, &team.Name, &team.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	team.Members, err = GetTeamMembers(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// DeleteTeam deletes a team; its members and all of its habits cascade
+func DeleteTeam(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM teams WHERE id = ?", id)
+	return err
+}
+
+// GetTeamMembers retrieves all members of a team
+func GetTeamMembers(db *sql.DB, teamID int) ([]TeamMember, error) {
+	return getTeamMembers(db, teamID)
+}
+
+func getTeamMembers(db querier, teamID int) ([]TeamMember, error) {
+	query := `
+		SELECT id, team_id, name, role, created_at
+		FROM team_members
+		WHERE team_id = ?
+		ORDER BY created_at
+	`
+
+	rows, err := db.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []TeamMember{}
+	for rows.Next() {
+		var m TeamMember
+		if err := rows.Scan(&m.ID, &m.TeamID, &m.Name, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// GetTeamMember retrieves a member of a team by ID
+func GetTeamMember(db *sql.DB, teamID, memberID int) (*TeamMember, error) {
+	query := `
+		SELECT id, team_id, name, role, created_at
+		FROM team_members
+		WHERE id = ? AND team_id = ?
+	`
+
+	var m TeamMember
+	err := db.QueryRow(query, memberID, teamID).Scan(&m.ID, &m.TeamID, &m.Name, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// AddTeamMember adds a member to a team
+func AddTeamMember(db *sql.DB, member *TeamMember) error {
+	return addTeamMember(db, member)
+}
+
+func addTeamMember(db querier, member *TeamMember) error {
+	if member.Role == "" {
+		member.Role = RoleMember
+	}
+
+	now := time.Now()
+	result, err := db.Exec(
+		"INSERT INTO team_members (team_id, name, role, created_at) VALUES (?, ?, ?, ?)",
+		member.TeamID, member.Name, member.Role, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	member.ID = int(id)
+	member.CreatedAt = now
+	return nil
+}
+
+// UpdateTeamMemberRole changes the role of a team member
+func UpdateTeamMemberRole(db *sql.DB, teamID, memberID int, role string) error {
+	_, err := db.Exec("UPDATE team_members SET role = ? WHERE id = ? AND team_id = ?", role, memberID, teamID)
+	return err
+}
+
+// RemoveTeamMember removes a member from a team. Their rotation slots,
+// reactions and comments cascade; completions they recorded are kept without
+// a member so team history and stats stay intact.
+func RemoveTeamMember(db *sql.DB, teamID, memberID int) error {
+	_, err := db.Exec("DELETE FROM team_members WHERE id = ? AND team_id = ?", memberID, teamID)
+	return err
+}
+
+// CountTeamOwners returns the number of owners in a team
+func CountTeamOwners(db *sql.DB, teamID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM team_members WHERE team_id = ? AND role = ?", teamID, RoleOwner).Scan(&count)
+	return count, err
+}
+
+// MemberCompletionCount is the number of completions recorded by a team member
+type MemberCompletionCount struct {
+	MemberID    int    `json:"member_id"`
+	Name        string `json:"name"`
+	Completions int    `json:"completions"`
+}
+
+// GetMemberCompletionCounts counts completions of a team's habits per member
+func GetMemberCompletionCounts(db *sql.DB, teamID int) ([]MemberCompletionCount, error) {
+	query := `
+		SELECT tm.id, tm.name, COUNT(hc.id) as completions
+		FROM team_members tm
+		LEFT JOIN habit_completions hc ON hc.member_id = tm.id
+		WHERE tm.team_id = ?
+		GROUP BY tm.id, tm.name
+		ORDER BY completions DESC, tm.name
+	`
+
+	rows, err := db.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []MemberCompletionCount{}
+	for rows.Next() {
+		var c MemberCompletionCount
+		if err := rows.Scan(&c.MemberID, &c.Name, &c.Completions); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,372 @@
+// Package notes keeps a checklist of personal habits in each day's markdown
+// note of a notes vault (such as Obsidian daily notes) in sync with their
+// completions, in both directions.
+package notes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"habits/models"
+)
+
+// Conflict rules, for when a note and the app disagree about a day that was
+// never synced before
+const (
+	ConflictCompleted = "completed" // checked on either side wins
+	ConflictNote      = "note"      // the note wins
+	ConflictApp       = "app"       // the app wins
+)
+
+// Markers around the checklist in a note. Everything outside them is left alone.
+const (
+	blockStart = "<!-- habits -->"
+	blockEnd   = "<!-- /habits -->"
+)
+
+// checkboxLine matches a markdown task list item
+var checkboxLine = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.+?)\s*$`)
+
+// Config configures a Syncer
+type Config struct {
+	Dir      string // vault directory
+	Filename string // note path in Dir, with YYYY, MM and DD replaced by the date
+	Heading  string // written above the checklist when it is added to a note
+	Days     int    // days synced, ending today
+	Conflict string // ConflictCompleted, ConflictNote or ConflictApp
+}
+
+// DefaultConfig returns the configuration for syncing the notes in dir named
+// like 2025-01-31.md over the last week
+func DefaultConfig(dir string) Config {
+	return Config{
+		Dir:      dir,
+		Filename: "YYYY-MM-DD.md",
+		Heading:  "## Habits",
+		Days:     7,
+		Conflict: ConflictCompleted,
+	}
+}
+
+// Result counts what a sync changed
+type Result struct {
+	Notes       int `json:"notes"`   // notes read
+	Written     int `json:"written"` // notes created or updated
+	Completed   int `json:"completed"`
+	Uncompleted int `json:"uncompleted"`
+	Conflicts   int `json:"conflicts"`
+}
+
+func (r *Result) add(other Result) {
+	r.Notes += other.Notes
+	r.Written += other.Written
+	r.Completed += other.Completed
+	r.Uncompleted += other.Uncompleted
+	r.Conflicts += other.Conflicts
+}
+
+// Syncer syncs the daily notes of a vault with the database. Only today's
+// note is created if missing; older days are synced only if their note
+// exists. A habit checked or unchecked in a note since the last sync is
+// completed or uncompleted that day, and a change in the app since the last
+// sync is written to the note. The checklist lists the personal habits that
+// existed that day.
+type Syncer struct {
+	db     *sql.DB
+	config Config
+	mu     sync.Mutex // one sync at a time
+}
+
+// New returns a Syncer for a vault directory that must exist
+func New(db *sql.DB, config Config) (*Syncer, error) {
+	switch config.Conflict {
+	case ConflictCompleted, ConflictNote, ConflictApp:
+	default:
+		return nil, fmt.Errorf("invalid conflict rule %q (available: completed, note, app)", config.Conflict)
+	}
+	if config.Days < 1 {
+		return nil, fmt.Errorf("invalid number of days %d", config.Days)
+	}
+	if !strings.Contains(config.Filename, "DD") {
+		return nil, fmt.Errorf("note filename %q must contain the date (YYYY-MM-DD)", config.Filename)
+	}
+
+	info, err := os.Stat(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", config.Dir)
+	}
+
+	return &Syncer{db: db, config: config}, nil
+}
+
+// Sync syncs the notes of the configured number of days, ending today
+func (s *Syncer) Sync() (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total Result
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i := s.config.Days - 1; i >= 0; i-- {
+		result, err := s.syncDay(today.AddDate(0, 0, -i), today)
+		if err != nil {
+			return total, err
+		}
+		total.add(result)
+	}
+
+	return total, nil
+}
+
+// Watch syncs every interval until the process exits, so edits to notes and
+// completions in the app are picked up without a restart. Failures are logged.
+func (s *Syncer) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			result, err := s.Sync()
+			if err != nil {
+				log.Printf("Notes sync failed: %v", err)
+				continue
+			}
+			if result.Written > 0 || result.Completed > 0 || result.Uncompleted > 0 {
+				log.Printf("Notes sync: %d notes written, %d completed, %d uncompleted, %d conflicts",
+					result.Written, result.Completed, result.Uncompleted, result.Conflicts)
+			}
+		}
+	}()
+}
+
+// path returns the note file for a day
+func (s *Syncer) path(day time.Time) string {
+	name := strings.NewReplacer("YYYY", day.Format("2006"), "MM", day.Format("01"), "DD", day.Format("02")).Replace(s.config.Filename)
+	return filepath.Join(s.config.Dir, filepath.FromSlash(name))
+}
+
+// syncDay reconciles one day's note with that day's completions
+func (s *Syncer) syncDay(day, today time.Time) (Result, error) {
+	var result Result
+	path := s.path(day)
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		result.Notes++
+	case os.IsNotExist(err) && day.Equal(today):
+		// Today's note is created
+	case os.IsNotExist(err):
+		return result, nil
+	default:
+		return result, err
+	}
+	content := string(data)
+
+	habits, err := models.GetPersonalHabits(s.db)
+	if err != nil {
+		return result, err
+	}
+	sort.Slice(habits, func(a, b int) bool { return habits[a].ID < habits[b].ID })
+
+	completed, err := models.GetCompletedOn(s.db, day)
+	if err != nil {
+		return result, err
+	}
+	state, err := models.GetNoteSyncState(s.db, day)
+	if err != nil {
+		return result, err
+	}
+	checklist := parseChecklist(content)
+
+	var listed []models.Habit
+	checked := make(map[int]bool)
+	for _, habit := range habits {
+		if habit.CreatedAt.UTC().Truncate(24 * time.Hour).After(day) {
+			continue // Did not exist yet
+		}
+		listed = append(listed, habit)
+
+		inApp := completed[habit.ID]
+		inNote, listedInNote := checklist[habit.Name]
+		last, synced := state[habit.ID]
+
+		want := inApp
+		switch {
+		case !listedInNote || inNote == inApp:
+		case synced && inNote == last:
+			// Changed in the app; the note is updated below
+		case synced && inApp == last:
+			want = inNote // Changed in the note
+		default:
+			result.Conflicts++
+			want = s.resolve(inNote, inApp)
+		}
+
+		if want != inApp {
+			if _, err := models.SetCompletedOn(s.db, habit.ID, 0, day, want); err != nil {
+				return result, err
+			}
+			if want {
+				result.Completed++
+			} else {
+				result.Uncompleted++
+			}
+		}
+		checked[habit.ID] = want
+	}
+
+	updated := replaceChecklist(content, s.config.Heading, renderChecklist(listed, checked))
+	if updated != content {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return result, err
+		}
+		if err := writeFile(path, []byte(updated)); err != nil {
+			return result, err
+		}
+		result.Written++
+	}
+
+	if err := models.SaveNoteSyncState(s.db, day, checked); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// writeFile replaces a note atomically, through a temporary file renamed
+// over it, so an editor never sees it half written
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resolve applies the conflict rule to a habit checked differently in the
+// note and the app
+func (s *Syncer) resolve(inNote, inApp bool) bool {
+	switch s.config.Conflict {
+	case ConflictNote:
+		return inNote
+	case ConflictApp:
+		return inApp
+	default:
+		return inNote || inApp
+	}
+}
+
+// parseChecklist reads whether each habit is checked in a note's checklist,
+// by name
+func parseChecklist(content string) map[string]bool {
+	checklist := make(map[string]bool)
+	start, end, _, ok := checklistBounds(content)
+	if !ok {
+		return checklist
+	}
+
+	for _, line := range strings.Split(content[start+len(blockStart):end], "\n") {
+		match := checkboxLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if match == nil {
+			continue
+		}
+		checklist[match[2]] = match[1] != " "
+	}
+
+	return checklist
+}
+
+// renderChecklist formats the checklist block for habits
+func renderChecklist(habits []models.Habit, checked map[int]bool) string {
+	var b strings.Builder
+	b.WriteString(blockStart + "\n")
+	for _, habit := range habits {
+		mark := " "
+		if checked[habit.ID] {
+			mark = "x"
+		}
+		b.WriteString("- [" + mark + "] " + strings.ReplaceAll(habit.Name, "\n", " ") + "\n")
+	}
+	b.WriteString(blockEnd)
+	return b.String()
+}
+
+// checklistBounds finds a note's checklist, from its start marker to the end
+// of its end marker. If the end marker was deleted, the checklist ends at the
+// first line after the start marker that is not a checkbox, so what follows
+// it is kept; closed is then false.
+func checklistBounds(content string) (start, end int, closed, ok bool) {
+	start = strings.Index(content, blockStart)
+	if start < 0 {
+		return 0, 0, false, false
+	}
+	if i := strings.Index(content[start:], blockEnd); i >= 0 {
+		return start, start + i + len(blockEnd), true, true
+	}
+
+	end = start + len(blockStart)
+	if i := strings.Index(content[end:], "\n"); i >= 0 {
+		end += i + 1
+	} else {
+		return start, len(content), false, true
+	}
+	for end < len(content) {
+		line := content[end:]
+		next := len(content)
+		if i := strings.Index(line, "\n"); i >= 0 {
+			line, next = line[:i], end+i+1
+		}
+		if !checkboxLine.MatchString(strings.TrimRight(line, "\r")) {
+			break
+		}
+		end = next
+	}
+	return start, end, false, true
+}
+
+// replaceChecklist puts block in place of a note's checklist, or appends it
+// under heading if the note has none
+func replaceChecklist(content, heading, block string) string {
+	if start, end, closed, ok := checklistBounds(content); ok {
+		if !closed {
+			block += "\n" // Keep the line break before what followed the checkboxes
+		}
+		return content[:start] + block + content[end:]
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	if heading != "" {
+		content += heading + "\n"
+	}
+	return content + block + "\n"
+}
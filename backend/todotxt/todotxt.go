@@ -0,0 +1,208 @@
+// Package todotxt bridges habits and todo.txt: the habits due today are
+// written as todo.txt tasks, and completed ("x") tasks read back from
+// done.txt complete their habits.
+package todotxt
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"habits/models"
+)
+
+// Project is the project tag on every exported task
+const Project = "habits"
+
+// habitKey is the key:value tag identifying a task's habit
+const habitKey = "habit"
+
+// dateLayout is the todo.txt date format
+const dateLayout = "2006-01-02"
+
+// dateField matches a todo.txt date
+var dateField = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// priorityField matches a todo.txt priority
+var priorityField = regexp.MustCompile(`^\([A-Z]\)$`)
+
+// Task is a completed task read from done.txt
+type Task struct {
+	Line        int
+	CompletedOn time.Time // the completion date, or today if the line has none
+	Text        string    // the description without tags
+	HabitID     int       // from the habit: tag, 0 if missing
+}
+
+// Result reports what an import did
+type Result struct {
+	Completed   int         `json:"completed"`
+	AlreadyDone int         `json:"already_done"`
+	Unmatched   []Unmatched `json:"unmatched"`
+}
+
+// Unmatched is a completed task that did not complete a habit
+type Unmatched struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+// Due reports whether a habit still needs doing today: it is not a skip day,
+// the habit was not completed today and its period target is not yet met
+func Due(habit *models.Habit) bool {
+	return !habit.IsSkipDay && !habit.IsCompletedToday && habit.PeriodCompletions < habit.PeriodTarget
+}
+
+// Write writes the habits due on day as todo.txt tasks, created that day and
+// due the same day, tagged +habits, +team (if team is set) and habit:<id>
+func Write(w io.Writer, habits []models.Habit, team string, day time.Time) error {
+	date := day.Format(dateLayout)
+	tags := " +" + Project
+	if team != "" {
+		tags += " +" + tagName(team)
+	}
+
+	for i := range habits {
+		habit := &habits[i]
+		if !Due(habit) {
+			continue
+		}
+
+		text := strings.Join(strings.Fields(habit.Name), " ")
+		if habit.Frequency != "daily" {
+			text += fmt.Sprintf(" (%d/%d this week)", habit.PeriodCompletions, habit.PeriodTarget)
+		}
+		_, err := fmt.Fprintf(w, "%s %s%s %s:%d due:%s\n", date, text, tags, habitKey, habit.ID, date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagName makes a name usable as a project tag
+func tagName(name string) string {
+	return strings.Join(strings.Fields(name), "-")
+}
+
+// ParseDone reads the completed tasks of a todo.txt or done.txt file.
+// Incomplete tasks are skipped.
+func ParseDone(r io.Reader, today time.Time) ([]Task, error) {
+	var tasks []Task
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if len(fields) == 0 || fields[0] != "x" {
+			continue
+		}
+		fields = fields[1:]
+		if len(fields) > 0 && priorityField.MatchString(fields[0]) {
+			fields = fields[1:] // Some clients keep the priority
+		}
+
+		task := Task{Line: line, CompletedOn: today}
+		if len(fields) > 0 && dateField.MatchString(fields[0]) {
+			completed, err := time.Parse(dateLayout, fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid completion date %q", line, fields[0])
+			}
+			task.CompletedOn = completed
+			fields = fields[1:]
+			if len(fields) > 0 && dateField.MatchString(fields[0]) {
+				fields = fields[1:] // Creation date
+			}
+		}
+
+		var words []string
+		for _, field := range fields {
+			switch {
+			case len(field) > 1 && (field[0] == '+' || field[0] == '@'):
+				// Project or context
+			case strings.HasPrefix(field, habitKey+":"):
+				id, err := strconv.Atoi(strings.TrimPrefix(field, habitKey+":"))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid habit tag %q", line, field)
+				}
+				task.HabitID = id
+			case isKeyValue(field):
+				// Other tags, such as due: or pri:
+			default:
+				words = append(words, field)
+			}
+		}
+		task.Text = strings.Join(words, " ")
+		tasks = append(tasks, task)
+	}
+
+	return tasks, scanner.Err()
+}
+
+// isKeyValue reports whether a field is a key:value tag
+func isKeyValue(field string) bool {
+	key, value, ok := strings.Cut(field, ":")
+	return ok && key != "" && value != "" && !strings.Contains(value, "/")
+}
+
+// Import completes the habits of completed tasks on their completion dates,
+// recording memberID (0 for none). Tasks are matched to habits by their
+// habit: tag, or else by name; only habits in the given list can be
+// completed, and never on a future day.
+func Import(db *sql.DB, tasks []Task, habits []models.Habit, memberID int, today time.Time) (*Result, error) {
+	byID := make(map[int]*models.Habit)
+	byName := make(map[string]*models.Habit)
+	for i := range habits {
+		byID[habits[i].ID] = &habits[i]
+		byName[strings.ToLower(strings.Join(strings.Fields(habits[i].Name), " "))] = &habits[i]
+	}
+
+	result := &Result{Unmatched: []Unmatched{}}
+	for _, task := range tasks {
+		var habit *models.Habit
+		if task.HabitID != 0 {
+			habit = byID[task.HabitID]
+		} else {
+			habit = byName[strings.ToLower(stripProgress(task.Text))]
+		}
+		if habit == nil {
+			result.Unmatched = append(result.Unmatched, Unmatched{Line: task.Line, Text: task.Text, Reason: "no matching habit"})
+			continue
+		}
+		if task.CompletedOn.After(today) {
+			result.Unmatched = append(result.Unmatched, Unmatched{Line: task.Line, Text: task.Text, Reason: "completed in the future"})
+			continue
+		}
+		if task.CompletedOn.Before(habit.CreatedAt.UTC().Truncate(24 * time.Hour)) {
+			result.Unmatched = append(result.Unmatched, Unmatched{Line: task.Line, Text: task.Text, Reason: "completed before the habit was created"})
+			continue
+		}
+
+		changed, err := models.SetCompletedOn(db, habit.ID, memberID, task.CompletedOn, true)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			result.Completed++
+		} else {
+			result.AlreadyDone++
+		}
+	}
+
+	return result, nil
+}
+
+// weeklyProgress matches the progress Write appends to weekly habits
+var weeklyProgress = regexp.MustCompile(`\s*\(\d+/\d+ this week\)$`)
+
+// stripProgress removes the weekly progress from an exported task's text
+func stripProgress(text string) string {
+	return weeklyProgress.ReplaceAllString(text, "")
+}